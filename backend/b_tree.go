@@ -2,8 +2,6 @@ package backend
 
 import (
 	"fmt"
-	"os"
-	"tiny-rdb/util"
 	"unsafe"
 )
 
@@ -77,7 +75,7 @@ const (
 	InternalNodeKeySize        = 4 // 4 bytes
 	InternalNodeChildSize      = 4 // 4 bytes
 	InternalNodeCellSize       = InternalNodeKeySize + InternalNodeChildSize
-	InternalNodeCellsSpaceSize = NodeSize - InternalNodeHeaderSize
+	InternalNodeCellsSpaceSize = NodeSize - InternalNodeHeaderSize - FileFormatSize // The format of DB file is at the end of page 0
 	InternalNodeMaxCells       = InternalNodeCellsSpaceSize / InternalNodeCellSize
 )
 
@@ -108,17 +106,18 @@ const (
 
 // #__byte 0__#__byte 1__#_________________byte 2-5_________________#_________________byte 6-9_________________#_________________byte 10-13_________________#
 // byte 0: NodeType(1 byte), byte 1: IsRootNode(1 byte), byte 2-5:ParentNodePointer(4 bytes), byte 6-9: LeafNodeCellsNum(4 bytes), byte 10-13: LeafNodeNextLeaf(4 bytes)
-// #_________________byte 14-17_________________#___________________________________________byte 18-309_____________________________________________________________#
-// byte 14-17: Key0(4 bytes), byte 18-309: Value0(292 bytes)
+// #_________________byte 14-17_________________#___________________________________________byte 18-313_____________________________________________________________#
+// byte 14-17: Key0(4 bytes), byte 18-313: Value0(296 bytes, the last 4 bytes of value is the null bitmap of row)
 // ............
 // ............
 // Leaf node cell format layout repeat until LeafNodeCellsNum like above
 // ............
 // ............
-// #_________________byte 3566-3569_________________#___________________________________________byte 3570-3861_____________________________________________________________#
-// byte 3566-3569: Key12(4 bytes), byte 3570-3861: Value12(292 bytes)
-// #_________________________________________________byte 3862-4095______________________________________________________#
-// byte 3862-4095: specific-byte(0x00) filled space (leave it empty to avoid splitting cells between nodes)
+// #_________________byte 3614-3617_________________#___________________________________________byte 3618-3913_____________________________________________________________#
+// byte 3614-3617: Key12(4 bytes), byte 3618-3913: Value12(296 bytes)
+// #_________________________________________________byte 3914-4095______________________________________________________#
+// byte 3914-4095: specific-byte(0x00) filled space (leave it empty to avoid splitting cells between nodes),
+// the last 8 bytes 4088-4095 of page 0 keep the format of DB file
 
 // #########################################################################################################################################################################
 
@@ -135,21 +134,21 @@ const (
 // Internal node cell format layout repeat until InteranlNodeKeysNum like above
 // ............
 // ............
-// #_________________byte 4086-4089_________________#_________________byte 4090-4093_________________#
-// byte 4086-4089: ChildPointer509(4 bytes), byte 4090-4093: Key509(4 bytes)
-// #_________________________________________________byte 4094-4095______________________________________________________#
-// byte 4094-4095: specific-byte(0x00) filled space (2 bytes)
+// #_________________byte 4078-4081_________________#_________________byte 4082-4085_________________#
+// byte 4078-4081: ChildPointer508(4 bytes), byte 4082-4085: Key508(4 bytes)
+// #_________________________________________________byte 4086-4095______________________________________________________#
+// byte 4086-4087: specific-byte(0x00) filled space (2 bytes), byte 4088-4095: format of DB file on page 0 (8 bytes)
 
 // Notice our huge branching factor. Because each child pointer / key pair is so small
-// it can fit 510 keys and 511 child pointers in each internal node.
+// it can fit 509 keys and 510 child pointers in each internal node.
 // That means it never have to traverse many layers of the tree to find a given key.
 
 // Internal node layers             max of leaf nodes        size of all leaf nodes
-//       0                               511^0=1                      4kB
-//       1                               511^1=511                 511 * 4k = 2MB
-//       2                               511^2=261121              1020MB = 1GB
-//       3                               511^3=133432831           510GB
-//       N                               511^N                     (511)^N * 4kB
+//       0                               510^0=1                      4kB
+//       1                               510^1=510                 510 * 4k = 2MB
+//       2                               510^2=260100              1016MB = 1GB
+//       3                               510^3=132651000           506GB
+//       N                               510^N                     (510)^N * 4kB
 
 // In actuality, It can’t store a full 4 KB of data per leaf node due to the overhead of the header, keys, and wasted space.
 // But it can search through something like 510 GB of data with 3-level B-tree by loading only 4 pages(file seeks is 4 times) from disk.
@@ -198,8 +197,7 @@ func InternalNodeKey(node []byte, cellNum uint32) *uint32 {
 func InternalNodeChild(node []byte, childNum uint32) *uint32 {
 	var numKeys uint32 = *InternalNodeNumKeys(node)
 	if childNum > numKeys {
-		fmt.Printf("Tried to access child_num %v > num_keys %v\n", childNum, numKeys)
-		os.Exit(util.ExitFailure)
+		raise("Tried to access child_num %v > num_keys %v", childNum, numKeys)
 		return nil
 	} else if childNum == numKeys {
 		return internalNodeRightChildPtr(node)
@@ -245,8 +243,7 @@ func GetNodeMaxKeys(node []byte) uint32 {
 		// For a leaf node, it’s the key at the maximum index
 		return *LeafNodeKey(node, *LeafNodeNumCells(node)-1)
 	default:
-		fmt.Printf("Unkown node type\n")
-		os.Exit(util.ExitFailure)
+		raise("Unkown node type")
 		return 0
 	}
 }
@@ -258,15 +255,15 @@ func CreateNewRootNode(table *Table, rightNodePageNum uint32) {
 	// Address of right child passed in.
 	// Re-initialize root page to contain the new root node.
 	// New root node points to two children.
-	var rootPage *Page = GetPage(table.Pager, table.RootPageNum)
-	var rightPage *Page = GetPage(table.Pager, rightNodePageNum)
+	var rootPage *Page = GetPageForWrite(table.Pager, table.RootPageNum)
+	var rightPage *Page = GetPageForWrite(table.Pager, rightNodePageNum)
 	var leftNodePageNum uint32 = GetUnallocatedPageNum(table.Pager)
-	var leftPage *Page = GetPage(table.Pager, leftNodePageNum)
+	var leftPage *Page = GetPageForWrite(table.Pager, leftNodePageNum)
 
 	// The old root page is copied to the left node so we can reuse the root page
 	// Left child has data copied from old root
 	if copy(leftPage.Mem[:], rootPage.Mem[:]) != PageSize {
-		os.Exit(util.ExitFailure)
+		raise("Copy of root page %v is short", table.RootPageNum)
 	}
 	SetRootNode(leftPage.Mem[:], false)
 
@@ -335,34 +332,43 @@ func LeafNodeValue(node []byte, cellNum uint32) []byte {
 // SplitAndInsertLeafNode split a leaf node in two nodes. And after that, we need to create an internal node to act as a parent node for the two leaf nodes.
 // If there is no space on the leaf node, we would split the existing entries residing there and the new one (being inserted) into two equal halves:
 // lower and upper halves. (Keys on the upper half are strictly greater than those on the lower half.) We allocate a new leaf node, and move the upper half into the new node.
+// Ascending keys are appended to the rightmost leaf, an even split would leave every leaf half empty. So when the key goes after
+// the last cell of the rightmost leaf, the existing entries stay in the full old node and the new node starts with the new key only.
 func SplitAndInsertLeafNode(cursor *Cursor, key uint32, value *Row) {
 	// Create a new node and move half the cells over.
 	// Insert the new value in one of the two nodes.
 	// Update parent or create a new parent.
-	var oldPage *Page = GetPage(cursor.TablePtr.Pager, cursor.PageNum)
+	var oldPage *Page = GetPageForWrite(cursor.TablePtr.Pager, cursor.PageNum)
 	var oldMaxKey uint32 = GetNodeMaxKeys(oldPage.Mem[:])
 	var newPageNum uint32 = GetUnallocatedPageNum(cursor.TablePtr.Pager)
-	var newPage *Page = GetPage(cursor.TablePtr.Pager, newPageNum)
+	var newPage *Page = GetPageForWrite(cursor.TablePtr.Pager, newPageNum)
 
 	InitializeLeafNode(newPage.Mem[:])
 	*ParentNode(newPage.Mem[:]) = *ParentNode(oldPage.Mem[:])
 
+	// Appending to the rightmost leaf keeps the old node full
+	var leftSplitCount uint32 = LeafNodeLeftSplitCount
+	if cursor.CellNum == LeafNodeMaxCells && *LeafNodeNextLeaf(oldPage.Mem[:]) == 0 {
+		leftSplitCount = LeafNodeMaxCells
+	}
+
 	// insertion of leaf node's single-linked list
 	*LeafNodeNextLeaf(newPage.Mem[:]) = *LeafNodeNextLeaf(oldPage.Mem[:])
 	*LeafNodeNextLeaf(oldPage.Mem[:]) = newPageNum
 
 	// All existing keys and new key should be divided
-	// evenly between old (left) and new (right) nodes to rebalance
+	// between old (left) and new (right) nodes to rebalance
 	// Starting from the right, move each key to correct position.
 	for i := int32(LeafNodeMaxCells); i >= 0; i-- {
 		var destinationPage *Page = nil
-		if i >= LeafNodeLeftSplitCount {
+		var indexWithinNode uint32 = uint32(i)
+		if uint32(i) >= leftSplitCount {
 			destinationPage = newPage
+			indexWithinNode -= leftSplitCount
 		} else {
 			destinationPage = oldPage
 		}
 
-		var indexWithinNode uint32 = uint32(i) % LeafNodeLeftSplitCount
 		var destinationCell []byte = LeafNodeCell(destinationPage.Mem[:], indexWithinNode)
 		if uint32(i) == cursor.CellNum {
 			SerializeRow(value, LeafNodeValue(destinationPage.Mem[:], indexWithinNode))
@@ -375,15 +381,15 @@ func SplitAndInsertLeafNode(cursor *Cursor, key uint32, value *Row) {
 	}
 
 	// update leaf and right nodes num cells
-	*LeafNodeNumCells(oldPage.Mem[:]) = LeafNodeLeftSplitCount
-	*LeafNodeNumCells(newPage.Mem[:]) = LeafNodeRightSplitCount
+	*LeafNodeNumCells(oldPage.Mem[:]) = leftSplitCount
+	*LeafNodeNumCells(newPage.Mem[:]) = LeafNodeMaxCells + 1 - leftSplitCount
 
 	if IsRootNode(oldPage.Mem[:]) {
 		CreateNewRootNode(cursor.TablePtr, newPageNum)
 	} else {
 		var parentPageNum uint32 = *ParentNode(oldPage.Mem[:])
 		var newMaxKey uint32 = GetNodeMaxKeys(oldPage.Mem[:])
-		var parentPage *Page = GetPage(cursor.TablePtr.Pager, parentPageNum)
+		var parentPage *Page = GetPageForWrite(cursor.TablePtr.Pager, parentPageNum)
 
 		// Update Parent Internal node
 		updateInternalNodeKey(parentPage.Mem[:], oldMaxKey, newMaxKey)
@@ -401,17 +407,17 @@ func updateInternalNodeKey(node []byte, oldKey uint32, newKey uint32) {
 // InsertInternalNode insert a new internal node
 func InsertInternalNode(table *Table, parentPageNum uint32, childPageNum uint32) {
 	// Add a new child/key pair to parent that corresponds to child
-	var parentPage *Page = GetPage(table.Pager, parentPageNum)
+	var parentPage *Page = GetPageForWrite(table.Pager, parentPageNum)
 	var childPage *Page = GetPage(table.Pager, childPageNum)
 	var childMaxKey uint32 = GetNodeMaxKeys(childPage.Mem[:])
 
 	var parentChildKeyIndex uint32 = findInternalNodeChild(parentPage.Mem[:], childMaxKey)
 	var oldParentNodeNumKeys uint32 = *InternalNodeNumKeys(parentPage.Mem[:])
-	*InternalNodeNumKeys(parentPage.Mem[:]) = oldParentNodeNumKeys + 1
 	if oldParentNodeNumKeys >= InternalNodeMaxCells {
 		// TODO: Split internal node
-		os.Exit(util.ExitFailure)
+		raise("Internal node %v is full, splitting internal node is not supported", parentPageNum)
 	}
+	*InternalNodeNumKeys(parentPage.Mem[:]) = oldParentNodeNumKeys + 1
 
 	var rightChildPageNum uint32 = *internalNodeRightChildPtr(parentPage.Mem[:])
 	var rightChildPage *Page = GetPage(table.Pager, rightChildPageNum)
@@ -439,7 +445,7 @@ func InsertInternalNode(table *Table, parentPageNum uint32, childPageNum uint32)
 // InsertLeafNode Inserting a key/value pair into a leaf node.
 // It will take a cursor as input to represent the position where the pair should be inserted.
 func InsertLeafNode(cursor *Cursor, key uint32, value *Row) {
-	var page *Page = GetPage(cursor.TablePtr.Pager, cursor.PageNum)
+	var page *Page = GetPageForWrite(cursor.TablePtr.Pager, cursor.PageNum)
 	var numCells uint32 = *LeafNodeNumCells(page.Mem[:])
 	if numCells >= LeafNodeMaxCells {
 		// Leaf node full, need to split into two leaf node
@@ -526,6 +532,48 @@ func FindInternalNode(table *Table, pageNum uint32, key uint32) *Cursor {
 	return nil
 }
 
+// TreeDepth Get the number of levels of the B-tree, a single root leaf node has depth 1
+func TreeDepth(table *Table) uint32 {
+	var depth uint32 = 1
+	var page *Page = GetPage(table.Pager, table.RootPageNum)
+	for GetNodeType(page.Mem[:]) == TypeInternalNode {
+		page = GetPage(table.Pager, *InternalNodeChild(page.Mem[:], 0))
+		depth++
+	}
+	return depth
+}
+
+// MaxKey Get the max key of the tree by descending along the right child pointers to the rightmost leaf.
+// Return false if the tree is empty.
+func MaxKey(table *Table) (uint32, bool) {
+	var page *Page = GetPage(table.Pager, table.RootPageNum)
+	for GetNodeType(page.Mem[:]) == TypeInternalNode {
+		page = GetPage(table.Pager, *internalNodeRightChildPtr(page.Mem[:]))
+	}
+
+	if *LeafNodeNumCells(page.Mem[:]) == 0 {
+		return 0, false
+	}
+	return GetNodeMaxKeys(page.Mem[:]), true
+}
+
+// CountLeafCells Walk the leaf nodes' single-linked list and sum up the num of cells in the leaf headers.
+// Only the leaf headers are read, so it is a cheap estimate of the rows of the table.
+func CountLeafCells(table *Table) (leafPages uint32, numCells uint32) {
+	var cursor *Cursor = Find(table, 0)
+	var pageNum uint32 = cursor.PageNum
+	for {
+		var page *Page = GetPage(table.Pager, pageNum)
+		leafPages++
+		numCells += *LeafNodeNumCells(page.Mem[:])
+		pageNum = *LeafNodeNextLeaf(page.Mem[:])
+		if pageNum == 0 {
+			break
+		}
+	}
+	return leafPages, numCells
+}
+
 // indent the numbers of level for B-tree
 func indent(level uint32) {
 	for i := uint32(0); i < level; i++ {
@@ -571,3 +619,20 @@ func PrintTree(pager *Pager, pageNum uint32, indentLevel uint32) {
 		PrintTree(pager, child, indentLevel+1)
 	}
 }
+
+// CanInsertLeafNode Check if a key/value pair can be inserted at cursor. A full leaf node is split, which needs
+// new pages and a key in its parent, and the internal node can not be split yet.
+func CanInsertLeafNode(cursor *Cursor) bool {
+	var node []byte = GetPage(cursor.TablePtr.Pager, cursor.PageNum).Mem[:]
+	if *LeafNodeNumCells(node) < LeafNodeMaxCells {
+		return true
+	}
+
+	var pager *Pager = cursor.TablePtr.Pager
+	if IsRootNode(node) {
+		// The root is copied to a new left child
+		return pager.NumPages+2 <= TableMaxPages
+	}
+	var parent []byte = GetPage(pager, *ParentNode(node)).Mem[:]
+	return pager.NumPages+1 <= TableMaxPages && *InternalNodeNumKeys(parent) < InternalNodeMaxCells
+}
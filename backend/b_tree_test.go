@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"os"
 	"strconv"
 	"testing"
 	"tiny-rdb/util"
@@ -60,3 +61,38 @@ func TestPrintBTree(t *testing.T) {
 	}
 
 }
+
+func TestAppendSplit(t *testing.T) {
+	dbFile := "./AppendSplit.db"
+	table := OpenDB(dbFile)
+
+	// Ascending keys leave every leaf full but the rightmost one
+	var numKeys uint32 = 90*LeafNodeMaxCells + 1
+	insertKeys(table, 1, numKeys)
+	leafPages, numCells := CountLeafCells(table)
+	if leafPages != (numKeys+LeafNodeMaxCells-1)/LeafNodeMaxCells || numCells != numKeys {
+		t.Errorf("leaves must be full after sequential inserts: %v cells in %v leaves", numCells, leafPages)
+	}
+	checkKeys(t, table, numKeys)
+
+	// A key in the middle still splits the leaf in half
+	CloseDB(table)
+	os.Remove(dbFile)
+	table = OpenDB(dbFile)
+	for i := uint32(1); i <= LeafNodeMaxCells; i++ {
+		var row Row
+		row.PrimaryID = i * 2
+		InsertLeafNode(Find(table, i*2), i*2, &row)
+	}
+	var row Row
+	row.PrimaryID = 1
+	InsertLeafNode(Find(table, 1), 1, &row)
+	var root []byte = GetPage(table.Pager, table.RootPageNum).Mem[:]
+	var left []byte = GetPage(table.Pager, *InternalNodeChild(root, 0)).Mem[:]
+	if *LeafNodeNumCells(left) != LeafNodeLeftSplitCount {
+		t.Errorf("the leaf must be split in half: %v", *LeafNodeNumCells(left))
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+}
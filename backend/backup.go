@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// BackupFileSuffix suffix of the file the pages are copied to before it is renamed to the backup
+const BackupFileSuffix = ".backup"
+
+// BackupStepAll copy all the rest pages in one step
+const BackupStepAll = -1
+
+// ErrBackupSameFile the backup would replace the DB file it copies
+var ErrBackupSameFile = errors.New("backup: destination is the DB file itself")
+
+// Backup an online backup of table to another DB file.
+//
+// The pages are copied from the snapshot taken when the backup begins, so the backup is the committed table
+// at that time even if the table changes while it is copied. The snapshot shares the cached pages of table
+// (copy-on-write), taking it copies no page but reads the pages not cached yet under the read lock of table.
+// Step writes the pages of the snapshot without any lock of table, so the statements are not blocked by the steps,
+// while the pages the statements change are kept in memory for the snapshot until the backup is closed.
+// The pages are written to a temporary file which is renamed to the destination after the last page,
+// so the destination never holds a partial backup.
+type Backup struct {
+	snapshot *Table
+	fileName string
+	file     *os.File
+	next     uint32 // the page to copy next
+	done     bool
+}
+
+// NewBackup Begin an online backup of table to the DB file of fileName, the file is replaced when the backup is done
+func NewBackup(table *Table, fileName string) (*Backup, error) {
+	if info, err := os.Stat(fileName); err == nil && table.Pager.FilePtr != nil {
+		if dbInfo, err := table.Pager.FilePtr.Stat(); err == nil && os.SameFile(info, dbInfo) {
+			return nil, ErrBackupSameFile
+		}
+	}
+
+	file, err := os.OpenFile(fileName+BackupFileSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create backup file: %s", err.Error())
+	}
+
+	var backup *Backup = new(Backup)
+	backup.snapshot = Snapshot(table)
+	backup.fileName = fileName
+	backup.file = file
+	return backup, nil
+}
+
+// PageCount Get the number of pages of the backup
+func (backup *Backup) PageCount() uint32 {
+	return backup.snapshot.Pager.NumPages
+}
+
+// Remaining Get the number of pages not copied yet
+func (backup *Backup) Remaining() uint32 {
+	return backup.snapshot.Pager.NumPages - backup.next
+}
+
+// Step Copy up to numPages pages, BackupStepAll copies all the rest pages.
+// Return true when all pages are copied and the backup is in place of the destination.
+func (backup *Backup) Step(numPages int) (bool, error) {
+	if backup.done {
+		return true, nil
+	}
+	if backup.file == nil {
+		return false, os.ErrClosed
+	}
+
+	var pager *Pager = backup.snapshot.Pager
+	for ; backup.next < pager.NumPages && numPages != 0; numPages-- {
+		// The snapshot is shared, page 0 is stamped in a copy
+		var page Page = *GetPage(pager, backup.next)
+		if backup.next == 0 {
+			stampFileFormat(&page)
+		}
+		if _, err := backup.file.WriteAt(page.Mem[:], int64(backup.next)*PageSize); err != nil {
+			backup.Close()
+			return false, fmt.Errorf("Unable to write backup file: %s", err.Error())
+		}
+		backup.next++
+	}
+	if backup.next < pager.NumPages {
+		return false, nil
+	}
+
+	if err := backup.finish(); err != nil {
+		backup.Close()
+		return false, err
+	}
+	backup.done = true
+	return true, nil
+}
+
+// finish Sync the copied pages and put the backup and its schema in place. Both are written to temporary files
+// before either is renamed, so a failure leaves the destination as it was.
+func (backup *Backup) finish() error {
+	if err := backup.file.Sync(); err != nil {
+		return fmt.Errorf("Unable to write backup file: %s", err.Error())
+	}
+	if err := backup.file.Close(); err != nil {
+		return fmt.Errorf("Unable to write backup file: %s", err.Error())
+	}
+	backup.file = nil
+
+	var schemaFileName string = SchemaFileName(backup.fileName)
+	var declared bool = backup.snapshot.Schema.Declared
+	if declared {
+		if err := writeSchemaFile(backup.snapshot.Schema, schemaFileName+BackupFileSuffix); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(backup.fileName+BackupFileSuffix, backup.fileName); err != nil {
+		os.Remove(backup.fileName + BackupFileSuffix)
+		os.Remove(schemaFileName + BackupFileSuffix)
+		return fmt.Errorf("Unable to write backup file: %s", err.Error())
+	}
+	if declared {
+		if err := os.Rename(schemaFileName+BackupFileSuffix, schemaFileName); err != nil {
+			return fmt.Errorf("Unable to write schema file: %s", err.Error())
+		}
+	} else if err := os.Remove(schemaFileName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove schema file: %s", err.Error())
+	}
+	return syncDir(backup.fileName)
+}
+
+// Close Abandon the backup which is not done, the temporary file is removed
+func (backup *Backup) Close() error {
+	if backup.done || backup.file == nil {
+		return nil
+	}
+	backup.file.Close()
+	backup.file = nil
+	return os.Remove(backup.fileName + BackupFileSuffix)
+}
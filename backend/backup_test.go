@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	dbFile := "./Backup.db"
+	backupFile := "./BackupCopy.db"
+	table := OpenDB(dbFile)
+	table.Schema.TableName = "people"
+	table.Schema.Declared = true
+	insertKeys(table, 1, 40)
+	table.Version++
+
+	backup, err := NewBackup(table, backupFile)
+	if err != nil {
+		t.Fatalf("backup must begin: %v", err)
+	}
+	if done, err := backup.Step(1); done || err != nil || backup.Remaining() != backup.PageCount()-1 {
+		t.Errorf("a step must copy a page: %v %v %v", done, err, backup.Remaining())
+	}
+	if _, err := os.Stat(backupFile); !os.IsNotExist(err) {
+		t.Errorf("backup must not be in place before it is done")
+	}
+
+	// The changes after the backup began are not in the backup
+	insertKeys(table, 41, 60)
+	table.Version++
+	if done, err := backup.Step(BackupStepAll); !done || err != nil {
+		t.Errorf("backup must be done: %v %v", done, err)
+	}
+
+	copied := OpenDB(backupFile)
+	_, numCells := CountLeafCells(copied)
+	if numCells != 40 || copied.Schema.TableName != "people" {
+		t.Errorf("backup must be the table when it began: %v %v", numCells, copied.Schema.TableName)
+	}
+	CloseDB(copied)
+
+	if _, err := NewBackup(table, dbFile); err != ErrBackupSameFile {
+		t.Errorf("backup must not replace the DB file: %v", err)
+	}
+
+	// An abandoned backup leaves the destination as it was
+	backup, _ = NewBackup(table, backupFile)
+	backup.Close()
+	if _, err := os.Stat(backupFile + BackupFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("abandoned backup must be removed")
+	}
+
+	// The schema is put in place only with the backup, a destination which can not be replaced keeps no new schema
+	var dirFile string = "./BackupDir.db"
+	os.MkdirAll(dirFile+"/page", 0700)
+	backup, _ = NewBackup(table, dirFile)
+	if done, err := backup.Step(BackupStepAll); done || err == nil {
+		t.Errorf("backup must fail to replace a directory: %v %v", done, err)
+	}
+	for _, file := range []string{SchemaFileName(dirFile), dirFile + BackupFileSuffix, SchemaFileName(dirFile) + BackupFileSuffix} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%v must not be left", file)
+		}
+	}
+	os.RemoveAll(dirFile)
+
+	CloseDB(table)
+	for _, file := range []string{dbFile, backupFile} {
+		os.Remove(file)
+		os.Remove(SchemaFileName(file))
+	}
+}
@@ -0,0 +1,214 @@
+package backend
+
+import (
+	"errors"
+)
+
+// Bulk loading builds a B-tree bottom-up from rows in ascending key order, instead of inserting them one by one.
+// The rows are filled into leaves up to the fill factor as they come, and each leaf is linked to the next one.
+// When the rows end, each internal level is built from the max keys of the level below, up to the root at page 0.
+// No cell is moved and no leaf is split, so the leaves are as full as the fill factor asks, while inserting
+// ascending keys splits each full leaf in half.
+
+// DefaultFillFactor fill factor of bulk loading, ids are mostly appended in ascending order so leaves are packed full
+const DefaultFillFactor = 1.0
+
+// Errors of bulk loading
+var (
+	ErrBulkLoadOrder = errors.New("bulk load: keys are not in ascending order")
+	ErrBulkLoadFull  = errors.New("bulk load: table full")
+)
+
+// BulkLoader a B-tree being built bottom-up from the rows added in ascending key order
+type BulkLoader struct {
+	leafCells uint32 // cells of a leaf filled up to the fill factor
+	children  uint32 // children of an internal node filled up to the fill factor
+	pages     []*Page
+	leaves    []uint32 // page numbers of the leaves in key order
+	maxKeys   []uint32 // max key of each leaf
+	numRows   uint32
+}
+
+// LeafCellsOfFillFactor Get the number of cells of a leaf filled up to fillFactor, at least one
+func LeafCellsOfFillFactor(fillFactor float64) uint32 {
+	var cells uint32 = uint32(float64(LeafNodeMaxCells) * fillFactor)
+	if cells < 1 {
+		return 1
+	}
+	if cells > LeafNodeMaxCells {
+		return LeafNodeMaxCells
+	}
+	return cells
+}
+
+// internalChildrenOfFillFactor Get the number of children of an internal node filled up to fillFactor, at least three
+func internalChildrenOfFillFactor(fillFactor float64) uint32 {
+	var children uint32 = uint32(float64(InternalNodeMaxCells)*fillFactor) + 1
+	if children < 3 {
+		return 3
+	}
+	if children > InternalNodeMaxCells+1 {
+		return InternalNodeMaxCells + 1
+	}
+	return children
+}
+
+// NewBulkLoader Begin to build a B-tree whose nodes are filled up to fillFactor, 1.0 packs them full
+func NewBulkLoader(fillFactor float64) *BulkLoader {
+	var loader *BulkLoader = new(BulkLoader)
+	loader.leafCells = LeafCellsOfFillFactor(fillFactor)
+	loader.children = internalChildrenOfFillFactor(fillFactor)
+	// Page 0 is kept for the root
+	loader.pages = []*Page{new(Page)}
+	return loader
+}
+
+// internalPages Get the number of internal nodes above numLeaves leaves, the root at page 0 is not counted
+func (loader *BulkLoader) internalPages(numLeaves uint32) uint32 {
+	var pages uint32
+	for numNodes := numLeaves; numNodes > 1; {
+		numNodes = (numNodes + loader.children - 1) / loader.children
+		pages += numNodes
+	}
+	if pages > 0 {
+		pages--
+	}
+	return pages
+}
+
+// NumPages Get the number of pages of the tree built from the rows added so far
+func (loader *BulkLoader) NumPages() uint32 {
+	if len(loader.leaves) <= 1 {
+		return 1
+	}
+	return uint32(len(loader.pages)) + loader.internalPages(uint32(len(loader.leaves)))
+}
+
+// NumRows Get the number of rows added
+func (loader *BulkLoader) NumRows() uint32 {
+	return loader.numRows
+}
+
+// CanAdd Check if the tree still fits in the pages of table after numRows more rows are added
+func (loader *BulkLoader) CanAdd(numRows uint32) bool {
+	var numLeaves uint32 = uint32(len(loader.leaves))
+	var free uint32
+	if numLeaves > 0 {
+		free = loader.leafCells - *LeafNodeNumCells(loader.pages[len(loader.pages)-1].Mem[:])
+	}
+	if numRows <= free {
+		return true
+	}
+	var newLeaves uint32 = (numRows - free + loader.leafCells - 1) / loader.leafCells
+	if newLeaves > TableMaxPages {
+		return false
+	}
+	return uint32(len(loader.pages))+newLeaves+loader.internalPages(numLeaves+newLeaves) <= TableMaxPages
+}
+
+// Add Add a row, its key must be larger than the key of the row added before
+func (loader *BulkLoader) Add(row *Row) error {
+	var numLeaves int = len(loader.leaves)
+	if numLeaves > 0 && row.PrimaryID <= loader.maxKeys[numLeaves-1] {
+		return ErrBulkLoadOrder
+	}
+	if !loader.CanAdd(1) {
+		return ErrBulkLoadFull
+	}
+
+	var leaf []byte
+	if numLeaves > 0 {
+		leaf = loader.pages[loader.leaves[numLeaves-1]].Mem[:]
+	}
+	if leaf == nil || *LeafNodeNumCells(leaf) >= loader.leafCells {
+		var pageNum uint32 = uint32(len(loader.pages))
+		var page *Page = new(Page)
+		InitializeLeafNode(page.Mem[:])
+		if leaf != nil {
+			*LeafNodeNextLeaf(leaf) = pageNum
+		}
+		loader.pages = append(loader.pages, page)
+		loader.leaves = append(loader.leaves, pageNum)
+		loader.maxKeys = append(loader.maxKeys, 0)
+		leaf = page.Mem[:]
+	}
+
+	var cellNum uint32 = *LeafNodeNumCells(leaf)
+	*LeafNodeKey(leaf, cellNum) = row.PrimaryID
+	SerializeRow(row, LeafNodeValue(leaf, cellNum))
+	*LeafNodeNumCells(leaf) = cellNum + 1
+	loader.maxKeys[len(loader.maxKeys)-1] = row.PrimaryID
+	loader.numRows++
+	return nil
+}
+
+// Finish Build the internal levels above the leaves, return the pages of the tree whose root is page 0
+func (loader *BulkLoader) Finish() []*Page {
+	var pages []*Page = loader.pages
+	if len(loader.leaves) <= 1 {
+		// A single leaf is the root
+		if len(loader.leaves) == 1 {
+			pages[0] = pages[1]
+		} else {
+			InitializeLeafNode(pages[0].Mem[:])
+		}
+		SetRootNode(pages[0].Mem[:], true)
+		return pages[:1]
+	}
+
+	// The children are spread evenly over the nodes of a level, so each node has two children at least
+	var level []uint32 = loader.leaves
+	var maxKeys []uint32 = loader.maxKeys
+	var children int = int(loader.children)
+	for len(level) > 1 {
+		var numNodes int = (len(level) + children - 1) / children
+		var parents []uint32
+		var parentMaxKeys []uint32
+		for node, start := 0, 0; node < numNodes; node++ {
+			var end int = start + len(level)/numNodes
+			if node < len(level)%numNodes {
+				end++
+			}
+
+			// The root of the tree is page 0
+			var pageNum uint32 = 0
+			if numNodes > 1 {
+				pageNum = uint32(len(pages))
+				pages = append(pages, new(Page))
+			}
+			var page *Page = pages[pageNum]
+			InitializeInternalNode(page.Mem[:])
+			SetRootNode(page.Mem[:], pageNum == 0)
+			*InternalNodeNumKeys(page.Mem[:]) = uint32(end - start - 1)
+			for i := start; i < end; i++ {
+				*InternalNodeChild(page.Mem[:], uint32(i-start)) = level[i]
+				if i < end-1 {
+					*InternalNodeKey(page.Mem[:], uint32(i-start)) = maxKeys[i]
+				}
+				*ParentNode(pages[level[i]].Mem[:]) = pageNum
+			}
+			parents = append(parents, pageNum)
+			parentMaxKeys = append(parentMaxKeys, maxKeys[end-1])
+			start = end
+		}
+		level, maxKeys = parents, parentMaxKeys
+	}
+	return pages
+}
+
+// BulkLoad Replace the B-tree of table with the tree built by loader, the caller holds the write lock of table.
+// The pages are changed in the page cache like inserts. The pages after the new tree are dropped, so the table
+// has only the pages of the tree, and the DB file is truncated to them by the next flush.
+func BulkLoad(table *Table, loader *BulkLoader) {
+	var pages []*Page = loader.Finish()
+	var pager *Pager = table.Pager
+	for i := uint32(0); i < TableMaxPages; i++ {
+		if i < uint32(len(pages)) {
+			setPage(pager, i, pages[i])
+		} else if pager.Pages[i] != nil {
+			setPage(pager, i, nil)
+		}
+	}
+	pager.NumPages = uint32(len(pages))
+	table.RootPageNum = 0
+}
@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBulkLoader(t *testing.T) {
+	// Rows are packed into full leaves under a single root until the pages of table are used up
+	var loader *BulkLoader = NewBulkLoader(DefaultFillFactor)
+	var key uint32
+	for key = 1; ; key++ {
+		if err := loader.Add(&Row{PrimaryID: key}); err != nil {
+			if err != ErrBulkLoadFull {
+				t.Fatalf("the error must be table full: %v", err)
+			}
+			break
+		}
+	}
+	if loader.NumRows() != (TableMaxPages-1)*LeafNodeMaxCells || loader.NumPages() != TableMaxPages {
+		t.Errorf("the leaves must be full: %v rows of %v pages", loader.NumRows(), loader.NumPages())
+	}
+	if loader.CanAdd(1) {
+		t.Errorf("no more rows can be added")
+	}
+
+	loader = NewBulkLoader(DefaultFillFactor)
+	loader.Add(&Row{PrimaryID: 2})
+	if err := loader.Add(&Row{PrimaryID: 2}); err != ErrBulkLoadOrder {
+		t.Errorf("the keys must be ascending: %v", err)
+	}
+	if err := loader.Add(&Row{PrimaryID: 1}); err != ErrBulkLoadOrder {
+		t.Errorf("the keys must be ascending: %v", err)
+	}
+	if pages := loader.Finish(); len(pages) != 1 || !IsRootNode(pages[0].Mem[:]) || *LeafNodeNumCells(pages[0].Mem[:]) != 1 {
+		t.Errorf("a single leaf must be the root")
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	dbFile := "./BulkLoad.db"
+	var keys []uint32
+	for i := uint32(1); i <= 120; i++ {
+		keys = append(keys, 121-i)
+	}
+	table := openTableWithKeys(dbFile, keys)
+	var numPages uint32 = table.Pager.NumPages
+
+	// Full leaves, the pages after the new tree are dropped and cut off the DB file by the flush
+	var loader *BulkLoader = NewBulkLoader(DefaultFillFactor)
+	for key := uint32(1); key <= 120; key++ {
+		loader.Add(&Row{PrimaryID: key})
+	}
+	BulkLoad(table, loader)
+	leafPages, numCells := CountLeafCells(table)
+	if leafPages != (120+LeafNodeMaxCells-1)/LeafNodeMaxCells || numCells != 120 || table.Pager.NumPages != leafPages+1 {
+		t.Errorf("leaves must be full: %v leaves of %v cells in %v pages", leafPages, numCells, table.Pager.NumPages)
+	}
+	if table.Pager.NumPages >= numPages {
+		t.Errorf("the pages after the tree must be dropped: %v of %v pages", table.Pager.NumPages, numPages)
+	}
+	checkKeys(t, table, 120)
+	if err := FlushPager(table.Pager, false); err != nil || table.Pager.FileLength != int64(leafPages+1)*PageSize {
+		t.Errorf("the DB file must be truncated to the tree: %v %v", table.Pager.FileLength, err)
+	}
+	insertKeys(table, 121, 140)
+	checkKeys(t, table, 140)
+
+	// Half filled leaves
+	loader = NewBulkLoader(0.5)
+	for key := uint32(1); key <= 120; key++ {
+		loader.Add(&Row{PrimaryID: key})
+	}
+	BulkLoad(table, loader)
+	leafPages, _ = CountLeafCells(table)
+	var leafCells uint32 = LeafCellsOfFillFactor(0.5)
+	if leafPages != (120+leafCells-1)/leafCells {
+		t.Errorf("leaves must be half filled: %v leaves", leafPages)
+	}
+	checkKeys(t, table, 120)
+
+	// A deep tree with the least children of each internal node
+	loader = NewBulkLoader(0)
+	for key := uint32(1); key <= 40; key++ {
+		loader.Add(&Row{PrimaryID: key})
+	}
+	BulkLoad(table, loader)
+	checkKeys(t, table, 40)
+
+	// The pages dropped by bulk load in a transaction are dropped from the table by commit
+	var transaction *Transaction = BeginTransaction(table)
+	loader = NewBulkLoader(DefaultFillFactor)
+	for key := uint32(1); key <= 40; key++ {
+		loader.Add(&Row{PrimaryID: key})
+	}
+	BulkLoad(transaction.Table, loader)
+	if !CommitTransaction(table, transaction) || table.Pager.NumPages != loader.NumPages() || table.Pager.Pages[loader.NumPages()] != nil {
+		t.Errorf("the table must have only the pages of the tree: %v pages", table.Pager.NumPages)
+	}
+	checkKeys(t, table, 40)
+
+	CloseDB(table)
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 40)
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+// Both benchmarks build a tree of the same rows in the private copy of an empty table, so no file is written
+func BenchmarkBulkLoad(b *testing.B) {
+	dbFile := "./BenchmarkBulkLoad.db"
+	table := OpenDB(dbFile)
+	for i := 0; i < b.N; i++ {
+		var loader *BulkLoader = NewBulkLoader(DefaultFillFactor)
+		for key := uint32(1); key <= 600; key++ {
+			loader.Add(&Row{PrimaryID: key})
+		}
+		BulkLoad(BeginTransaction(table).Table, loader)
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func BenchmarkInsertLeafNode(b *testing.B) {
+	dbFile := "./BenchmarkInsertLeafNode.db"
+	table := OpenDB(dbFile)
+	for i := 0; i < b.N; i++ {
+		insertKeys(BeginTransaction(table).Table, 1, 600)
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
@@ -0,0 +1,157 @@
+package backend
+
+// Range scans and reverse iteration. Leaf nodes only have the link to the next leaf,
+// so the previous leaf is found by descending from the root and remembering the path (a parent stack),
+// then going to the left sibling subtree of the deepest ancestor which has one.
+
+// CursorKey Get the key of row which cursor point to
+func CursorKey(cursor *Cursor) uint32 {
+	var page *Page = GetPage(cursor.TablePtr.Pager, cursor.PageNum)
+	return *LeafNodeKey(page.Mem[:], cursor.CellNum)
+}
+
+// checkCursorBounds Stop the cursor if it moves out of its bounds
+func checkCursorBounds(cursor *Cursor) {
+	if cursor.IsEndOfTable {
+		return
+	}
+
+	var key uint32 = CursorKey(cursor)
+	if cursor.HasUpperBound && key > cursor.UpperBound {
+		cursor.IsEndOfTable = true
+	}
+	if cursor.HasLowerBound && key < cursor.LowerBound {
+		cursor.IsEndOfTable = true
+	}
+}
+
+// SeekGE create a cursor point to the first row whose key is greater than or equal to the key
+func SeekGE(table *Table, key uint32) *Cursor {
+	var cursor *Cursor = Find(table, key)
+	var page *Page = GetPage(table.Pager, cursor.PageNum)
+	if cursor.CellNum >= *LeafNodeNumCells(page.Mem[:]) {
+		// All keys of the leaf are less than key, the first row of next leaf is the answer
+		var nextLeafPageNum uint32 = *LeafNodeNextLeaf(page.Mem[:])
+		if nextLeafPageNum == 0 {
+			cursor.IsEndOfTable = true
+		} else {
+			cursor.PageNum = nextLeafPageNum
+			cursor.CellNum = 0
+		}
+	}
+	return cursor
+}
+
+// SeekLE create a cursor point to the last row whose key is less than or equal to the key
+func SeekLE(table *Table, key uint32) *Cursor {
+	var cursor *Cursor = Find(table, key)
+	var page *Page = GetPage(table.Pager, cursor.PageNum)
+	if cursor.CellNum < *LeafNodeNumCells(page.Mem[:]) && *LeafNodeKey(page.Mem[:], cursor.CellNum) == key {
+		return cursor
+	}
+
+	// The cell of Find is the insert position, the row before it is the answer
+	CursorPrev(cursor)
+	cursor.PassedCells = 0
+	return cursor
+}
+
+// CursorRange create a cursor iterate the rows whose key in [lowerKey, upperKey] with CursorNext
+func CursorRange(table *Table, lowerKey uint32, upperKey uint32) *Cursor {
+	var cursor *Cursor = SeekGE(table, lowerKey)
+	cursor.HasUpperBound = true
+	cursor.UpperBound = upperKey
+	checkCursorBounds(cursor)
+	return cursor
+}
+
+// CursorReverseRange create a cursor iterate the rows whose key in [lowerKey, upperKey] in descending order with CursorPrev
+func CursorReverseRange(table *Table, lowerKey uint32, upperKey uint32) *Cursor {
+	var cursor *Cursor = SeekLE(table, upperKey)
+	cursor.HasLowerBound = true
+	cursor.LowerBound = lowerKey
+	checkCursorBounds(cursor)
+	return cursor
+}
+
+// CursorLast create a cursor point to the last row of the table
+func CursorLast(table *Table) *Cursor {
+	var cursor *Cursor = new(Cursor)
+	cursor.TablePtr = table
+	cursor.PageNum = rightmostLeaf(table.Pager, table.RootPageNum)
+
+	var page *Page = GetPage(table.Pager, cursor.PageNum)
+	var numCells uint32 = *LeafNodeNumCells(page.Mem[:])
+	if numCells == 0 {
+		cursor.IsEndOfTable = true
+	} else {
+		cursor.CellNum = numCells - 1
+	}
+	return cursor
+}
+
+// rightmostLeaf Descend along the right child pointers to the rightmost leaf of the subtree
+func rightmostLeaf(pager *Pager, pageNum uint32) uint32 {
+	var page *Page = GetPage(pager, pageNum)
+	for GetNodeType(page.Mem[:]) == TypeInternalNode {
+		pageNum = *internalNodeRightChildPtr(page.Mem[:])
+		page = GetPage(pager, pageNum)
+	}
+	return pageNum
+}
+
+// prevLeaf Get the leaf on the left of the leaf, return false if it is the leftmost leaf
+func prevLeaf(table *Table, leafPageNum uint32) (uint32, bool) {
+	var leafPage *Page = GetPage(table.Pager, leafPageNum)
+	if *LeafNodeNumCells(leafPage.Mem[:]) == 0 {
+		return 0, false
+	}
+	var firstKey uint32 = *LeafNodeKey(leafPage.Mem[:], 0)
+
+	// Descend from root to the leaf, the parent stack records the child index taken at every internal node
+	type pathEntry struct {
+		pageNum    uint32
+		childIndex uint32
+	}
+	var stack []pathEntry
+	var pageNum uint32 = table.RootPageNum
+	var page *Page = GetPage(table.Pager, pageNum)
+	for GetNodeType(page.Mem[:]) == TypeInternalNode {
+		var childIndex uint32 = findInternalNodeChild(page.Mem[:], firstKey)
+		stack = append(stack, pathEntry{pageNum: pageNum, childIndex: childIndex})
+		pageNum = *InternalNodeChild(page.Mem[:], childIndex)
+		page = GetPage(table.Pager, pageNum)
+	}
+
+	// The deepest ancestor with a left sibling subtree, the previous leaf is the rightmost leaf of that subtree
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].childIndex > 0 {
+			var parentPage *Page = GetPage(table.Pager, stack[i].pageNum)
+			var siblingPageNum uint32 = *InternalNodeChild(parentPage.Mem[:], stack[i].childIndex-1)
+			return rightmostLeaf(table.Pager, siblingPageNum), true
+		}
+	}
+	return 0, false
+}
+
+// CursorPrev previous cursor
+func CursorPrev(cursor *Cursor) {
+	cursor.PassedCells++
+	if cursor.CellNum > 0 {
+		cursor.CellNum--
+		checkCursorBounds(cursor)
+		return
+	}
+
+	prevPageNum, ok := prevLeaf(cursor.TablePtr, cursor.PageNum)
+	if !ok {
+		// Leftmost leaf node, moved before the first row
+		cursor.IsEndOfTable = true
+		return
+	}
+
+	var page *Page = GetPage(cursor.TablePtr.Pager, prevPageNum)
+	cursor.PageNum = prevPageNum
+	cursor.CellNum = *LeafNodeNumCells(page.Mem[:]) - 1
+	checkCursorBounds(cursor)
+}
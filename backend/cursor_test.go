@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func openTableWithKeys(dbFile string, keys []uint32) *Table {
+	table := OpenDB(dbFile)
+	for _, key := range keys {
+		var row Row
+		row.PrimaryID = key
+		InsertLeafNode(Find(table, key), key, &row)
+	}
+	return table
+}
+
+func TestSeek(t *testing.T) {
+	dbFile := "./Seek.db"
+	var keys []uint32
+	for i := uint32(1); i <= 60; i++ {
+		keys = append(keys, i*2)
+	}
+	table := openTableWithKeys(dbFile, keys)
+
+	if TreeDepth(table) != 2 {
+		t.Errorf("tree depth must be 2 to seek across leaves")
+	}
+
+	cases := []struct {
+		key     uint32
+		ge      uint32
+		le      uint32
+		geIsEnd bool
+		leIsEnd bool
+	}{
+		{0, 2, 0, false, true},
+		{2, 2, 2, false, false},
+		{27, 28, 26, false, false},
+		{120, 120, 120, false, false},
+		{121, 0, 120, true, false},
+	}
+	for _, c := range cases {
+		ge := SeekGE(table, c.key)
+		if ge.IsEndOfTable != c.geIsEnd || (!c.geIsEnd && CursorKey(ge) != c.ge) {
+			t.Errorf("SeekGE(%v) is wrong", c.key)
+		}
+
+		le := SeekLE(table, c.key)
+		if le.IsEndOfTable != c.leIsEnd || (!c.leIsEnd && CursorKey(le) != c.le) {
+			t.Errorf("SeekLE(%v) is wrong", c.key)
+		}
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestRangeAndReverse(t *testing.T) {
+	dbFile := "./RangeAndReverse.db"
+	var keys []uint32
+	for i := uint32(100); i > 0; i-- {
+		keys = append(keys, i)
+	}
+	table := openTableWithKeys(dbFile, keys)
+
+	var scanned []uint32
+	for cursor := CursorRange(table, 10, 40); !cursor.IsEndOfTable; CursorNext(cursor) {
+		scanned = append(scanned, CursorKey(cursor))
+	}
+	if len(scanned) != 31 || scanned[0] != 10 || scanned[30] != 40 {
+		t.Errorf("range scan is wrong: %v", scanned)
+	}
+
+	var expected uint32 = 100
+	for cursor := CursorLast(table); !cursor.IsEndOfTable; CursorPrev(cursor) {
+		if CursorKey(cursor) != expected {
+			t.Errorf("reverse scan key must be %v, but it is %v", expected, CursorKey(cursor))
+		}
+		expected--
+	}
+	if expected != 0 {
+		t.Errorf("reverse scan must visit all rows, stopped at %v", expected)
+	}
+
+	scanned = nil
+	for cursor := CursorReverseRange(table, 50, 70); !cursor.IsEndOfTable; CursorPrev(cursor) {
+		scanned = append(scanned, CursorKey(cursor))
+	}
+	if len(scanned) != 21 || scanned[0] != 70 || scanned[20] != 50 {
+		t.Errorf("reverse range scan is wrong: %v", scanned)
+	}
+
+	if !CursorRange(table, 200, 300).IsEndOfTable {
+		t.Errorf("range out of table must be empty")
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+
+	table = OpenDB(dbFile)
+	if !CursorLast(table).IsEndOfTable {
+		t.Errorf("last cursor of empty table must be end of table")
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestCursorEnd(t *testing.T) {
+	dbFile := "./CursorEnd.db"
+	table := OpenDB(dbFile)
+	insertKeys(table, 1, 100)
+
+	// The end found by descending is where a scan stops
+	var scanned *Cursor = CursorBegin(table)
+	for !scanned.IsEndOfTable {
+		CursorNext(scanned)
+	}
+	var end *Cursor = CursorEnd(table)
+	if !end.IsEndOfTable || end.PageNum != scanned.PageNum || end.CellNum != scanned.CellNum {
+		t.Errorf("end must be page %v cell %v, but it is page %v cell %v", scanned.PageNum, scanned.CellNum, end.PageNum, end.CellNum)
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+}
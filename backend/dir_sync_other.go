@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package backend
+
+// syncDir A directory can not be synced on the platform, the renames and removes in it are left to the file system
+func syncDir(fileName string) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// syncDir Sync the directory of file to disk, so the files renamed or removed in it stay so after a crash
+func syncDir(fileName string) error {
+	dir, err := os.Open(filepath.Dir(fileName))
+	if err != nil {
+		return fmt.Errorf("Unable to sync directory: %s", err.Error())
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("Unable to sync directory: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package backend
+
+import "fmt"
+
+// The B-tree functions have no error result. An I/O error or a corrupt page they meet is raised as Error by panic,
+// the entries of the embeddable API recover it and return it as an error, and the REPL prints it and exits.
+
+// Error an error met by the backend functions which can not return it
+type Error struct {
+	Err error
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap Get the error raised
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// raise Raise the error by panic, it is recovered by the caller of backend
+func raise(format string, args ...interface{}) {
+	panic(&Error{Err: fmt.Errorf(format, args...)})
+}
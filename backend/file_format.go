@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The DB file has no header page, page 0 is the root of the B-tree. The format of the file is kept in the last bytes
+// of page 0 instead, which no node uses: a leaf has space left after its cells, and an internal node keeps them out
+// of its cells. Each write of page 0 stamps the format, and a file without it is refused on open, since the files
+// written before the format was stamped have rows without the null bitmap and would be read misaligned.
+const (
+	FileFormatMagic   = "tRDB"
+	FileFormatVersion = 1 // 1: rows of 296 bytes with the null bitmap
+	FileFormatSize    = 8 // magic and version
+	FileFormatOffset  = PageSize - FileFormatSize
+)
+
+// ErrFileFormat the DB file is not written in the format of this version
+var ErrFileFormat = errors.New("DB file is not in the format of this version")
+
+// stampFileFormat Write the format to page 0
+func stampFileFormat(page *Page) {
+	copy(page.Mem[FileFormatOffset:], FileFormatMagic)
+	binary.LittleEndian.PutUint32(page.Mem[FileFormatOffset+len(FileFormatMagic):], FileFormatVersion)
+}
+
+// checkFileFormat Check the format stamped in page 0 of the DB file, an empty file is a new one
+func checkFileFormat(file *os.File, fileLength int64) error {
+	if fileLength == 0 {
+		return nil
+	}
+	var format [FileFormatSize]byte
+	if _, err := file.ReadAt(format[:], FileFormatOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("Unable to read DB file: %s", err.Error())
+	}
+	if string(format[:len(FileFormatMagic)]) != FileFormatMagic {
+		return fmt.Errorf("%w: no format version, it was written by an older version with rows of %v bytes",
+			ErrFileFormat, RowSize-NullBitmapSize)
+	}
+	if version := binary.LittleEndian.Uint32(format[len(FileFormatMagic):]); version != FileFormatVersion {
+		return fmt.Errorf("%w: format version %v, this version reads %v", ErrFileFormat, version, FileFormatVersion)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// The DB file is locked while it is opened, because each process keeps its own page cache.
+// Readers share the file with SHARED lock, a writer holds EXCLUSIVE lock and excludes the others.
+// The lock is taken by open and released by close, so a writer excludes the other processes for its whole session,
+// not only while it commits. An open waits for the lock until busy timeout, then it fails with ErrLocked.
+// The lock is flock(2) on linux and the BSDs, the other platforms are not locked.
+const (
+	busyRetryInterval = 10 * time.Millisecond
+)
+
+// ErrLocked the DB file is locked by another connection or process
+var ErrLocked = errors.New("database is locked")
+
+// lockFile Take the advisory lock of DB file, retry until busy timeout
+func lockFile(file *os.File, exclusive bool, busyTimeout time.Duration) error {
+	var deadline time.Time = time.Now().Add(busyTimeout)
+	for {
+		locked, err := tryLockFile(file, exclusive)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(busyRetryInterval)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package backend
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+var lockWarning sync.Once
+
+// tryLockFile Advisory locks are not supported on this platform, the file is not locked and a warning is logged
+// once, so the processes opening the same DB file are not excluded from each other
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	lockWarning.Do(func() {
+		log.Printf("Warning: DB file is not locked, locking is not supported on this platform")
+	})
+	return true, nil
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package backend
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile Try to take the advisory lock of DB file without blocking, return false if the lock is held by others
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	var how int = syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
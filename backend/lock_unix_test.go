@@ -0,0 +1,58 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package backend
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	dbFile := "./Lock.db"
+	writer, err := Open(dbFile)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	// The lock of file is held by the open file, so the same process conflicts with itself too
+	var start time.Time = time.Now()
+	if _, err := OpenWithOptions(dbFile, &OpenOptions{BusyTimeout: 50 * time.Millisecond}); err != ErrLocked {
+		t.Errorf("second writer must be locked: %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("open must wait for busy timeout")
+	}
+	if _, err := OpenWithOptions(dbFile, &OpenOptions{ReadOnly: true}); err != ErrLocked {
+		t.Errorf("reader must be locked by writer: %v", err)
+	}
+	CloseDB(writer)
+
+	reader1, err := OpenWithOptions(dbFile, &OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("reader must be success: %v", err)
+	}
+	reader2, err := OpenWithOptions(dbFile, &OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("readers must share the file: %v", err)
+	}
+	if _, err := Open(dbFile); err != ErrLocked {
+		t.Errorf("writer must be locked by readers: %v", err)
+	}
+
+	// Writer waits until the readers close
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		CloseDB(reader1)
+		CloseDB(reader2)
+	}()
+	writer, err = OpenWithOptions(dbFile, &OpenOptions{BusyTimeout: time.Second})
+	if err != nil {
+		t.Errorf("writer must get the lock after readers close: %v", err)
+	} else {
+		CloseDB(writer)
+	}
+
+	os.Remove(dbFile)
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The pager marks a page dirty when it is handed out for writing, and only the dirty pages are written.
+// They are written in the order of page number and synced to disk once, by commit and close, and under
+// SynchronousFull by each statement out of transactions too.
+// How often the pages are synced is set by the synchronous level.
+
+// Synchronous when the pages written to the DB file are synced to disk, like PRAGMA synchronous of SQLite
+type Synchronous = uint8
+
+// Synchronous levels, the zero value is the safest
+const (
+	SynchronousFull   = iota // Sync once by each commit, statement out of transactions and close, they survive power loss
+	SynchronousNormal = iota // Sync by close only, a crash of OS may lose the transactions committed since open
+	SynchronousOff    = iota // Never sync, the OS writes the pages when it likes
+)
+
+// synchronousNames names of the synchronous levels
+var synchronousNames = []string{"full", "normal", "off"}
+
+// ParseSynchronous Get the synchronous level by its name
+func ParseSynchronous(name string) (Synchronous, bool) {
+	for level, levelName := range synchronousNames {
+		if strings.EqualFold(name, levelName) {
+			return Synchronous(level), true
+		}
+	}
+	return SynchronousFull, false
+}
+
+// SynchronousName Get the name of the synchronous level
+func SynchronousName(level Synchronous) string {
+	if int(level) < len(synchronousNames) {
+		return synchronousNames[level]
+	}
+	return "unknown"
+}
+
+// syncPager Sync the pages written to the DB file to disk
+func syncPager(pager *Pager) error {
+	pager.syncs++
+	return pager.FilePtr.Sync()
+}
+
+// FlushPager Write the changed pages to the DB file in the order of page number and truncate it to the pages of
+// table, then sync them once by the synchronous level. closing is true for the flush of Close.
+// The caller holds the write lock of table, so the old mappings of DB file are released by it.
+func FlushPager(pager *Pager, closing bool) error {
+	for i := uint32(0); i < pager.NumPages; i++ {
+		if pager.dirty[i] && pager.Pages[i] != nil {
+			if err := FlushPage(pager, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The pages dropped by bulk load are cut off the DB file
+	if length := int64(pager.NumPages) * PageSize; pager.FileLength > length {
+		if err := pager.FilePtr.Truncate(length); err != nil {
+			return fmt.Errorf("Error truncating DB file: %s", err.Error())
+		}
+		pager.FileLength = length
+	}
+	releaseMappings(pager)
+
+	if pager.Synchronous == SynchronousOff || (pager.Synchronous == SynchronousNormal && !closing) {
+		return nil
+	}
+	if err := syncPager(pager); err != nil {
+		return fmt.Errorf("Error syncing DB file: %s", err.Error())
+	}
+	return nil
+}
+
+// FlushStatement Write the pages changed by a statement out of transactions and sync them under SynchronousFull,
+// so the statement is durable once it returns like a committed transaction. Under the other levels they are written
+// by the next commit or close. The private copy of a transaction has no DB file, it is written by the commit.
+// The caller holds the write lock of table.
+func FlushStatement(table *Table) error {
+	if table.ReadOnly || table.Pager.FilePtr == nil || table.Pager.Synchronous != SynchronousFull {
+		return nil
+	}
+	return FlushPager(table.Pager, false)
+}
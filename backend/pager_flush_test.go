@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFlushPager(t *testing.T) {
+	dbFile := "./FlushPager.db"
+	table := OpenDB(dbFile)
+	insertKeys(table, 1, 100)
+	CloseDB(table)
+
+	// The pages read and not changed are not written
+	table = OpenDB(dbFile)
+	var pager *Pager = table.Pager
+	checkKeys(t, table, 100)
+	FlushPager(pager, false)
+	if pager.writes != 0 || pager.syncs != 1 {
+		t.Errorf("no page must be written: %v writes %v syncs", pager.writes, pager.syncs)
+	}
+
+	// A commit writes the changed pages with a single sync
+	var transaction *Transaction = BeginTransaction(table)
+	insertKeys(transaction.Table, 101, 125)
+	var changed uint32
+	for i := uint32(0); i < transaction.Table.Pager.NumPages; i++ {
+		if pageChanged(transaction.Base.Pager, transaction.Table.Pager, i) {
+			changed++
+		}
+	}
+	if !CommitTransaction(table, transaction) {
+		t.Fatalf("commit must succeed")
+	}
+	if pager.writes != uint64(changed) || pager.syncs != 2 {
+		t.Errorf("%v changed pages must be written by one sync: %v writes %v syncs", changed, pager.writes, pager.syncs)
+	}
+
+	// A page is dirty once it is handed out for writing, even if it is not changed, and the read pages are not
+	GetPage(pager, 1)
+	GetPageForWrite(pager, 2)
+	FlushPager(pager, false)
+	if pager.writes != uint64(changed)+1 || pager.syncs != 3 {
+		t.Errorf("only the page for writing must be written: %v writes %v syncs", pager.writes, pager.syncs)
+	}
+	changed++
+
+	// A statement out of transactions is written and synced by itself under FULL, in a transaction it is not
+	transaction = BeginTransaction(table)
+	insertKeys(transaction.Table, 126, 126)
+	if FlushStatement(transaction.Table); pager.writes != uint64(changed) || pager.syncs != 3 {
+		t.Errorf("the statement in a transaction must not be written: %v writes %v syncs", pager.writes, pager.syncs)
+	}
+	insertKeys(table, 126, 126)
+	if err := FlushStatement(table); err != nil || pager.writes != uint64(changed)+1 || pager.syncs != 4 {
+		t.Errorf("the statement must be written and synced: %v writes %v syncs %v", pager.writes, pager.syncs, err)
+	}
+	changed++
+
+	// NORMAL syncs by close only, OFF never syncs
+	pager.Synchronous = SynchronousNormal
+	insertKeys(table, 127, 127)
+	if FlushStatement(table); pager.writes != uint64(changed) {
+		t.Errorf("the statement must be left to close under NORMAL: %v writes", pager.writes)
+	}
+	FlushPager(pager, false)
+	if pager.writes != uint64(changed)+1 || pager.syncs != 4 {
+		t.Errorf("the page must be written without sync: %v writes %v syncs", pager.writes, pager.syncs)
+	}
+	FlushPager(pager, true)
+	if pager.syncs != 5 {
+		t.Errorf("close must sync: %v syncs", pager.syncs)
+	}
+	pager.Synchronous = SynchronousOff
+	FlushPager(pager, true)
+	if pager.syncs != 5 {
+		t.Errorf("off must never sync: %v syncs", pager.syncs)
+	}
+	CloseDB(table)
+
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 127)
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestParseSynchronous(t *testing.T) {
+	for _, name := range []string{"off", "NORMAL", "Full"} {
+		level, ok := ParseSynchronous(name)
+		if !ok || SynchronousName(level) != map[string]string{"off": "off", "NORMAL": "normal", "Full": "full"}[name] {
+			t.Errorf("%v must be parsed: %v %v", name, level, ok)
+		}
+	}
+	if _, ok := ParseSynchronous("extra"); ok {
+		t.Errorf("unknown level must not be parsed")
+	}
+}
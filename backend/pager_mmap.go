@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// With memory-mapped I/O the DB file is mapped in memory, and the pages in the file are read straight from the mapping
+// instead of a seek and read into a new page for each miss. The mapping is read-only: a writer copies a mapped page
+// to memory by GetPageForWrite before it changes it, and the changed pages are written by file I/O like the file pager,
+// so a page is never half changed in the file before it is flushed. The file is remapped once it grows past the mapping.
+// Nothing is written through the mapping, so there is no msync: the written pages are synced by fsync of the file
+// at the synchronous level, the same way as the file pager.
+//
+// Snapshots are read without the lock of table while the flush writes the file, so they get copies of the mapped
+// pages (see shareTable) and only the table reads the mapping. The mappings replaced by remapping are kept while
+// the cached pages may refer them, and released by the next flush.
+
+// ErrMmapUnsupported memory-mapped I/O is not supported on the platform
+var ErrMmapUnsupported = errors.New("memory-mapped I/O is not supported on this platform")
+
+// remapPager Map the whole DB file if it grows past the mapping
+func remapPager(pager *Pager) error {
+	if pager.FileLength <= int64(len(pager.mapping)) {
+		return nil
+	}
+	mapping, err := mapFile(pager.FilePtr, int(pager.FileLength))
+	if err != nil {
+		return fmt.Errorf("Unable to map DB file: %s", err.Error())
+	}
+	if pager.mapping != nil {
+		pager.oldMappings = append(pager.oldMappings, pager.mapping)
+	}
+	pager.mapping = mapping
+	return nil
+}
+
+// mappedPage Get the page from the mapping, nil if the page is not in the DB file. A failed remapping is raised as Error.
+func mappedPage(pager *Pager, pageNum uint32) *Page {
+	var offset int64 = int64(pageNum) * PageSize
+	if !pager.MemoryMapped || offset+PageSize > pager.FileLength {
+		return nil
+	}
+	if err := remapPager(pager); err != nil {
+		panic(&Error{Err: err})
+	}
+	return (*Page)(unsafe.Pointer(&pager.mapping[offset]))
+}
+
+// isMappedPage Check if the page is the one in a mapping of the DB file, the mapping is not extended
+func isMappedPage(pager *Pager, pageNum uint32, page *Page) bool {
+	var offset int64 = int64(pageNum) * PageSize
+	for _, mapping := range append(pager.oldMappings, pager.mapping) {
+		if offset+PageSize <= int64(len(mapping)) && page == (*Page)(unsafe.Pointer(&mapping[offset])) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseMappings Unmap the mappings replaced by remapping. The cached pages in them are pointed to the same pages
+// in the current mapping, which is larger, the caller holds the write lock of table so no reader is using them.
+// Snapshots never refer a mapping, shareTable gives them copies of the mapped pages.
+func releaseMappings(pager *Pager) {
+	if len(pager.oldMappings) == 0 {
+		return
+	}
+	pager.CacheLock.Lock()
+	defer pager.CacheLock.Unlock()
+	for i, page := range pager.Pages {
+		if page != nil && isMappedPage(pager, uint32(i), page) {
+			pager.Pages[i] = (*Page)(unsafe.Pointer(&pager.mapping[int64(i)*PageSize]))
+		}
+	}
+	for _, mapping := range pager.oldMappings {
+		unmapFile(mapping)
+	}
+	pager.oldMappings = nil
+}
+
+// unmapPager Unmap all mappings of the DB file, the pages in them must not be used after it
+func unmapPager(pager *Pager) {
+	for _, mapping := range append(pager.oldMappings, pager.mapping) {
+		if mapping != nil {
+			unmapFile(mapping)
+		}
+	}
+	pager.mapping = nil
+	pager.oldMappings = nil
+}
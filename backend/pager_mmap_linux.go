@@ -0,0 +1,22 @@
+//go:build linux
+// +build linux
+
+package backend
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapSupported memory-mapped I/O can be used on the platform
+const mmapSupported = true
+
+// mapFile Map length bytes of the DB file read-only, the mapping is shared with the file so it sees the pages written
+func mapFile(file *os.File, length int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, length, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile Unmap the mapping of DB file
+func unmapFile(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
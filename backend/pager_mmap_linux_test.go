@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestMemoryMappedPager(t *testing.T) {
+	dbFile := "./MemoryMapped.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2, 3})
+	CloseDB(table)
+
+	table, err := OpenWithOptions(dbFile, &OpenOptions{MemoryMapped: true})
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+	var pager *Pager = table.Pager
+	if GetPage(pager, 0) != (*Page)(unsafe.Pointer(&pager.mapping[0])) {
+		t.Errorf("the page in the file must be read from the mapping")
+	}
+
+	// The mapping is read-only, the page is copied before it is changed and the file is changed only by the flush
+	insertKeys(table, 4, 4)
+	if isMappedPage(pager, 0, pager.Pages[0]) || *LeafNodeNumCells(pager.mapping[:PageSize]) != 3 {
+		t.Errorf("the mapped page must be copied before it is changed")
+	}
+	if err := FlushPager(pager, false); err != nil || *LeafNodeNumCells(pager.mapping[:PageSize]) != 4 {
+		t.Errorf("the changed page must be written to the file: %v", err)
+	}
+
+	// The new pages are written by file I/O, then the grown file is remapped by the next miss
+	insertKeys(table, 5, 100)
+	var numPages uint32 = pager.NumPages
+	for i := uint32(0); i < numPages; i++ {
+		FlushPage(pager, i)
+	}
+	if pager.FileLength != int64(numPages)*PageSize {
+		t.Errorf("file length must grow to the pages: %v", pager.FileLength)
+	}
+	pager.Pages[numPages-1] = nil
+	if GetPage(pager, numPages-1) != (*Page)(unsafe.Pointer(&pager.mapping[(numPages-1)*PageSize])) || len(pager.oldMappings) != 1 {
+		t.Errorf("the grown file must be remapped")
+	}
+	checkKeys(t, table, 100)
+
+	// The old mapping is released by the flush, the cached pages in it are moved to the current mapping
+	pager.Pages[0] = (*Page)(unsafe.Pointer(&pager.oldMappings[0][0]))
+	if err := FlushPager(pager, false); err != nil || len(pager.oldMappings) != 0 {
+		t.Errorf("the old mapping must be released: %v", err)
+	}
+	if pager.Pages[0] != (*Page)(unsafe.Pointer(&pager.mapping[0])) {
+		t.Errorf("the cached page must be in the current mapping")
+	}
+	checkKeys(t, table, 100)
+	CloseDB(table)
+
+	// Both pagers read the same file
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 100)
+	CloseDB(table)
+	table, err = OpenWithOptions(dbFile, &OpenOptions{ReadOnly: true, MemoryMapped: true})
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+	checkKeys(t, table, 100)
+	CloseDB(table)
+
+	// Vacuum shrinks the file under the mapping
+	table, _ = OpenWithOptions(dbFile, &OpenOptions{MemoryMapped: true})
+	if err := Vacuum(table, VacuumFillFactor); err != nil {
+		t.Fatalf("vacuum must succeed: %v", err)
+	}
+	insertKeys(table, 101, 130)
+	checkKeys(t, table, 130)
+	CloseDB(table)
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 130)
+	CloseDB(table)
+
+	// A select reads the snapshot, it gets copies of the mapped pages while the table keeps reading the mapping
+	table, _ = OpenWithOptions(dbFile, &OpenOptions{MemoryMapped: true})
+	pager = table.Pager
+	var snapshot *Table = Snapshot(table)
+	for i := uint32(0); i < pager.NumPages; i++ {
+		if !isMappedPage(pager, i, pager.Pages[i]) || isMappedPage(pager, i, snapshot.Pager.Pages[i]) {
+			t.Errorf("page %v must still be served from the mapping after a snapshot", i)
+		}
+	}
+
+	// The copies are shared by the next snapshot, and the commit takes them for the mapped pages they are copied from
+	var transaction *Transaction = BeginTransaction(table)
+	insertKeys(transaction.Table, 131, 131)
+	table.Version++
+	if Snapshot(table).Pager.Pages[0] != snapshot.Pager.Pages[0] {
+		t.Errorf("the copy of the unchanged mapped page must be shared by the next snapshot")
+	}
+	if !CommitTransaction(table, transaction) {
+		t.Errorf("the transaction must not conflict with the unchanged mapped pages")
+	}
+	if err := FlushPager(pager, false); err != nil {
+		t.Errorf("flush must be success: %v", err)
+	}
+	checkKeys(t, snapshot, 130)
+	checkKeys(t, table, 131)
+	CloseDB(table)
+	os.Remove(dbFile)
+}
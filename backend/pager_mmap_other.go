@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package backend
+
+import (
+	"os"
+)
+
+// mmapSupported memory-mapped I/O can be used on the platform
+const mmapSupported = false
+
+// mapFile Memory-mapped I/O is only supported on linux, the other platforms use the file pager
+func mapFile(file *os.File, length int) ([]byte, error) {
+	return nil, ErrMmapUnsupported
+}
+
+// unmapFile Memory-mapped I/O is only supported on linux
+func unmapFile(mapping []byte) error {
+	return ErrMmapUnsupported
+}
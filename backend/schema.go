@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"tiny-rdb/util"
+)
+
+// Column Type
+const (
+	ColumnInteger = iota
+	ColumnText    = iota
+)
+
+// ColumnType type of column
+type ColumnType = int
+
+// The layout of row is fixed (id, username, email), the schema declares the name of table and columns
+// and the constraints of columns. It is persisted as JSON in a sidecar file next to the DB file,
+// because the DB file has no header page to keep it.
+const (
+	DefaultTableName = "users"
+	SchemaFileSuffix = ".schema"
+)
+
+// Column a column of table and its constraints
+type Column struct {
+	Name          string
+	Type          ColumnType
+	PrimaryKey    bool    `json:",omitempty"`
+	AutoIncrement bool    `json:",omitempty"` // ids assigned to the rows inserted without id are never reused
+	NotNull       bool    `json:",omitempty"`
+	Unique        bool    `json:",omitempty"`
+	Default       *string `json:",omitempty"` // nil represents no default value, the column will be NULL if it is omitted
+	Check         string  `json:",omitempty"` // CHECK constraint expression, empty represents no check
+}
+
+// Schema schema of table
+type Schema struct {
+	TableName string
+	Columns   [NumColumns]Column
+	Sequence  uint32 `json:",omitempty"` // The largest id ever assigned to AUTOINCREMENT primary key
+	Declared  bool   `json:"-"`          // Declared by create statement, the undeclared default schema is not persisted
+}
+
+// DefaultSchema Make the schema of table which is not declared by create statement
+func DefaultSchema() *Schema {
+	var schema *Schema = new(Schema)
+	schema.TableName = DefaultTableName
+	schema.Columns[ColumnPrimaryID] = Column{Name: "id", Type: ColumnInteger, PrimaryKey: true, NotNull: true}
+	schema.Columns[ColumnUserName] = Column{Name: "username", Type: ColumnText}
+	schema.Columns[ColumnEmail] = Column{Name: "email", Type: ColumnText}
+	return schema
+}
+
+// ColumnIndex Get the index of column by name, return -1 if there is no such column
+func ColumnIndex(schema *Schema, name string) int {
+	for i := range schema.Columns {
+		if schema.Columns[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SchemaFileName Get the schema sidecar file name of DB file
+func SchemaFileName(dbFileName string) string {
+	return dbFileName + SchemaFileSuffix
+}
+
+// ReadSchema Read the schema from the sidecar file, return the default schema if it does not exist
+func ReadSchema(dbFileName string) (*Schema, error) {
+	content, err := ioutil.ReadFile(SchemaFileName(dbFileName))
+	if os.IsNotExist(err) {
+		return DefaultSchema(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read schema file: %s", err.Error())
+	}
+
+	var schema *Schema = new(Schema)
+	if err := json.Unmarshal(content, schema); err != nil {
+		return nil, fmt.Errorf("Schema file is corrupt: %s", err.Error())
+	}
+	schema.Declared = true
+	return schema, nil
+}
+
+// LoadSchema Load the schema from the sidecar file, return the default schema if it does not exist
+func LoadSchema(dbFileName string) *Schema {
+	schema, err := ReadSchema(dbFileName)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+	return schema
+}
+
+// SaveSchema Persist the declared schema of table to the sidecar file, a failed write is raised as Error
+func SaveSchema(table *Table) {
+	// Snapshots and the copies of transactions have no DB file, their schema is persisted by commit
+	if !table.Schema.Declared || table.Pager.FilePtr == nil {
+		return
+	}
+
+	if err := WriteSchema(table.Schema, table.Pager.FilePtr.Name()); err != nil {
+		panic(&Error{Err: err})
+	}
+}
+
+// WriteSchema Write the schema to the sidecar file of DB file
+func WriteSchema(schema *Schema, dbFileName string) error {
+	var fileName string = SchemaFileName(dbFileName)
+	if err := writeSchemaFile(schema, fileName+".tmp"); err != nil {
+		return err
+	}
+
+	// Rename is atomic, a crash never leaves half-written schema
+	if err := os.Rename(fileName+".tmp", fileName); err != nil {
+		return fmt.Errorf("Unable to write schema file: %s", err.Error())
+	}
+	return nil
+}
+
+// writeSchemaFile Write the schema to the file of fileName
+func writeSchemaFile(schema *Schema, fileName string) error {
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode schema: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("Unable to write schema file: %s", err.Error())
+	}
+	return nil
+}
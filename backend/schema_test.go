@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	dbFile := "./Schema.db"
+	table := OpenDB(dbFile)
+
+	if table.Schema.Declared || table.Schema.TableName != DefaultTableName {
+		t.Errorf("schema must be default schema")
+	}
+
+	if ColumnIndex(table.Schema, "email") != ColumnEmail || ColumnIndex(table.Schema, "name") != -1 {
+		t.Errorf("column index is wrong")
+	}
+
+	CloseDB(table)
+	if _, err := os.Stat(SchemaFileName(dbFile)); !os.IsNotExist(err) {
+		t.Errorf("default schema must not be persisted")
+	}
+
+	table = OpenDB(dbFile)
+	defaultName := "anonymous"
+	table.Schema.TableName = "people"
+	table.Schema.Columns[ColumnUserName].NotNull = true
+	table.Schema.Columns[ColumnUserName].Default = &defaultName
+	table.Schema.Columns[ColumnEmail].Check = "email like '%@%'"
+	table.Schema.Declared = true
+	CloseDB(table)
+
+	table = OpenDB(dbFile)
+	column := table.Schema.Columns[ColumnUserName]
+	if !table.Schema.Declared || table.Schema.TableName != "people" || !column.NotNull || *column.Default != defaultName {
+		t.Errorf("schema must be loaded from schema file: %v", table.Schema)
+	}
+
+	if table.Schema.Columns[ColumnEmail].Check != "email like '%@%'" {
+		t.Errorf("check constraint must be loaded from schema file")
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(SchemaFileName(dbFile))
+}
+
+func TestNullColumn(t *testing.T) {
+	var row Row
+	copy(row.Email[:], "we@qq.com")
+	SetNullColumn(&row, ColumnEmail, true)
+
+	if !IsNullColumn(row.NullBitmap, ColumnEmail) || IsNullColumn(row.NullBitmap, ColumnUserName) {
+		t.Errorf("null bitmap is wrong: %b", row.NullBitmap)
+	}
+
+	if row.Email[0] != 0 {
+		t.Errorf("value of NULL column must be zeroed")
+	}
+
+	bytes := make([]byte, RowSize)
+	SerializeRow(&row, bytes)
+	var newRow Row
+	DeserializeRow(bytes, &newRow)
+	if newRow.NullBitmap != row.NullBitmap {
+		t.Errorf("null bitmap must be serialized")
+	}
+
+	SetNullColumn(&row, ColumnEmail, false)
+	if row.NullBitmap != 0 {
+		t.Errorf("null bitmap must be cleared")
+	}
+}
@@ -3,37 +3,51 @@ package backend
 import (
 	"fmt"
 	"os"
+	"sync"
+	"time"
 	"tiny-rdb/util"
 	"unsafe"
 )
 
 // const var
 const (
-	PrimaryIDSize = 4
-	UserNameSize  = 32
-	EmailSize     = 256
+	PrimaryIDSize  = 4
+	UserNameSize   = 32
+	EmailSize      = 256
+	NullBitmapSize = 4
 
-	IDOffSet       = 0
-	UserNameOffSet = IDOffSet + PrimaryIDSize
-	EmailOffSet    = UserNameOffSet + UserNameSize
-	RowSize        = PrimaryIDSize + UserNameSize + EmailSize
+	IDOffSet         = 0
+	UserNameOffSet   = IDOffSet + PrimaryIDSize
+	EmailOffSet      = UserNameOffSet + UserNameSize
+	NullBitmapOffSet = EmailOffSet + EmailSize
+	RowSize          = PrimaryIDSize + UserNameSize + EmailSize + NullBitmapSize
 
 	TableMaxPages = 100
 	PageSize      = 4 * 1024 // 4KB
 )
 
+// Column index of the row, bit N of the null bitmap is set when column N is NULL
+const (
+	ColumnPrimaryID = iota
+	ColumnUserName  = iota
+	ColumnEmail     = iota
+	NumColumns      = iota
+)
+
 // Row Table Row
 type Row struct {
-	PrimaryID uint32
-	UserName  [UserNameSize]byte
-	Email     [EmailSize]byte
+	PrimaryID  uint32
+	UserName   [UserNameSize]byte
+	Email      [EmailSize]byte
+	NullBitmap uint32
 }
 
 // VisualRow readable row
 type VisualRow struct {
-	PrimaryID uint32
-	UserName  string
-	Email     string
+	PrimaryID  uint32
+	UserName   string
+	Email      string
+	NullBitmap uint32
 }
 
 // Page  one page = 4kB
@@ -47,12 +61,51 @@ type Pager struct {
 	FileLength int64
 	NumPages   uint32
 	Pages      [TableMaxPages]*Page
+	CacheLock  sync.Mutex // Readers share the table, so loading pages to the cache is serialized
+
+	// The page is also referred by a snapshot, or by the snapshot a transaction began from,
+	// so GetPageForWrite copies it before it is changed
+	shared [TableMaxPages]bool
+	// The page of a snapshot is the copy of the page in the mapping of DB file, the table still reads the mapping
+	copied [TableMaxPages]bool
+
+	MemoryMapped bool     // The pages in the DB file are read from the file mapped in memory
+	mapping      []byte   // The DB file mapped in memory read-only, nil until the file has a page
+	oldMappings  [][]byte // Mappings replaced by remapping, the cached pages may still refer them until the next flush
+
+	Synchronous Synchronous         // When the written pages are synced to disk
+	dirty       [TableMaxPages]bool // The page is handed out for writing or new since it is written to the DB file
+	writes      uint64              // Pages written to the DB file
+	syncs       uint64              // Syncs of the DB file
 }
 
 // Table  table is consist of pages
 type Table struct {
-	RootPageNum uint32
-	Pager       *Pager
+	RootPageNum  uint32
+	Pager        *Pager
+	Schema       *Schema
+	LastInsertID uint32       // id of the row inserted most recently through this table
+	Transaction  *Transaction // transaction begun by begin statement, nil if there is no active one
+	ReadOnly     bool         // Opened with SHARED lock, the statements changing the table are rejected
+	Version      uint64       // increased by each change committed, snapshots of the same version are the same
+
+	// Statements reading the table hold the read lock, statements changing the table hold the write lock.
+	// The lock is taken by the statement entries of frontend and Snapshot, the other backend functions do not lock.
+	RWLock sync.RWMutex
+
+	snapshot     *Table // latest snapshot, shared by readers until the next commit
+	snapshotLock sync.Mutex
+}
+
+// OpenOptions options of opening DB file
+type OpenOptions struct {
+	ReadOnly    bool          // Open with SHARED lock which allows the other readers, otherwise EXCLUSIVE lock
+	BusyTimeout time.Duration // How long to wait for the lock held by others, 0 fails at once
+
+	// Read the pages from the DB file mapped in memory instead of file I/O, only supported on linux
+	MemoryMapped bool
+	// When the written pages are synced to disk, SynchronousFull by default
+	Synchronous Synchronous
 }
 
 // Tables a set of tables
@@ -66,7 +119,13 @@ type Cursor struct {
 	PageNum      uint32
 	CellNum      uint32
 	PassedCells  uint32
-	IsEndOfTable bool
+	IsEndOfTable bool // Moved past the last row by CursorNext, or before the first row by CursorPrev
+
+	// Bounded cursor stops at the keys out of [LowerBound, UpperBound]
+	HasUpperBound bool
+	UpperBound    uint32
+	HasLowerBound bool
+	LowerBound    uint32
 }
 
 // CursorBegin create a cursor point to begin of the table
@@ -83,12 +142,12 @@ func CursorBegin(table *Table) *Cursor {
 	return cursor
 }
 
-// CursorEnd create a cursor point to end of the table
+// CursorEnd create a cursor point to end of the table, past the last row of the rightmost leaf.
+// It descends along the right child pointers like CursorLast, so the rows are not passed and PassedCells is 0.
 func CursorEnd(table *Table) *Cursor {
-	var cursor *Cursor = CursorBegin(table)
-	for !cursor.IsEndOfTable {
-		CursorNext(cursor)
-	}
+	var cursor *Cursor = CursorLast(table)
+	cursor.CellNum = *LeafNodeNumCells(GetPage(table.Pager, cursor.PageNum).Mem[:])
+	cursor.IsEndOfTable = true
 	return cursor
 }
 
@@ -102,102 +161,205 @@ func Find(table *Table, key uint32) *Cursor {
 	} else if GetNodeType(rootPage.Mem[:]) == TypeInternalNode {
 		return FindInternalNode(table, rootPageNum, key)
 	} else {
-		os.Exit(util.ExitFailure)
+		raise("Unknown node type of root page %v, Corrupt File.", rootPageNum)
 		return nil
 	}
 }
 
-func openPager(filename string) *Pager {
-	filePtr, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
+func openPager(filename string, options *OpenOptions) (*Pager, error) {
+	var flag int = os.O_RDWR | os.O_CREATE
+	if options.ReadOnly {
+		flag = os.O_RDONLY
+	}
+
+	filePtr, err := os.OpenFile(filename, flag, 0755)
 	if err != nil {
-		fmt.Printf("Unable to open DB file: %s\n", err.Error())
-		os.Exit(util.ExitFailure)
+		return nil, fmt.Errorf("Unable to open DB file: %s", err.Error())
 	}
 
+	if err := lockFile(filePtr, !options.ReadOnly, options.BusyTimeout); err != nil {
+		filePtr.Close()
+		return nil, err
+	}
+
+	// A vacuum interrupted after it is committed is finished before the pages are read
+	if _, err := os.Stat(filename + VacuumFileSuffix); err == nil && options.ReadOnly {
+		filePtr.Close()
+		return nil, fmt.Errorf("Vacuum of DB file is not finished, open it for writing to finish it")
+	}
+	if !options.ReadOnly {
+		if err := recoverVacuum(filePtr); err != nil {
+			filePtr.Close()
+			return nil, err
+		}
+	}
+
+	// The size is read after the lock is taken, the writer holding the lock may be changing it
 	fileInf, err := os.Stat(filename)
 	if err != nil {
-		fmt.Printf("Unable to get file size: %s\n", err.Error())
-		os.Exit(util.ExitFailure)
+		filePtr.Close()
+		return nil, fmt.Errorf("Unable to get file size: %s", err.Error())
 	}
 
 	var pager *Pager = new(Pager)
 	pager.FilePtr = filePtr
 	pager.FileLength = fileInf.Size()
 	pager.NumPages = uint32(fileInf.Size() / PageSize)
+	pager.Synchronous = options.Synchronous
 
 	if pager.FileLength%PageSize != 0 {
-		fmt.Printf("DB File is not contains a whole mumber of pages, Corrupt File.\n")
-		os.Exit(util.ExitFailure)
+		filePtr.Close()
+		return nil, fmt.Errorf("DB File is not contains a whole mumber of pages, Corrupt File.")
+	}
+	if err := checkFileFormat(filePtr, pager.FileLength); err != nil {
+		filePtr.Close()
+		return nil, err
 	}
 
 	for i := 0; i < TableMaxPages; i++ {
 		pager.Pages[i] = nil
 	}
 
-	return pager
+	if options.MemoryMapped {
+		if !mmapSupported {
+			filePtr.Close()
+			return nil, ErrMmapUnsupported
+		}
+		pager.MemoryMapped = true
+		if err := remapPager(pager); err != nil {
+			filePtr.Close()
+			return nil, err
+		}
+	}
+
+	return pager, nil
 }
 
-// OpenDB Open a new table from DB file
-func OpenDB(filename string) *Table {
+// Open Open a new table from DB file, return the error instead of exiting
+func Open(filename string) (*Table, error) {
+	return OpenWithOptions(filename, &OpenOptions{})
+}
+
+// OpenWithOptions Open a table from DB file with options
+func OpenWithOptions(filename string, options *OpenOptions) (*Table, error) {
+	pager, err := openPager(filename, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Schema is read under the lock of DB file
+	schema, err := ReadSchema(filename)
+	if err != nil {
+		pager.FilePtr.Close()
+		return nil, err
+	}
+
 	var table *Table = new(Table)
-	var pager *Pager = openPager(filename)
 	table.RootPageNum = 0
 	table.Pager = pager
+	table.Schema = schema
+	table.ReadOnly = options.ReadOnly
 
 	if pager.NumPages == 0 {
 		// New DB file. Initialize page 0 as leaf node.
-		var page *Page = GetPage(pager, 0)
+		var page *Page = GetPageForWrite(pager, 0)
 		InitializeLeafNode(page.Mem[:])
 		SetRootNode(page.Mem[:], true)
+		stampFileFormat(page)
+	}
+	return table, nil
+}
+
+// OpenDB Open a new table from DB file
+func OpenDB(filename string) *Table {
+	table, err := Open(filename)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
 	}
 	return table
 }
 
-// FlushPage Flush a page from page num
-func FlushPage(pager *Pager, pageNum uint32) {
+// FlushPage Write a page to the DB file from page num, it is synced to disk by FlushPager
+func FlushPage(pager *Pager, pageNum uint32) error {
 	if pager.Pages[pageNum] == nil {
-		fmt.Printf("Error: Flush null page: %v\n", pageNum)
-		os.Exit(util.ExitFailure)
+		return fmt.Errorf("Error: Flush null page: %v", pageNum)
 	}
 
+	// The page may be shared with snapshots, page 0 is stamped in a copy
+	var page *Page = pager.Pages[pageNum]
+	if pageNum == 0 {
+		var stamped Page = *page
+		stampFileFormat(&stamped)
+		page = &stamped
+	}
 	_, err := pager.FilePtr.Seek(int64(pageNum)*int64(PageSize), 0)
 	if err != nil {
-		fmt.Printf("Error: Seeking file %s\n", err.Error())
-		os.Exit(util.ExitFailure)
+		return fmt.Errorf("Error: Seeking file %s", err.Error())
 	}
 
-	writeBytes, err := pager.FilePtr.Write(pager.Pages[pageNum].Mem[:PageSize])
+	writeBytes, err := pager.FilePtr.Write(page.Mem[:PageSize])
 	if err != nil {
-		fmt.Printf("Error writing DB file: %s\n", err.Error())
-		os.Exit(util.ExitFailure)
+		return fmt.Errorf("Error writing DB file: %s", err.Error())
 	}
 
 	if uint32(writeBytes) > PageSize {
-		fmt.Printf("Write bytes size %v over promised size %v\n", writeBytes, PageSize)
-		os.Exit(util.ExitFailure)
+		return fmt.Errorf("Write bytes size %v over promised size %v", writeBytes, PageSize)
 	}
 
-	pager.FilePtr.Sync()
+	// The mapping is extended to the grown file by the next miss
+	if int64(pageNum+1)*PageSize > pager.FileLength {
+		pager.FileLength = int64(pageNum+1) * PageSize
+	}
+	pager.dirty[pageNum] = false
+	pager.writes++
+	return nil
 }
 
-// CloseDB Flushes the page cache to disk and close the DB file
-func CloseDB(table *Table) {
+// Close Flushes the page cache to disk and close the DB file, return the error instead of exiting.
+// The DB file is closed even if the flush fails.
+func Close(table *Table) error {
 	var pager *Pager = table.Pager
 
-	// Flush fulled pages
+	// Changes of the transaction which is not committed are discarded
+	table.Transaction = nil
+
+	// Pages of read-only table are never changed, closing the file releases the SHARED lock
+	if table.ReadOnly {
+		unmapPager(pager)
+		return pager.FilePtr.Close()
+	}
+
+	// Flush changed pages
+	var err error = FlushPager(pager, true)
 	for i := uint32(0); i < pager.NumPages; i++ {
-		if pager.Pages[i] != nil {
-			FlushPage(pager, i)
-			pager.Pages[i] = nil
-		}
+		pager.Pages[i] = nil
 	}
+	unmapPager(pager)
 
-	pager.FilePtr.Sync()
+	if err == nil && table.Schema.Declared {
+		err = WriteSchema(table.Schema, pager.FilePtr.Name())
+	}
 
 	// Close DB file
-	err := pager.FilePtr.Close()
-	if err != nil {
-		fmt.Printf("Error closing DB file: %s\n", err.Error())
+	if closeErr := pager.FilePtr.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("Error closing DB file: %s", closeErr.Error())
+	}
+	return err
+}
+
+// Discard Close the DB file without writing the cached pages, the changes not flushed are lost.
+// It is for the table whose cached pages may be half changed by an Error raised in a statement.
+func Discard(table *Table) error {
+	table.Transaction = nil
+	unmapPager(table.Pager)
+	return table.Pager.FilePtr.Close()
+}
+
+// CloseDB Flushes the page cache to disk and close the DB file
+func CloseDB(table *Table) {
+	if err := Close(table); err != nil {
+		fmt.Printf("%s\n", err.Error())
 		os.Exit(util.ExitFailure)
 	}
 }
@@ -217,6 +379,10 @@ func SerializeRow(src *Row, dst []byte) int {
 	Email := (*[EmailSize]byte)(unsafeEmail)
 	copied = copied + copy(dst[EmailOffSet:EmailOffSet+EmailSize], (*Email)[0:])
 
+	unsafeNullBitmap := unsafe.Pointer(&src.NullBitmap)
+	NullBitmap := (*[NullBitmapSize]byte)(unsafeNullBitmap)
+	copied = copied + copy(dst[NullBitmapOffSet:NullBitmapOffSet+NullBitmapSize], (*NullBitmap)[0:])
+
 	return copied
 }
 
@@ -235,6 +401,10 @@ func DeserializeRow(src []byte, dst *Row) int {
 	Email := (*[EmailSize]byte)(unsafeEmail)
 	copied = copied + copy((*Email)[0:], src[EmailOffSet:EmailOffSet+EmailSize])
 
+	unsafeNullBitmap := unsafe.Pointer(&dst.NullBitmap)
+	NullBitmap := (*[NullBitmapSize]byte)(unsafeNullBitmap)
+	copied = copied + copy((*NullBitmap)[0:], src[NullBitmapOffSet:NullBitmapOffSet+NullBitmapSize])
+
 	return copied
 }
 
@@ -247,15 +417,16 @@ func GetUnallocatedPageNum(pager *Pager) uint32 {
 func flushAllocatedPages(pager *Pager) {
 	for i, page := range pager.Pages {
 		if page != nil {
-			FlushPage(pager, uint32(i))
+			if err := FlushPage(pager, uint32(i)); err != nil {
+				panic(&Error{Err: err})
+			}
 		} else {
 			break
 		}
 	}
 	fileInf, err := pager.FilePtr.Stat()
 	if err != nil {
-		fmt.Printf("Cannot get lastest file state\n")
-		os.Exit(util.ExitFailure)
+		raise("Cannot get lastest file state")
 	}
 	pager.FileLength = fileInf.Size()
 
@@ -264,52 +435,64 @@ func flushAllocatedPages(pager *Pager) {
 
 // GetPage Get the page that pageNum specific
 func GetPage(pager *Pager, pageNum uint32) *Page {
-	if pageNum > TableMaxPages {
-		fmt.Printf("page number out of bound: %v\n", pageNum)
-		os.Exit(util.ExitFailure)
+	if pageNum >= TableMaxPages {
+		raise("page number out of bound: %v", pageNum)
 	}
 
+	pager.CacheLock.Lock()
+	defer pager.CacheLock.Unlock()
+
 	if pager.Pages[pageNum] == nil {
-		var page *Page = new(Page)
-		var numPages uint32 = uint32(pager.FileLength / PageSize)
-		// Last page not fulled
-		if pager.FileLength%PageSize != 0 {
-			numPages++
-		}
+		// The pages after the tree are new, the DB file may still have the pages dropped by bulk load there
+		var inFile bool = pageNum < pager.NumPages && int64(pageNum)*PageSize < pager.FileLength
 
-		if pageNum <= numPages {
-			var fileOffSet int64 = int64(pageNum) * int64(PageSize)
-			pager.FilePtr.Seek(fileOffSet, 0)
+		// The page in the mapped DB file needs no read
+		var page *Page
+		if inFile {
+			page = mappedPage(pager, pageNum)
+		}
+		if page == nil {
+			page = new(Page)
+			var numPages uint32 = uint32(pager.FileLength / PageSize)
+			// Last page not fulled
+			if pager.FileLength%PageSize != 0 {
+				numPages++
+			}
 
-			var restOfSize int64 = pager.FileLength - fileOffSet
-			if restOfSize >= PageSize {
-				readBytes, err := pager.FilePtr.Read(page.Mem[:])
-				if err != nil {
-					fmt.Printf("Error reading file: %s\n", err.Error())
-					os.Exit(util.ExitFailure)
+			if inFile && pageNum <= numPages {
+				var fileOffSet int64 = int64(pageNum) * int64(PageSize)
+				if _, err := pager.FilePtr.Seek(fileOffSet, 0); err != nil {
+					raise("Error: Seeking file %s", err.Error())
 				}
 
-				if readBytes != PageSize {
-					fmt.Printf("Read Bytes %v not equal to PageSize(4kB)\n", readBytes)
-					os.Exit(util.ExitFailure)
-				}
-			}
+				var restOfSize int64 = pager.FileLength - fileOffSet
+				if restOfSize >= PageSize {
+					readBytes, err := pager.FilePtr.Read(page.Mem[:])
+					if err != nil {
+						raise("Error reading file: %s", err.Error())
+					}
 
-			if restOfSize < PageSize {
-				readBytes, err := pager.FilePtr.Read(page.Mem[:restOfSize])
-				if err != nil {
-					fmt.Printf("Error reading file: %s\n", err.Error())
-					os.Exit(util.ExitFailure)
+					if readBytes != PageSize {
+						raise("Read Bytes %v not equal to PageSize(4kB)", readBytes)
+					}
 				}
 
-				if int64(readBytes) != restOfSize {
-					fmt.Printf("Read Bytes %v not equal to restOfSize %v\n", readBytes, restOfSize)
-					os.Exit(util.ExitFailure)
+				if restOfSize < PageSize {
+					readBytes, err := pager.FilePtr.Read(page.Mem[:restOfSize])
+					if err != nil {
+						raise("Error reading file: %s", err.Error())
+					}
+
+					if int64(readBytes) != restOfSize {
+						raise("Read Bytes %v not equal to restOfSize %v", readBytes, restOfSize)
+					}
 				}
 			}
 		}
 
+		// A new page is written to the DB file even if it is not changed, so the file keeps all pages of table
 		pager.Pages[pageNum] = page
+		pager.dirty[pageNum] = !inFile
 
 		if pageNum >= pager.NumPages {
 			pager.NumPages = pageNum + 1
@@ -319,6 +502,32 @@ func GetPage(pager *Pager, pageNum uint32) *Page {
 	return pager.Pages[pageNum]
 }
 
+// GetPageForWrite Get the page that pageNum specific to change it. The page shared with a snapshot is copied first
+// (copy-on-write), so the snapshot keeps the old version and the page pointer changes with each version.
+// The page in the read-only mapping of DB file is copied too, it is written to the file by FlushPager.
+// The callers changing a page must get it by GetPageForWrite instead of GetPage.
+func GetPageForWrite(pager *Pager, pageNum uint32) *Page {
+	var page *Page = GetPage(pager, pageNum)
+
+	pager.CacheLock.Lock()
+	defer pager.CacheLock.Unlock()
+	if pager.shared[pageNum] || isMappedPage(pager, pageNum, page) {
+		var copied Page = *page
+		page = &copied
+		pager.Pages[pageNum] = page
+		pager.shared[pageNum] = false
+	}
+	pager.dirty[pageNum] = true
+	return page
+}
+
+// setPage Replace the cached page with a new page which is not shared, it is written by the next flush
+func setPage(pager *Pager, pageNum uint32, page *Page) {
+	pager.Pages[pageNum] = page
+	pager.shared[pageNum] = false
+	pager.dirty[pageNum] = page != nil
+}
+
 // CursorValue returned address of a cursor pointed to specific row
 func CursorValue(cursor *Cursor) []byte {
 	var pageNum uint32 = cursor.PageNum
@@ -326,6 +535,12 @@ func CursorValue(cursor *Cursor) []byte {
 	return LeafNodeValue(page.Mem[:], cursor.CellNum)
 }
 
+// CursorValueForWrite returned address of the row pointed by cursor to change it
+func CursorValueForWrite(cursor *Cursor) []byte {
+	var page *Page = GetPageForWrite(cursor.TablePtr.Pager, cursor.PageNum)
+	return LeafNodeValue(page.Mem[:], cursor.CellNum)
+}
+
 // CursorNext next cursor
 func CursorNext(cursor *Cursor) {
 	var pageNum uint32 = cursor.PageNum
@@ -342,9 +557,48 @@ func CursorNext(cursor *Cursor) {
 			cursor.CellNum = 0
 		}
 	}
+	checkCursorBounds(cursor)
+}
+
+// IsNullColumn Check if the column of row is NULL
+func IsNullColumn(nullBitmap uint32, column uint32) bool {
+	return nullBitmap&(1<<column) != 0
+}
+
+// SetNullColumn Set or clear NULL flag of the column in row, the value of NULL column is zeroed
+func SetNullColumn(row *Row, column uint32, isNull bool) {
+	if !isNull {
+		row.NullBitmap &^= 1 << column
+		return
+	}
+
+	row.NullBitmap |= 1 << column
+	switch column {
+	case ColumnPrimaryID:
+		row.PrimaryID = 0
+	case ColumnUserName:
+		row.UserName = [UserNameSize]byte{}
+	case ColumnEmail:
+		row.Email = [EmailSize]byte{}
+	}
+}
+
+// ToVisualRow Convert row to readable row
+func ToVisualRow(row *Row, visualRow *VisualRow) {
+	visualRow.PrimaryID = row.PrimaryID
+	visualRow.UserName = util.ToString(row.UserName[:])
+	visualRow.Email = util.ToString(row.Email[:])
+	visualRow.NullBitmap = row.NullBitmap
 }
 
 // PrintRow print row
 func PrintRow(row *VisualRow) {
-	fmt.Printf("(%d, %v, %v)\n", row.PrimaryID, row.UserName, row.Email)
+	var userName, email string = row.UserName, row.Email
+	if IsNullColumn(row.NullBitmap, ColumnUserName) {
+		userName = "NULL"
+	}
+	if IsNullColumn(row.NullBitmap, ColumnEmail) {
+		email = "NULL"
+	}
+	fmt.Printf("(%d, %v, %v)\n", row.PrimaryID, userName, email)
 }
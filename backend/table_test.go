@@ -1,6 +1,8 @@
 package backend
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
 	"testing"
 	"tiny-rdb/util"
@@ -87,3 +89,33 @@ func TestCursor(t *testing.T) {
 	CloseDB(table)
 	os.Remove(dbFile)
 }
+
+func TestFileFormat(t *testing.T) {
+	dbFile := "./FileFormat.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2})
+	CloseDB(table)
+	table, err := Open(dbFile)
+	if err != nil {
+		t.Fatalf("the file written by this version must be opened: %v", err)
+	}
+	CloseDB(table)
+
+	// A file of the older layout has no format in page 0
+	var page Page
+	InitializeLeafNode(page.Mem[:])
+	SetRootNode(page.Mem[:], true)
+	ioutil.WriteFile(dbFile, page.Mem[:], 0600)
+	if _, err := Open(dbFile); !errors.Is(err, ErrFileFormat) {
+		t.Errorf("the file without format must be refused: %v", err)
+	}
+	os.Remove(dbFile)
+}
+
+func TestGetPageOutOfBound(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(*Error); !ok {
+			t.Errorf("page out of bound must raise Error")
+		}
+	}()
+	GetPage(new(Pager), TableMaxPages)
+}
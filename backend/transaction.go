@@ -0,0 +1,176 @@
+package backend
+
+import (
+	"reflect"
+)
+
+// Readers and transactions work on snapshots of the committed table (multi-version concurrency control
+// by copy-on-write pages), so they never see the changes not committed and long scans do not block writers.
+//
+// A snapshot is a table sharing the cached pages of the table, it is immutable and shared by readers until the next
+// commit. The shared pages are marked in the pager of table, and GetPageForWrite copies such a page before it is
+// changed, so the snapshot keeps the old version and only the changed pages are copied. The old versions of pages
+// are freed by GC once no snapshot refers them.
+//
+// A transaction runs its statements on a table sharing the pages of the snapshot it began from, the pages it changes
+// are copied the same way. Since a page is copied before each change while it is shared, a page which has the same
+// pointer in two versions of table has not been changed between them. On commit the pages the transaction changed
+// are installed to the table if none of them was changed by the others committed since it began, otherwise
+// the transaction is aborted (first committer wins).
+
+// Transaction a transaction working on a private copy of the table
+type Transaction struct {
+	Table *Table // private copy of the table, statements of the transaction run on it
+	Base  *Table // snapshot the transaction began from
+}
+
+// shareTable Make a table sharing the pages of table, the pages are marked shared in both pagers.
+// A page in the mapping of DB file changes when the flush writes the file, so the new table gets a copy of it
+// while table keeps reading the mapping. The copy is taken from the last snapshot of table if it has one,
+// a mapped page of table is never changed (it is copied before it is written), so it is copied once.
+func shareTable(table *Table) *Table {
+	var pager *Pager = new(Pager)
+	pager.NumPages = table.Pager.NumPages
+	for i := uint32(0); i < pager.NumPages; i++ {
+		var page *Page = GetPage(table.Pager, i)
+
+		table.Pager.CacheLock.Lock()
+		var mapped bool = isMappedPage(table.Pager, i, page)
+		table.Pager.shared[i] = true
+		table.Pager.CacheLock.Unlock()
+
+		if mapped {
+			page = mappedPageCopy(table, i, page)
+			pager.copied[i] = true
+		}
+		pager.Pages[i] = page
+		pager.shared[i] = true
+	}
+
+	var schema Schema = *table.Schema
+	var copied *Table = new(Table)
+	copied.RootPageNum = table.RootPageNum
+	copied.Pager = pager
+	copied.Schema = &schema
+	copied.LastInsertID = table.LastInsertID
+	copied.Version = table.Version
+	copied.ReadOnly = table.ReadOnly
+	return copied
+}
+
+// mappedPageCopy Get a copy of the mapped page of table, the one in the last snapshot of table is reused
+func mappedPageCopy(table *Table, pageNum uint32, page *Page) *Page {
+	if last := table.snapshot; last != nil && pageNum < last.Pager.NumPages && last.Pager.copied[pageNum] {
+		return last.Pager.Pages[pageNum]
+	}
+	var copied Page = *page
+	return &copied
+}
+
+// snapshotLocked Get the snapshot of table, the caller holds the lock of table
+func snapshotLocked(table *Table) *Table {
+	table.snapshotLock.Lock()
+	defer table.snapshotLock.Unlock()
+
+	if table.snapshot == nil || table.snapshot.Version != table.Version {
+		var snapshot *Table = shareTable(table)
+		snapshot.ReadOnly = true
+		table.snapshot = snapshot
+	}
+	return table.snapshot
+}
+
+// Snapshot Get the immutable snapshot of the committed table, scanning it needs no lock
+func Snapshot(table *Table) *Table {
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+	return snapshotLocked(table)
+}
+
+// BeginTransaction Begin a transaction of the table, the caller holds the write lock of table
+func BeginTransaction(table *Table) *Transaction {
+	var transaction *Transaction = new(Transaction)
+	transaction.Base = snapshotLocked(table)
+	transaction.Table = shareTable(transaction.Base)
+	transaction.Table.ReadOnly = table.ReadOnly
+	return transaction
+}
+
+// pageChanged Check if the page was changed between two versions of table sharing pages, by the page pointers.
+// The copy of a mapped page is the same page as the mapped page.
+func pageChanged(pager *Pager, other *Pager, pageNum uint32) bool {
+	var inPager bool = pageNum < pager.NumPages
+	var inOther bool = pageNum < other.NumPages
+	if inPager != inOther {
+		return true
+	}
+	if !inPager || pager.Pages[pageNum] == other.Pages[pageNum] {
+		return false
+	}
+	return !(pager.copied[pageNum] && isMappedPage(other, pageNum, other.Pages[pageNum])) &&
+		!(other.copied[pageNum] && isMappedPage(pager, pageNum, pager.Pages[pageNum]))
+}
+
+// CommitTransaction Install the changes of transaction to the table and write the pages to the DB file,
+// the caller holds the write lock of table. Return false if it conflicts with the transactions committed since it began.
+func CommitTransaction(table *Table, transaction *Transaction) bool {
+	var base *Table = transaction.Base
+	var work *Table = transaction.Table
+
+	var numPages uint32 = table.Pager.NumPages
+	for _, pager := range []*Pager{base.Pager, work.Pager} {
+		if pager.NumPages > numPages {
+			numPages = pager.NumPages
+		}
+	}
+
+	var committedSince bool = table.Version != base.Version
+	var changedPages []uint32
+	for i := uint32(0); i < numPages; i++ {
+		if !pageChanged(base.Pager, work.Pager, i) {
+			continue
+		}
+		if committedSince && pageChanged(base.Pager, table.Pager, i) {
+			return false
+		}
+		changedPages = append(changedPages, i)
+	}
+
+	var schemaChanged bool = !reflect.DeepEqual(*base.Schema, *work.Schema)
+	if schemaChanged && committedSince && !reflect.DeepEqual(*base.Schema, *table.Schema) {
+		return false
+	}
+
+	if len(changedPages) == 0 && !schemaChanged {
+		return true
+	}
+
+	// The changed pages are not shared with the base snapshot any more, they are moved to the table
+	var pager *Pager = table.Pager
+	for _, pageNum := range changedPages {
+		pager.Pages[pageNum] = work.Pager.Pages[pageNum]
+		pager.shared[pageNum] = work.Pager.shared[pageNum]
+		pager.dirty[pageNum] = pager.Pages[pageNum] != nil
+	}
+	// The pages are added by splits and dropped by bulk load
+	if work.Pager.NumPages != base.Pager.NumPages {
+		pager.NumPages = work.Pager.NumPages
+	}
+
+	// The committed pages are durable by a single sync, the pages changed outside transactions are written together
+	if !table.ReadOnly {
+		if err := FlushPager(pager, false); err != nil {
+			panic(&Error{Err: err})
+		}
+	}
+
+	if schemaChanged {
+		*table.Schema = *work.Schema
+		SaveSchema(table)
+	}
+	if work.LastInsertID != base.LastInsertID {
+		table.LastInsertID = work.LastInsertID
+	}
+	table.Version++
+	return true
+}
@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func insertKeys(table *Table, from uint32, to uint32) {
+	for i := from; i <= to; i++ {
+		var row Row
+		row.PrimaryID = i
+		InsertLeafNode(Find(table, i), i, &row)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dbFile := "./Snapshot.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2, 3})
+
+	snapshot := Snapshot(table)
+	if Snapshot(table) != snapshot {
+		t.Errorf("snapshots of the same version must be shared")
+	}
+
+	// Split the root leaf after the snapshot is taken
+	insertKeys(table, 4, 40)
+	table.Version++
+
+	_, numCells := CountLeafCells(snapshot)
+	if numCells != 3 || TreeDepth(snapshot) != 1 {
+		t.Errorf("snapshot must not see the later changes, num of cells %v", numCells)
+	}
+
+	newSnapshot := Snapshot(table)
+	_, numCells = CountLeafCells(newSnapshot)
+	if numCells != 40 || TreeDepth(newSnapshot) != 2 {
+		t.Errorf("new snapshot must see the committed changes, num of cells %v", numCells)
+	}
+
+	// Leaves not changed by the next change are shared with the previous snapshot
+	var row Row
+	row.PrimaryID = 41
+	InsertLeafNode(Find(table, 41), 41, &row)
+	table.Version++
+	latest := Snapshot(table)
+	var shared int = 0
+	for i := uint32(0); i < latest.Pager.NumPages; i++ {
+		if latest.Pager.Pages[i] == newSnapshot.Pager.Pages[i] {
+			shared++
+		}
+	}
+	if shared == 0 || shared == int(latest.Pager.NumPages) {
+		t.Errorf("unchanged pages must be shared and the changed ones copied, shared %v of %v", shared, latest.Pager.NumPages)
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	dbFile := "./CopyOnWrite.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2, 3})
+	insertKeys(table, 4, 40)
+
+	// The transaction shares every page until it changes one
+	transaction := BeginTransaction(table)
+	for i := uint32(0); i < table.Pager.NumPages; i++ {
+		if transaction.Table.Pager.Pages[i] != table.Pager.Pages[i] {
+			t.Errorf("page %v must be shared by begin", i)
+		}
+	}
+
+	var rightmost *Page = table.Pager.Pages[CursorLast(table).PageNum]
+	insertKeys(transaction.Table, 41, 41)
+	var copied int = 0
+	for i := uint32(0); i < table.Pager.NumPages; i++ {
+		if transaction.Table.Pager.Pages[i] != table.Pager.Pages[i] {
+			copied++
+		}
+	}
+	if copied != 1 || table.Pager.Pages[CursorLast(table).PageNum] != rightmost || GetNodeMaxKeys(rightmost.Mem[:]) != 40 {
+		t.Errorf("only the changed leaf must be copied, %v pages copied", copied)
+	}
+
+	// The table copies the page shared with the transaction before changing it
+	insertKeys(table, 42, 42)
+	if GetNodeMaxKeys(rightmost.Mem[:]) != 40 || table.Pager.Pages[CursorLast(table).PageNum] == rightmost {
+		t.Errorf("the shared page must be copied before it is changed")
+	}
+
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestTransaction(t *testing.T) {
+	dbFile := "./Transaction.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+
+	first := BeginTransaction(table)
+	insertKeys(first.Table, 11, 40)
+	first.Table.LastInsertID = 40
+	if _, numCells := CountLeafCells(table); numCells != 10 {
+		t.Errorf("changes of transaction must be private before commit")
+	}
+
+	second := BeginTransaction(table)
+	insertKeys(second.Table, 41, 41)
+
+	if !CommitTransaction(table, first) {
+		t.Errorf("first commit must succeed")
+	}
+	_, numCells := CountLeafCells(table)
+	if numCells != 40 || TreeDepth(table) != 2 || table.LastInsertID != 40 {
+		t.Errorf("commit must install the changes, num of cells %v", numCells)
+	}
+
+	// Both transactions changed the root page
+	if CommitTransaction(table, second) {
+		t.Errorf("second commit must be aborted by conflict")
+	}
+	if _, numCells := CountLeafCells(table); numCells != 40 {
+		t.Errorf("aborted transaction must not change the table")
+	}
+
+	// Transactions changing different leaves do not conflict
+	third := BeginTransaction(table)
+	fourth := BeginTransaction(table)
+	CursorValue(Find(third.Table, 1))[UserNameOffSet] = 'a'
+	CursorValue(Find(fourth.Table, 40))[UserNameOffSet] = 'b'
+	if !CommitTransaction(table, third) || !CommitTransaction(table, fourth) {
+		t.Errorf("transactions changing different pages must both commit")
+	}
+
+	// Committed pages are in the DB file before close
+	fileInfo, _ := os.Stat(dbFile)
+	if fileInfo.Size() != int64(table.Pager.NumPages)*PageSize {
+		t.Errorf("committed pages must be written, file size %v", fileInfo.Size())
+	}
+
+	// Changes of the transaction which is not committed are discarded on close
+	table.Transaction = BeginTransaction(table)
+	insertKeys(table.Transaction.Table, 41, 41)
+	CloseDB(table)
+
+	table = OpenDB(dbFile)
+	_, numCells = CountLeafCells(table)
+	if numCells != 40 {
+		t.Errorf("num of cells must be 40 after reopen, but it is %v", numCells)
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Vacuum rebuilds the B-tree by bulk loading the rows in key order into packed pages, the pages split by inserts
+// in the middle and the pages left by deletes are dropped.
+//
+// The new pages are written to the vacuum file, which is renamed to its final name once it is synced, and
+// the directory is synced so the rename survives a crash. From then on the vacuum is committed: the pages are copied
+// over the DB file, which is truncated to the new size, and the vacuum file is removed and the directory synced again.
+// If that is interrupted, the next open of the DB file finishes the copy from the vacuum file.
+// The DB file is rewritten in place, so the lock held on it stays valid.
+const (
+	VacuumFileSuffix = ".vacuum"
+	VacuumFillFactor = DefaultFillFactor
+)
+
+// writePages Write the pages to the file from page 0 and sync it
+func writePages(file *os.File, pages []*Page) error {
+	for i, page := range pages {
+		if i == 0 {
+			stampFileFormat(page)
+		}
+		if _, err := file.WriteAt(page.Mem[:], int64(i)*PageSize); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+// Vacuum Rebuild the B-tree of table into packed pages and replace the DB file with them, the caller holds
+// the write lock of table. The leaves are filled up to fillFactor, 1.0 packs them full.
+func Vacuum(table *Table, fillFactor float64) error {
+	var loader *BulkLoader = NewBulkLoader(fillFactor)
+	var cursor *Cursor = CursorBegin(table)
+	for ; !cursor.IsEndOfTable; CursorNext(cursor) {
+		var row Row
+		DeserializeRow(CursorValue(cursor), &row)
+		if err := loader.Add(&row); err != nil {
+			return err
+		}
+	}
+	var pages []*Page = loader.Finish()
+
+	var fileName string = table.Pager.FilePtr.Name()
+	file, err := os.OpenFile(fileName+VacuumFileSuffix+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to create vacuum file: %s", err.Error())
+	}
+	err = writePages(file, pages)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fileName + VacuumFileSuffix + ".tmp")
+		return fmt.Errorf("Unable to write vacuum file: %s", err.Error())
+	}
+
+	// Committed, the pages are in the DB file after this even if the copy below is interrupted
+	if err := os.Rename(fileName+VacuumFileSuffix+".tmp", fileName+VacuumFileSuffix); err != nil {
+		return fmt.Errorf("Unable to write vacuum file: %s", err.Error())
+	}
+	if err := syncDir(fileName); err != nil {
+		return err
+	}
+
+	var pager *Pager = table.Pager
+	for i := range pager.Pages {
+		setPage(pager, uint32(i), nil)
+		if i < len(pages) {
+			setPage(pager, uint32(i), pages[i])
+		}
+	}
+	pager.NumPages = uint32(len(pages))
+	table.RootPageNum = 0
+	if err := recoverVacuum(pager.FilePtr); err != nil {
+		return err
+	}
+	pager.FileLength = int64(len(pages)) * PageSize
+	for i := range pager.dirty {
+		pager.dirty[i] = false
+	}
+	return nil
+}
+
+// recoverVacuum Copy the pages of the committed vacuum file over the DB file and truncate it, then remove
+// the vacuum file. It is done after vacuum, and by the open of DB file if vacuum was interrupted.
+func recoverVacuum(file *os.File) error {
+	var vacuumFileName string = file.Name() + VacuumFileSuffix
+	content, err := ioutil.ReadFile(vacuumFileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read vacuum file: %s", err.Error())
+	}
+	if len(content)%PageSize != 0 {
+		// The vacuum file is renamed after it is synced, so it is never partial
+		return fmt.Errorf("Vacuum file does not contain a whole number of pages, Corrupt File.")
+	}
+
+	if _, err := file.WriteAt(content, 0); err != nil {
+		return fmt.Errorf("Unable to write DB file: %s", err.Error())
+	}
+	if err := file.Truncate(int64(len(content))); err != nil {
+		return fmt.Errorf("Unable to truncate DB file: %s", err.Error())
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("Unable to write DB file: %s", err.Error())
+	}
+	if err := os.Remove(vacuumFileName); err != nil {
+		return fmt.Errorf("Unable to remove vacuum file: %s", err.Error())
+	}
+	return syncDir(vacuumFileName)
+}
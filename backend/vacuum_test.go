@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// checkKeys Check the keys of table are from 1 to numKeys in order and each of them can be found
+func checkKeys(t *testing.T, table *Table, numKeys uint32) {
+	var key uint32 = 0
+	for cursor := CursorBegin(table); !cursor.IsEndOfTable; CursorNext(cursor) {
+		key++
+		if CursorKey(cursor) != key {
+			t.Fatalf("key must be %v, but it is %v", key, CursorKey(cursor))
+		}
+		var found *Cursor = Find(table, key)
+		if found.CellNum >= *LeafNodeNumCells(GetPage(table.Pager, found.PageNum).Mem[:]) || CursorKey(found) != key {
+			t.Fatalf("key %v must be found", key)
+		}
+	}
+	if key != numKeys {
+		t.Errorf("num of keys must be %v, but it is %v", numKeys, key)
+	}
+}
+
+func TestVacuum(t *testing.T) {
+	dbFile := "./Vacuum.db"
+
+	// Keys inserted in the middle split the leaves in half
+	var keys []uint32
+	for i := uint32(1); i <= 60; i++ {
+		keys = append(keys, i*2)
+	}
+	for i := uint32(1); i <= 60; i++ {
+		keys = append(keys, i*2-1)
+	}
+	table := openTableWithKeys(dbFile, keys)
+	leafPages, _ := CountLeafCells(table)
+	if leafPages <= (120+LeafNodeMaxCells-1)/LeafNodeMaxCells {
+		t.Fatalf("leaves must be half empty before vacuum: %v", leafPages)
+	}
+
+	if err := Vacuum(table, VacuumFillFactor); err != nil {
+		t.Fatalf("vacuum must succeed: %v", err)
+	}
+	leafPages, _ = CountLeafCells(table)
+	if leafPages != (120+LeafNodeMaxCells-1)/LeafNodeMaxCells || table.Pager.NumPages != leafPages+1 {
+		t.Errorf("leaves must be packed: %v leaves of %v pages", leafPages, table.Pager.NumPages)
+	}
+	checkKeys(t, table, 120)
+	if info, _ := os.Stat(dbFile); info.Size() != int64(table.Pager.NumPages)*PageSize {
+		t.Errorf("DB file must be truncated to the pages: %v", info.Size())
+	}
+	if _, err := os.Stat(dbFile + VacuumFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("vacuum file must be removed")
+	}
+
+	// The table keeps working after vacuum
+	insertKeys(table, 121, 130)
+	CloseDB(table)
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 130)
+
+	// The rows which do not fit in the pages leave the table as it was
+	if err := Vacuum(table, 0); err != ErrBulkLoadFull {
+		t.Errorf("130 leaves of 1 cell must not fit: %v", err)
+	}
+	checkKeys(t, table, 130)
+	CloseDB(table)
+	os.Remove(dbFile)
+
+	// Small fill factor builds more levels
+	table = openTableWithKeys(dbFile, keys[:40])
+	if err := Vacuum(table, 0); err != nil {
+		t.Fatalf("vacuum must succeed: %v", err)
+	}
+	if TreeDepth(table) != 5 || table.Pager.NumPages != 40+14+5+2+1 {
+		t.Errorf("40 leaves of 1 cell and nodes of 3 children must have depth 5: %v", TreeDepth(table))
+	}
+	CloseDB(table)
+	table = OpenDB(dbFile)
+	var key uint32 = 0
+	for cursor := CursorBegin(table); !cursor.IsEndOfTable; CursorNext(cursor) {
+		key += 2
+		if CursorKey(cursor) != key || CursorKey(Find(table, key)) != key {
+			t.Fatalf("key %v must be found", key)
+		}
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestRecoverVacuum(t *testing.T) {
+	dbFile := "./RecoverVacuum.db"
+	table := openTableWithKeys(dbFile, []uint32{1, 2, 3})
+	CloseDB(table)
+
+	// A vacuum committed but not copied to the DB file is finished by open
+	var loader *BulkLoader = NewBulkLoader(VacuumFillFactor)
+	loader.Add(&Row{PrimaryID: 1})
+	loader.Add(&Row{PrimaryID: 2})
+	var pages []*Page = loader.Finish()
+	stampFileFormat(pages[0])
+	var content []byte
+	for _, page := range pages {
+		content = append(content, page.Mem[:]...)
+	}
+	ioutil.WriteFile(dbFile+VacuumFileSuffix, content, 0600)
+
+	if _, err := OpenWithOptions(dbFile, &OpenOptions{ReadOnly: true}); err == nil {
+		t.Errorf("read-only open must not read the DB file of unfinished vacuum")
+	}
+	table = OpenDB(dbFile)
+	checkKeys(t, table, 2)
+	if _, err := os.Stat(dbFile + VacuumFileSuffix); !os.IsNotExist(err) {
+		t.Errorf("vacuum file must be removed")
+	}
+	CloseDB(table)
+	os.Remove(dbFile)
+}
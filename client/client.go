@@ -0,0 +1,230 @@
+// Package client is the Go client of tiny-rdb server, see package server for the protocol.
+//
+//	c, err := client.Dial("localhost:5433")
+//	result, err := c.Query("select where id > 1")
+//	for _, row := range result.Rows {
+//		fmt.Println(row...)
+//	}
+//	err = c.Close()
+//
+// A Client is a session, it must not be used by goroutines concurrently. Dial a client for each goroutine.
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// const var
+const (
+	ProtocolVersion = 1
+	DialTimeout     = 10 * time.Second
+)
+
+// ServerError error reported by the server, the session is still usable
+type ServerError struct {
+	Message string
+}
+
+func (err *ServerError) Error() string {
+	return "tinyrdb server: " + err.Message
+}
+
+// ErrProtocol the response does not follow the protocol
+var ErrProtocol = errors.New("tinyrdb client: protocol error")
+
+// Result result of a statement, Columns is nil for the statements which return no rows
+type Result struct {
+	Columns      []string
+	Rows         [][]interface{} // integers are int64, NULL is nil
+	RowsAffected int64
+	LastInsertID int64
+}
+
+// Client a session connected to tiny-rdb server
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// Dial Connect to the server
+func Dial(address string) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var client *Client = &Client{conn: conn, reader: bufio.NewReader(conn), writer: bufio.NewWriter(conn)}
+	greeting, err := client.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if greeting != fmt.Sprintf("TINYRDB %v", ProtocolVersion) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: unexpected greeting %q", ErrProtocol, greeting)
+	}
+	return client, nil
+}
+
+func (client *Client) readLine() (string, error) {
+	line, err := client.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (client *Client) request(format string, args ...interface{}) (string, error) {
+	var line string = fmt.Sprintf(format, args...)
+	if strings.ContainsAny(line, "\r\n") {
+		return "", errors.New("tinyrdb client: statement must be one line")
+	}
+	if _, err := client.writer.WriteString(line + "\n"); err != nil {
+		return "", err
+	}
+	if err := client.writer.Flush(); err != nil {
+		return "", err
+	}
+	return client.readLine()
+}
+
+func splitWord(text string) (string, string) {
+	var index int = strings.IndexByte(text, ' ')
+	if index < 0 {
+		return text, ""
+	}
+	return text[:index], text[index+1:]
+}
+
+func decodeJSON(text string, value interface{}) error {
+	var decoder *json.Decoder = json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("%w: %s", ErrProtocol, err.Error())
+	}
+	return nil
+}
+
+// readResult Read the response of a statement
+func (client *Client) readResult(line string) (*Result, error) {
+	kind, rest := splitWord(line)
+	switch kind {
+	case "ERROR":
+		return nil, &ServerError{Message: rest}
+	case "OK":
+		var result *Result = new(Result)
+		if _, err := fmt.Sscanf(rest, "%d %d", &result.RowsAffected, &result.LastInsertID); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrProtocol, line)
+		}
+		return result, nil
+	case "COLUMNS":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrProtocol, line)
+	}
+
+	var result *Result = new(Result)
+	if err := decodeJSON(rest, &result.Columns); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := client.readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		kind, rest := splitWord(line)
+		if kind == "END" {
+			return result, nil
+		}
+		if kind != "ROW" {
+			return nil, fmt.Errorf("%w: %q", ErrProtocol, line)
+		}
+
+		var row []interface{}
+		if err := decodeJSON(rest, &row); err != nil {
+			return nil, err
+		}
+		for i, value := range row {
+			if number, ok := value.(json.Number); ok {
+				if integer, err := number.Int64(); err == nil {
+					row[i] = integer
+				} else {
+					row[i], _ = number.Float64()
+				}
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+}
+
+// Query Run a statement, begin/commit/rollback control the transaction of the session
+func (client *Client) Query(sql string) (*Result, error) {
+	line, err := client.request("QUERY %s", sql)
+	if err != nil {
+		return nil, err
+	}
+	return client.readResult(line)
+}
+
+// Prepare Prepare a statement with placeholders as name, return the num of parameters
+func (client *Client) Prepare(name string, sql string) (int, error) {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return 0, errors.New("tinyrdb client: statement name must be a word")
+	}
+
+	line, err := client.request("PREPARE %s %s", name, sql)
+	if err != nil {
+		return 0, err
+	}
+
+	kind, rest := splitWord(line)
+	if kind == "ERROR" {
+		return 0, &ServerError{Message: rest}
+	}
+	numParams, err := strconv.Atoi(rest)
+	if kind != "PREPARED" || err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrProtocol, line)
+	}
+	return numParams, nil
+}
+
+// Execute Run the prepared statement with parameters, they are numbers, strings, booleans or nil
+func (client *Client) Execute(name string, params ...interface{}) (*Result, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := client.request("EXECUTE %s %s", name, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return client.readResult(line)
+}
+
+// Deallocate Drop the prepared statement
+func (client *Client) Deallocate(name string) error {
+	line, err := client.request("DEALLOCATE %s", name)
+	if err != nil {
+		return err
+	}
+	_, err = client.readResult(line)
+	return err
+}
+
+// Close Quit the session and close the connection, the active transaction is rolled back
+func (client *Client) Close() error {
+	client.request("QUIT")
+	return client.conn.Close()
+}
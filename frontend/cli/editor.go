@@ -0,0 +1,426 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted the line is abandoned by Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// MaxHistory how many lines of history are kept
+const MaxHistory = 1000
+
+// Keys of line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+
+	// Keys sent as escape sequences are mapped to the runes of private use area
+	keyUp     = 0xE000
+	keyDown   = 0xE001
+	keyRight  = 0xE002
+	keyLeft   = 0xE003
+	keyHome   = 0xE004
+	keyEnd    = 0xE005
+	keyDelete = 0xE006
+	keyOther  = 0xE007
+)
+
+// Completer Get the candidates of the word at the end of text, they replace the text from the rune index start
+type Completer func(text string) (candidates []string, start int)
+
+// LineEditor a readline-style editor over raw terminal mode, it has history and tab completion.
+//
+//	Left/Right Ctrl-B/Ctrl-F   Move the cursor       Home/End Ctrl-A/Ctrl-E   Move to the start/end of line
+//	Up/Down Ctrl-P/Ctrl-N      Walk the history       Ctrl-R                   Search the history backward
+//	Backspace/Delete Ctrl-D    Delete a char          Ctrl-W Ctrl-U Ctrl-K     Delete the word/start/end of line
+//	Tab                        Complete the word      Ctrl-L                   Clear the screen
+//	Ctrl-C                     Abandon the line       Ctrl-D on empty line     End of input
+type LineEditor struct {
+	Complete    Completer
+	History     []string
+	HistoryFile string // lines are appended to it as they are entered, empty means no persistent history
+
+	reader *bufio.Reader
+	writer io.Writer
+	fd     int // the terminal put in raw mode while a line is read, -1 if input is not a terminal
+}
+
+// lineState the line being edited
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// NewLineEditor Make a line editor of terminal, the history is loaded from historyFile
+func NewLineEditor(in *os.File, out io.Writer, historyFile string) *LineEditor {
+	var editor *LineEditor = newLineEditor(in, out, int(in.Fd()))
+	editor.HistoryFile = historyFile
+	editor.loadHistory()
+	return editor
+}
+
+func newLineEditor(in io.Reader, out io.Writer, fd int) *LineEditor {
+	return &LineEditor{reader: bufio.NewReader(in), writer: out, fd: fd}
+}
+
+// HistoryFileName Get the path of persistent history, ~/.tiny_rdb_history
+func HistoryFileName() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home + string(os.PathSeparator) + ".tiny_rdb_history"
+}
+
+func (editor *LineEditor) loadHistory() {
+	if editor.HistoryFile == "" {
+		return
+	}
+	file, err := os.Open(editor.HistoryFile)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var scanner *bufio.Scanner = bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			editor.History = append(editor.History, line)
+		}
+	}
+	if len(editor.History) > MaxHistory {
+		editor.History = editor.History[len(editor.History)-MaxHistory:]
+	}
+}
+
+// AddHistory Add the line to history, the line equal to the last one is skipped
+func (editor *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(editor.History) > 0 && editor.History[len(editor.History)-1] == line) {
+		return
+	}
+	editor.History = append(editor.History, line)
+	if len(editor.History) > MaxHistory {
+		editor.History = editor.History[1:]
+	}
+
+	if editor.HistoryFile == "" {
+		return
+	}
+	file, err := os.OpenFile(editor.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(file, line)
+	file.Close()
+}
+
+// ReadLine Read a line with editing, return io.EOF at the end of input and ErrInterrupted if the line is abandoned.
+// It reads plain lines if the terminal can not be put in raw mode.
+func (editor *LineEditor) ReadLine(prompt string) (string, error) {
+	if editor.fd >= 0 {
+		state, err := makeRaw(editor.fd)
+		if err != nil {
+			fmt.Fprint(editor.writer, prompt)
+			line, err := editor.reader.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			return strings.TrimRight(line, "\r\n"), err
+		}
+		defer restoreTerminal(editor.fd, state)
+	}
+
+	var line *lineState = &lineState{prompt: prompt}
+	var historyIndex int = len(editor.History)
+	var editing []rune // the line being edited while walking the history
+	editor.refresh(line)
+	for {
+		key, err := editor.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(editor.writer, "\r\n")
+			return string(line.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(editor.writer, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(line.buf) == 0 {
+				fmt.Fprint(editor.writer, "\r\n")
+				return "", io.EOF
+			}
+			line.deleteAt(line.pos)
+		case keyDelete:
+			line.deleteAt(line.pos)
+		case keyCtrlH, keyBackspace:
+			if line.pos > 0 {
+				line.pos--
+				line.deleteAt(line.pos)
+			}
+		case keyCtrlA, keyHome:
+			line.pos = 0
+		case keyCtrlE, keyEnd:
+			line.pos = len(line.buf)
+		case keyCtrlB, keyLeft:
+			if line.pos > 0 {
+				line.pos--
+			}
+		case keyCtrlF, keyRight:
+			if line.pos < len(line.buf) {
+				line.pos++
+			}
+		case keyCtrlK:
+			line.buf = line.buf[:line.pos]
+		case keyCtrlU:
+			line.buf = line.buf[line.pos:]
+			line.pos = 0
+		case keyCtrlW:
+			var start int = line.pos
+			for start > 0 && line.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line.buf[start-1] != ' ' {
+				start--
+			}
+			line.buf = append(line.buf[:start], line.buf[line.pos:]...)
+			line.pos = start
+		case keyCtrlL:
+			fmt.Fprint(editor.writer, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp, keyCtrlN, keyDown:
+			var next int = historyIndex - 1
+			if key == keyCtrlN || key == keyDown {
+				next = historyIndex + 1
+			}
+			if next < 0 || next > len(editor.History) {
+				break
+			}
+			if historyIndex == len(editor.History) {
+				editing = append([]rune(nil), line.buf...)
+			}
+			historyIndex = next
+			if historyIndex == len(editor.History) {
+				line.buf = editing
+			} else {
+				line.buf = []rune(editor.History[historyIndex])
+			}
+			line.pos = len(line.buf)
+		case keyTab:
+			editor.complete(line)
+		case keyCtrlR:
+			enter, err := editor.search(line)
+			if err != nil {
+				return "", err
+			}
+			if enter {
+				fmt.Fprint(editor.writer, "\r\n")
+				return string(line.buf), nil
+			}
+		default:
+			if key >= ' ' && key < keyUp {
+				line.insert([]rune{key})
+			}
+		}
+		editor.refresh(line)
+	}
+}
+
+// readKey Read a key, the escape sequences of cursor keys are mapped to single keys.
+// A terminal writes an escape sequence at once, so an ESC with nothing buffered after it is the Escape key alone,
+// it is returned instead of waiting for the next key.
+func (editor *LineEditor) readKey() (rune, error) {
+	key, _, err := editor.reader.ReadRune()
+	if err != nil || key != keyEscape {
+		return key, err
+	}
+	if editor.reader.Buffered() == 0 {
+		return keyEscape, nil
+	}
+
+	next, _, err := editor.reader.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyOther, nil
+	}
+
+	var sequence []rune
+	for {
+		char, _, err := editor.reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		sequence = append(sequence, char)
+		if (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') || char == '~' || len(sequence) > 8 {
+			break
+		}
+	}
+
+	switch string(sequence) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDelete, nil
+	}
+	return keyOther, nil
+}
+
+// refresh Redraw the line and put the cursor at its position
+func (editor *LineEditor) refresh(line *lineState) {
+	var column int = utf8.RuneCountInString(line.prompt) + line.pos
+	fmt.Fprintf(editor.writer, "\r%s%s\x1b[K\r", line.prompt, string(line.buf))
+	if column > 0 {
+		fmt.Fprintf(editor.writer, "\x1b[%dC", column)
+	}
+}
+
+func (line *lineState) insert(runes []rune) {
+	var buf []rune = make([]rune, 0, len(line.buf)+len(runes))
+	buf = append(append(append(buf, line.buf[:line.pos]...), runes...), line.buf[line.pos:]...)
+	line.buf = buf
+	line.pos += len(runes)
+}
+
+func (line *lineState) deleteAt(pos int) {
+	if pos < len(line.buf) {
+		line.buf = append(line.buf[:pos], line.buf[pos+1:]...)
+	}
+}
+
+// complete Complete the word before the cursor. A single candidate is completed with a space,
+// several candidates are completed to their common prefix and listed if it adds nothing.
+func (editor *LineEditor) complete(line *lineState) {
+	if editor.Complete == nil {
+		return
+	}
+	candidates, start := editor.Complete(string(line.buf[:line.pos]))
+	if len(candidates) == 0 || start < 0 || start > line.pos {
+		fmt.Fprint(editor.writer, "\a")
+		return
+	}
+
+	var replacement string = candidates[0] + " "
+	if len(candidates) > 1 {
+		replacement = commonPrefix(candidates)
+		if utf8.RuneCountInString(replacement) <= line.pos-start {
+			fmt.Fprintf(editor.writer, "\r\n%s\r\n", strings.Join(candidates, "  "))
+			return
+		}
+	}
+
+	var rest []rune = line.buf[line.pos:]
+	line.buf = line.buf[:start]
+	line.pos = start
+	line.insert(append([]rune(replacement), rest...))
+	line.pos -= len(rest)
+}
+
+func commonPrefix(words []string) string {
+	var prefix []rune = []rune(words[0])
+	for _, word := range words[1:] {
+		var runes []rune = []rune(word)
+		var i int
+		for i < len(prefix) && i < len(runes) && prefix[i] == runes[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	return string(prefix)
+}
+
+// search Search the history backward for the lines containing the typed text (Ctrl-R). Ctrl-R again finds the older
+// match, Enter runs the match, Ctrl-G cancels and the other keys leave the match in the line.
+// Return true if the match is entered.
+func (editor *LineEditor) search(line *lineState) (bool, error) {
+	var query []rune
+	var index int = len(editor.History)
+	var match string
+	var failing bool
+
+	var find = func(from int) {
+		if from >= len(editor.History) {
+			from = len(editor.History) - 1
+		}
+		for i := from; i >= 0 && i < len(editor.History); i-- {
+			if strings.Contains(editor.History[i], string(query)) {
+				index, match, failing = i, editor.History[i], false
+				return
+			}
+		}
+		failing = true
+	}
+
+	for {
+		var prompt string = "(reverse-i-search)`"
+		if failing {
+			prompt = "(failing reverse-i-search)`"
+		}
+		editor.refresh(&lineState{prompt: prompt + string(query) + "': ", buf: []rune(match)})
+
+		key, err := editor.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case key == keyCtrlR:
+			if len(query) > 0 {
+				find(index - 1)
+			}
+		case key == keyCtrlH || key == keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(editor.History) - 1)
+			}
+		case key == keyCtrlG || key == keyCtrlC:
+			return false, nil
+		case key == '\r' || key == '\n':
+			line.buf = []rune(match)
+			line.pos = len(line.buf)
+			return true, nil
+		case key >= ' ' && key < keyUp:
+			query = append(query, key)
+			find(index)
+		default:
+			line.buf = []rune(match)
+			line.pos = len(line.buf)
+			return false, nil
+		}
+	}
+}
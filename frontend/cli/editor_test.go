@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	var keys string = "selct\x1b[D\x1b[De\x05 wher\t1\r" + // edit in the middle and complete
+		"\x1b[A\x17\x17\r" + // recall the history and delete words
+		"abc\x03" + // abandon the line
+		"\x12sel\x12\r" + // search the history for the older match
+		"xyz\x01\x0b\x04"
+	var editor *LineEditor = newLineEditor(strings.NewReader(keys), ioutil.Discard, -1)
+	editor.Complete = func(text string) ([]string, int) {
+		if strings.HasSuffix(text, "wher") {
+			return []string{"where"}, len(text) - 4
+		}
+		return nil, 0
+	}
+
+	var expected = []struct {
+		line string
+		err  error
+	}{
+		{"select where 1", nil},
+		{"select ", nil},
+		{"", ErrInterrupted},
+		{"select where 1", nil},
+		{"", io.EOF},
+	}
+	for _, e := range expected {
+		line, err := editor.ReadLine("> ")
+		if line != e.line || err != e.err {
+			t.Errorf("line must be %q %v, but it is %q %v", e.line, e.err, line, err)
+		}
+		if err == nil {
+			editor.AddHistory(line)
+		}
+	}
+}
+
+func TestLineEditorEscape(t *testing.T) {
+	reader, writer := io.Pipe()
+	var editor *LineEditor = newLineEditor(reader, ioutil.Discard, -1)
+	go func() {
+		// The Escape key alone does not wait for the next key, which is not taken as part of a sequence
+		writer.Write([]byte("ab\x1b"))
+		writer.Write([]byte("c\r"))
+		writer.Close()
+	}()
+	if line, err := editor.ReadLine("> "); line != "abc" || err != nil {
+		t.Errorf("line must be %q, but it is %q %v", "abc", line, err)
+	}
+}
+
+func TestLineEditorHistoryFile(t *testing.T) {
+	historyFile := "./History.txt"
+	os.Remove(historyFile)
+	var editor *LineEditor = NewLineEditor(os.Stdin, ioutil.Discard, historyFile)
+	editor.AddHistory("select")
+	editor.AddHistory("select")
+	editor.AddHistory("#mode csv")
+
+	editor = NewLineEditor(os.Stdin, ioutil.Discard, historyFile)
+	if len(editor.History) != 2 || editor.History[1] != "#mode csv" {
+		t.Errorf("history must be loaded from the file: %q", editor.History)
+	}
+	os.Remove(historyFile)
+}
+
+func TestCommonPrefix(t *testing.T) {
+	if prefix := commonPrefix([]string{"select", "selection", "sel"}); prefix != "sel" {
+		t.Errorf("common prefix must be sel: %v", prefix)
+	}
+}
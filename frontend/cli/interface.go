@@ -3,6 +3,7 @@ package cli
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -11,25 +12,75 @@ import (
 type InputBuffer struct {
 	Buffer string
 	BufLen int
+	Reader *bufio.Reader // kept across reads, so the lines buffered from a pipe are not dropped
+	Editor *LineEditor   // reads the lines of terminal with editing if it is not nil
 }
 
-// NewInputBuffer Make new input buffer
+// NewInputBuffer Make new input buffer reading stdin
 func NewInputBuffer() *InputBuffer {
-	return new(InputBuffer)
+	return NewInputBufferFrom(os.Stdin)
 }
 
+// NewInputBufferFrom Make new input buffer reading the reader
+func NewInputBufferFrom(reader io.Reader) *InputBuffer {
+	var buf *InputBuffer = new(InputBuffer)
+	buf.Reader = bufio.NewReader(reader)
+	return buf
+}
+
+// NewInputBufferOf Make new input buffer holding the text
+func NewInputBufferOf(text string) *InputBuffer {
+	var buf *InputBuffer = new(InputBuffer)
+	buf.Buffer = text
+	buf.BufLen = len(text)
+	return buf
+}
+
+// CLI Prompts, the continue prompt is of the continued lines of statement
+const (
+	Prompt         = "tiny-rdb> "
+	ContinuePrompt = "     ...> "
+)
+
 // PrintPrompt Print CLI Prompt
 func PrintPrompt() {
-	fmt.Printf("tiny-rdb> ")
+	fmt.Printf(Prompt)
 }
 
-// ReadInput Read input line from stdin
-func ReadInput(buf *InputBuffer) {
-	reader := bufio.NewReader(os.Stdin)
-	buf.Buffer, _ = reader.ReadString('\n')
+// ReadInput Read input line, return io.EOF if there are no more lines
+func ReadInput(buf *InputBuffer) error {
+	line, err := buf.Reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		// The last line without line break
+		err = nil
+	}
 
-	buf.Buffer = strings.TrimSpace(buf.Buffer)
+	buf.Buffer = strings.TrimSpace(line)
 	buf.BufLen = len(buf.Buffer)
+	return err
+}
+
+// ReadInputWithPrompt Print the prompt and read input line, the line editor draws the prompt itself.
+// Return ErrInterrupted if the line is abandoned in the editor.
+func ReadInputWithPrompt(buf *InputBuffer, prompt string) error {
+	if buf.Editor == nil {
+		fmt.Print(prompt)
+		return ReadInput(buf)
+	}
+
+	line, err := buf.Editor.ReadLine(prompt)
+	buf.Buffer = strings.TrimSpace(line)
+	buf.BufLen = len(buf.Buffer)
+	if err == nil {
+		buf.Editor.AddHistory(buf.Buffer)
+	}
+	return err
+}
+
+// IsTerminal Check if the file is a terminal, rather than a pipe or a regular file
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func IsRawCommand(cmd *string) bool {
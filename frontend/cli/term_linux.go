@@ -0,0 +1,14 @@
+//go:build linux
+// +build linux
+
+package cli
+
+import (
+	"syscall"
+)
+
+// ioctl requests of getting and setting the terminal settings
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package cli
+
+import (
+	"errors"
+)
+
+type terminalState struct{}
+
+// makeRaw Raw mode is only supported on linux and the BSDs, the line editor falls back to reading plain lines
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package cli
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminalState the settings of terminal to restore after a line is read
+type terminalState struct {
+	termios syscall.Termios
+}
+
+func ioctlTermios(fd int, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw Put the terminal in raw mode, the keys are read one by one without echo.
+// Output processing is kept, so "\n" still moves to the start of next line.
+func makeRaw(fd int) (*terminalState, error) {
+	var state *terminalState = new(terminalState)
+	if err := ioctlTermios(fd, ioctlGetTermios, &state.termios); err != nil {
+		return nil, err
+	}
+
+	var raw syscall.Termios = state.termios
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// restoreTerminal Restore the terminal settings saved by makeRaw
+func restoreTerminal(fd int, state *terminalState) error {
+	return ioctlTermios(fd, ioctlSetTermios, &state.termios)
+}
@@ -0,0 +1,59 @@
+package sql
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Keywords keywords of statements, they are completed in the REPL
+var Keywords = []string{
+	"and", "asc", "autoincrement", "begin", "by", "check", "commit", "create", "default", "delete", "desc",
+	"explain", "insert", "int", "integer", "is", "key", "last_insert_id", "like", "not", "null", "or", "order",
+	"primary", "rollback", "select", "sequence", "table", "text", "transaction", "unique", "update", "vacuum", "varchar", "where",
+}
+
+// Complete Get the candidates of the word at the end of text and the rune index the word starts:
+// raw commands and their arguments, keywords, the table name and column names
+func (shell *Shell) Complete(text string) ([]string, int) {
+	var start int = strings.LastIndexAny(text, " \t(),=<>!") + 1
+	var word string = text[start:]
+	var runeStart int = utf8.RuneCountInString(text[:start])
+
+	var words []string
+	var fields []string = strings.Fields(text)
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(text), "#"):
+		if len(fields) == 1 && start == strings.Index(text, "#") {
+			words = RawCommandNames()
+		} else if command := LookupRawCommand(fields[0]); command != nil && (len(fields) == 1 || (len(fields) == 2 && word != "")) {
+			words = command.Arguments
+			if command.TableArgument {
+				shell.Table.RWLock.RLock()
+				words = append(words, shell.Table.Schema.TableName)
+				shell.Table.RWLock.RUnlock()
+			}
+		}
+	case word == "":
+		return nil, runeStart
+	default:
+		words = append(words, Keywords...)
+		shell.Table.RWLock.RLock()
+		words = append(words, shell.Table.Schema.TableName)
+		for _, column := range shell.Table.Schema.Columns {
+			words = append(words, column.Name)
+		}
+		shell.Table.RWLock.RUnlock()
+	}
+
+	var candidates []string
+	var seen map[string]bool = make(map[string]bool)
+	for _, candidate := range words {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(word)) && !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates, runeStart
+}
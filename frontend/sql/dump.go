@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"tiny-rdb/backend"
+)
+
+// Dump Write the create statement of table and an insert statement for each row, by a full scan of the snapshot.
+// Running the dump as a script in an empty database makes the same table, it does not depend on the page layout.
+func Dump(table *backend.Table, output io.Writer) error {
+	var snapshot *backend.Table = backend.Snapshot(SessionTable(table))
+	var writer *bufio.Writer = bufio.NewWriter(output)
+
+	fmt.Fprintln(writer, "begin transaction;")
+	fmt.Fprintln(writer, dumpSchemaSQL(snapshot.Schema)+";")
+	var cursor *backend.Cursor = backend.CursorBegin(snapshot)
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+		fmt.Fprintln(writer, InsertSQL(&row)+";")
+	}
+	fmt.Fprintln(writer, "commit;")
+	return writer.Flush()
+}
+
+// dumpSchemaSQL Get the create statement of schema with the AUTOINCREMENT sequence, the rows replayed after it
+// raise the sequence only to the largest id left in the table
+func dumpSchemaSQL(schema *backend.Schema) string {
+	if schema.Columns[backend.ColumnPrimaryID].AutoIncrement && schema.Sequence > 0 {
+		return fmt.Sprintf("%s sequence %v", SchemaSQL(schema), schema.Sequence)
+	}
+	return SchemaSQL(schema)
+}
+
+// InsertSQL Get the insert statement of row, NULL columns are the keyword null
+func InsertSQL(row *backend.Row) string {
+	var values []string = []string{"insert"}
+	for _, value := range RowValues(row) {
+		switch value := value.(type) {
+		case nil:
+			values = append(values, "null")
+		case int64:
+			values = append(values, strconv.FormatInt(value, 10))
+		case string:
+			values = append(values, QuoteString(value))
+		}
+	}
+	return strings.Join(values, " ")
+}
@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+)
+
+func TestDump(t *testing.T) {
+	dbFile := "./Dump.db"
+	restoredFile := "./DumpRestored.db"
+	table := backend.OpenDB(dbFile)
+	var errors bytes.Buffer
+	var shell *Shell = &Shell{Table: table, Errors: &errors}
+	shell.RunScript("create table people (id integer primary key, name text not null default 'x', email text unique);" +
+		"insert 1 'o''neil' null; insert 2 'multi\nline' 'e@x'; insert 3;")
+
+	var dump bytes.Buffer
+	if err := Dump(table, &dump); err != nil {
+		t.Fatalf("dump must succeed: %v", err)
+	}
+	var expected string = "" +
+		"begin transaction;\n" +
+		"create table people (id integer primary key, name text not null default 'x', email text unique);\n" +
+		"insert 1 'o''neil' null;\n" +
+		"insert 2 'multi\nline' 'e@x';\n" +
+		"insert 3 'x' null;\n" +
+		"commit;\n"
+	if dump.String() != expected {
+		t.Errorf("dump must be\n%v\nbut it is\n%v", expected, dump.String())
+	}
+
+	// Replaying the dump in an empty database makes the same table
+	restored := backend.OpenDB(restoredFile)
+	shell = &Shell{Table: restored, Errors: &errors}
+	if !shell.RunScript(dump.String()) || shell.Failed {
+		t.Errorf("dump must be replayed: %q", errors.String())
+	}
+	var restoredDump bytes.Buffer
+	Dump(restored, &restoredDump)
+	if restoredDump.String() != dump.String() {
+		t.Errorf("restored table must be the same:\n%v", restoredDump.String())
+	}
+
+	backend.CloseDB(table)
+	backend.CloseDB(restored)
+	for _, file := range []string{dbFile, restoredFile} {
+		os.Remove(file)
+		os.Remove(backend.SchemaFileName(file))
+	}
+}
+
+func TestDumpSequence(t *testing.T) {
+	dbFile := "./DumpSequence.db"
+	restoredFile := "./DumpSequenceRestored.db"
+	table := backend.OpenDB(dbFile)
+	var errors bytes.Buffer
+	var shell *Shell = &Shell{Table: table, Errors: &errors}
+	shell.RunScript("create table people (id integer primary key autoincrement, name text, email text);" +
+		"insert null a; insert null b;")
+
+	// The largest id ever assigned is kept by the table option, so the ids of the rows gone are not reused
+	// after replaying
+	table.RWLock.Lock()
+	table.Schema.Sequence = 3
+	table.RWLock.Unlock()
+	var dump bytes.Buffer
+	Dump(table, &dump)
+	var expected string = "" +
+		"begin transaction;\n" +
+		"create table people (id integer primary key autoincrement, name text, email text) sequence 3;\n" +
+		"insert 1 'a' null;\n" +
+		"insert 2 'b' null;\n" +
+		"commit;\n"
+	if dump.String() != expected {
+		t.Errorf("dump must be\n%v\nbut it is\n%v", expected, dump.String())
+	}
+
+	restored := backend.OpenDB(restoredFile)
+	shell = &Shell{Table: restored, Errors: &errors}
+	if !shell.RunScript(dump.String()+"insert null d;") || shell.Failed {
+		t.Errorf("dump must be replayed: %q", errors.String())
+	}
+	if restored.Schema.Sequence != 4 || restored.LastInsertID != 4 {
+		t.Errorf("the id after the sequence must be assigned: %v %v", restored.Schema.Sequence, restored.LastInsertID)
+	}
+
+	// The sequence is only for the AUTOINCREMENT primary key
+	var statement Statement
+	inputBuffer := cli.InputBuffer{Buffer: "create table t (id integer primary key, name text, email text) sequence 3"}
+	if PrepareStatement(&inputBuffer, &statement) != PrepareSyntaxError {
+		t.Errorf("sequence must need AUTOINCREMENT")
+	}
+
+	backend.CloseDB(table)
+	backend.CloseDB(restored)
+	for _, file := range []string{dbFile, restoredFile} {
+		os.Remove(file)
+		os.Remove(backend.SchemaFileName(file))
+	}
+}
@@ -0,0 +1,214 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"tiny-rdb/backend"
+)
+
+// PlanNode one operator of the query plan, likes a node of operator tree
+type PlanNode struct {
+	Detail        string
+	EstimatedRows uint32
+	Children      []*PlanNode
+}
+
+// PlanStatement Build the operator tree the engine would run for the statement without executing it
+func PlanStatement(table *backend.Table, statement *Statement) *PlanNode {
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+
+	var depth uint32 = backend.TreeDepth(table)
+	leafPages, numCells := backend.CountLeafCells(table)
+
+	switch statement.Type {
+	case InsertStatement:
+		var key uint32 = statement.RowToInsert.PrimaryID
+		var keyDetail string = fmt.Sprintf("key=%v", key)
+		if statement.AutoID {
+			key, _ = NextPrimaryID(table)
+			keyDetail = fmt.Sprintf("key=%v (assigned from max key of rightmost leaf)", key)
+			if table.Schema.Columns[backend.ColumnPrimaryID].AutoIncrement {
+				keyDetail = fmt.Sprintf("key=%v (assigned from AUTOINCREMENT sequence)", key)
+			}
+		}
+		var cursor *backend.Cursor = backend.Find(table, key)
+		var page *backend.Page = backend.GetPage(table.Pager, cursor.PageNum)
+		var leafCells uint32 = *backend.LeafNodeNumCells(page.Mem[:])
+
+		var insert *PlanNode = &PlanNode{EstimatedRows: 1}
+		if leafCells >= backend.LeafNodeMaxCells {
+			insert.Detail = fmt.Sprintf("SplitAndInsertLeafNode (leaf page %v is full: %v/%v cells)", cursor.PageNum, leafCells, backend.LeafNodeMaxCells)
+		} else {
+			insert.Detail = fmt.Sprintf("InsertLeafNode (leaf page %v: %v/%v cells)", cursor.PageNum, leafCells, backend.LeafNodeMaxCells)
+		}
+
+		var seek *PlanNode = &PlanNode{
+			Detail:        fmt.Sprintf("SEEK primary key using Find(key=%v) -> leaf page %v, cell %v (tree depth %v)", key, cursor.PageNum, cursor.CellNum, depth),
+			EstimatedRows: 1,
+			Children:      []*PlanNode{{Detail: "CHECK duplicate key", EstimatedRows: 1}},
+		}
+
+		return &PlanNode{
+			Detail:        "INSERT " + keyDetail,
+			EstimatedRows: 1,
+			Children:      []*PlanNode{seek, constraintsPlan(table), insert},
+		}
+	case UpdateStatement:
+		var key uint32 = statement.RowToUpdate.PrimaryID
+		var cursor *backend.Cursor = backend.Find(table, key)
+		var seek *PlanNode = &PlanNode{
+			Detail:        fmt.Sprintf("SEEK primary key using Find(key=%v) -> leaf page %v, cell %v (tree depth %v)", key, cursor.PageNum, cursor.CellNum, depth),
+			EstimatedRows: 1,
+		}
+		return &PlanNode{
+			Detail:        fmt.Sprintf("UPDATE key=%v in place", key),
+			EstimatedRows: 1,
+			Children:      []*PlanNode{seek, constraintsPlan(table)},
+		}
+	case SelectStatement:
+		if statement.SelectLastInsertID {
+			return &PlanNode{Detail: "LAST_INSERT_ID of table handle", EstimatedRows: 1}
+		}
+		var scan *PlanNode = selectScanPlan(table, statement, leafPages, numCells, depth)
+		var estimatedRows uint32 = scan.EstimatedRows
+		if statement.Where != nil {
+			// Selectivity of predicate is unknown, so the estimated rows is the upper bound
+			scan = &PlanNode{
+				Detail:        fmt.Sprintf("FILTER %v", statement.WhereText),
+				EstimatedRows: estimatedRows,
+				Children:      []*PlanNode{scan},
+			}
+		}
+		if !isKeyOrder(statement, table.Schema) {
+			scan = &PlanNode{
+				Detail:        fmt.Sprintf("SORT by %v in memory", statement.OrderBy),
+				EstimatedRows: estimatedRows,
+				Children:      []*PlanNode{scan},
+			}
+		}
+		return &PlanNode{
+			Detail:        "SELECT",
+			EstimatedRows: estimatedRows,
+			Children:      []*PlanNode{scan},
+		}
+	case CreateStatement:
+		return &PlanNode{Detail: fmt.Sprintf("CREATE TABLE %v (write schema file)", statement.SchemaToCreate.TableName)}
+	case BeginStatement:
+		return &PlanNode{Detail: "BEGIN TRANSACTION (share pages of committed snapshot, copy them on write)"}
+	case CommitStatement:
+		return &PlanNode{Detail: "COMMIT TRANSACTION (install changed pages unless they conflict, write pages to DB file)"}
+	case RollbackStatement:
+		return &PlanNode{Detail: "ROLLBACK TRANSACTION (discard copied pages)"}
+	case VacuumStatement:
+		var leafCells uint32 = backend.LeafCellsOfFillFactor(backend.VacuumFillFactor)
+		return &PlanNode{
+			Detail: fmt.Sprintf("VACUUM (rebuild %v leaf pages into %v, replace DB file)", leafPages,
+				(numCells+leafCells-1)/leafCells),
+			EstimatedRows: numCells,
+		}
+	}
+
+	return &PlanNode{Detail: "UNSUPPORTED statement"}
+}
+
+// selectScanPlan Plan of reading rows from B-tree, a bounded range scan if the predicate limits the primary key
+func selectScanPlan(table *backend.Table, statement *Statement, leafPages uint32, numCells uint32, depth uint32) *PlanNode {
+	if !ResolveExpr(statement.Where, table.Schema) {
+		return &PlanNode{Detail: "ERROR no such column"}
+	}
+
+	var descending bool = statement.Descending && statement.OrderBy == table.Schema.Columns[backend.ColumnPrimaryID].Name
+	var keyRange KeyRange = PredicateKeyRange(statement.Where, table.Schema)
+	if keyRange.IsEmpty {
+		return &PlanNode{Detail: "EMPTY key range, no row is read"}
+	}
+
+	if IsFullRange(keyRange) {
+		if descending {
+			return &PlanNode{
+				Detail:        fmt.Sprintf("SCAN table in reverse using CursorLast/CursorPrev (leaf pages %v, tree depth %v)", leafPages, depth),
+				EstimatedRows: numCells,
+			}
+		}
+		return &PlanNode{
+			Detail:        fmt.Sprintf("SCAN table using CursorBegin/CursorNext (leaf pages %v, tree depth %v)", leafPages, depth),
+			EstimatedRows: numCells,
+		}
+	}
+
+	// Keys are unique integers, so a range can not hold more rows than its width
+	var estimatedRows uint32 = numCells
+	if uint64(keyRange.Upper)-uint64(keyRange.Lower)+1 < uint64(numCells) {
+		estimatedRows = keyRange.Upper - keyRange.Lower + 1
+	}
+
+	if descending {
+		return &PlanNode{
+			Detail:        fmt.Sprintf("SEARCH table in reverse using SeekLE(key=%v)/CursorPrev bounded by key>=%v (tree depth %v)", keyRange.Upper, keyRange.Lower, depth),
+			EstimatedRows: estimatedRows,
+		}
+	}
+	return &PlanNode{
+		Detail:        fmt.Sprintf("SEARCH table using SeekGE(key=%v)/CursorNext bounded by key<=%v (tree depth %v)", keyRange.Lower, keyRange.Upper, depth),
+		EstimatedRows: estimatedRows,
+	}
+}
+
+// constraintsPlan Plan of checking the constraints of the row to write
+func constraintsPlan(table *backend.Table) *PlanNode {
+	var checks []string
+	var scanUnique bool = false
+	for _, column := range table.Schema.Columns {
+		if column.NotNull && !column.PrimaryKey {
+			checks = append(checks, column.Name+" NOT NULL")
+		}
+		if column.Check != "" {
+			checks = append(checks, "CHECK ("+column.Check+")")
+		}
+		if column.Unique && !column.PrimaryKey {
+			checks = append(checks, column.Name+" UNIQUE")
+			scanUnique = true
+		}
+	}
+
+	if len(checks) == 0 {
+		return &PlanNode{Detail: "CHECK constraints: none", EstimatedRows: 1}
+	}
+
+	var node *PlanNode = &PlanNode{Detail: "CHECK constraints: " + strings.Join(checks, ", "), EstimatedRows: 1}
+	if scanUnique {
+		_, numCells := backend.CountLeafCells(table)
+		node.Children = []*PlanNode{{Detail: "SCAN table for UNIQUE columns (no secondary index)", EstimatedRows: numCells}}
+	}
+	return node
+}
+
+// FormatPlan Format the operator tree line by line
+func FormatPlan(plan *PlanNode) []string {
+	var lines []string = []string{"QUERY PLAN"}
+	return formatPlanNode(lines, plan, "", true)
+}
+
+func formatPlanNode(lines []string, node *PlanNode, prefix string, isLast bool) []string {
+	var branch, childPrefix string
+	if isLast {
+		branch = "`--"
+		childPrefix = prefix + "   "
+	} else {
+		branch = "|--"
+		childPrefix = prefix + "|  "
+	}
+
+	lines = append(lines, fmt.Sprintf("%v%v%v (~%v rows)", prefix, branch, node.Detail, node.EstimatedRows))
+	for i, child := range node.Children {
+		lines = formatPlanNode(lines, child, childPrefix, i == len(node.Children)-1)
+	}
+	return lines
+}
+
+// RunExplain print the query plan of the statement
+func RunExplain(table *backend.Table, statement *Statement) ExecuteResult {
+	fmt.Println(strings.Join(FormatPlan(PlanStatement(table, statement)), "\n"))
+	return ExecuteSuccess
+}
@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+	"tiny-rdb/util"
+)
+
+func TestExplain(t *testing.T) {
+	dbFile := "./Explain.db"
+	table := backend.OpenDB(dbFile)
+	inputBuffer := cli.NewInputBuffer()
+	InsertNum := uint32(30)
+	for i := uint32(0); i < InsertNum; i++ {
+		inputBuffer.Buffer = fmt.Sprintf("insert %d %s %s", i, util.RandString(8), util.RandString(8)+"@google.com")
+		inputBuffer.BufLen = len(inputBuffer.Buffer)
+
+		var statement Statement
+		if PrepareStatement(inputBuffer, &statement) != PrepareSuccess {
+			t.Errorf("result must be success")
+		}
+		RunStatement(table, &statement)
+	}
+
+	inputBuffer.Buffer = "explain select"
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+	var selectState Statement
+	if PrepareStatement(inputBuffer, &selectState) != PrepareSuccess {
+		t.Errorf("explain select must be success")
+	}
+
+	if !selectState.Explain || selectState.Type != SelectStatement {
+		t.Errorf("statement must be explained select statement")
+	}
+
+	lines := FormatPlan(PlanStatement(table, &selectState))
+	if len(lines) != 3 || !strings.Contains(lines[2], "SCAN") || !strings.Contains(lines[2], fmt.Sprintf("~%v rows", InsertNum)) {
+		t.Errorf("select plan is wrong: %v", lines)
+	}
+
+	inputBuffer.Buffer = "explain insert 100 chen we@qq.com"
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+	var insertState Statement
+	if PrepareStatement(inputBuffer, &insertState) != PrepareSuccess {
+		t.Errorf("explain insert must be success")
+	}
+
+	if RunStatement(table, &insertState) != ExecuteSuccess {
+		t.Errorf("explain insert must be execute success")
+	}
+
+	lines = FormatPlan(PlanStatement(table, &insertState))
+	if !strings.Contains(strings.Join(lines, "\n"), "Find(key=100)") {
+		t.Errorf("insert plan must seek with Find: %v", lines)
+	}
+
+	// explain must not execute the insert
+	_, numCells := backend.CountLeafCells(table)
+	if numCells != InsertNum {
+		t.Errorf("Cell Num must be %v, but it is %v", InsertNum, numCells)
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
@@ -0,0 +1,458 @@
+package sql
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"tiny-rdb/backend"
+	"tiny-rdb/util"
+	"unicode/utf8"
+)
+
+// Expression Type
+const (
+	ExprLiteral  = iota
+	ExprColumn   = iota
+	ExprNot      = iota
+	ExprBinary   = iota // and, or, comparison and like
+	ExprIsNull   = iota
+	ExprFunction = iota
+	ExprParam    = iota // placeholder of prepared statement, replaced by literal when parameters are bound
+)
+
+// ExprType type of expression
+type ExprType = int
+
+// Expr expression of predicate, used by where clause and CHECK constraint.
+// Predicates follow SQL three-valued logic: integer 1 is TRUE, integer 0 is FALSE and NULL is UNKNOWN.
+type Expr struct {
+	Type   ExprType
+	Op     string
+	Value  Value
+	Column string
+	Negate bool // is not null, not like
+	Left   *Expr
+	Right  *Expr
+
+	ParamIndex int // start from 1
+}
+
+type exprParser struct {
+	tokens    []Token
+	pos       int
+	nextParam int
+}
+
+// ParseExpr Parse the expression from the beginning of tokens, return the num of tokens consumed
+func ParseExpr(tokens []Token) (*Expr, int, bool) {
+	var parser *exprParser = &exprParser{tokens: tokens, nextParam: 1}
+	expr, ok := parseExprOr(parser)
+	if !ok {
+		return nil, 0, false
+	}
+	return expr, parser.pos, true
+}
+
+func exprPeek(parser *exprParser) (Token, bool) {
+	if parser.pos >= len(parser.tokens) {
+		return Token{}, false
+	}
+	return parser.tokens[parser.pos], true
+}
+
+func exprAcceptKeyword(parser *exprParser, keyword string) bool {
+	token, ok := exprPeek(parser)
+	if ok && IsKeyword(token, keyword) {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func exprAcceptSymbol(parser *exprParser, symbol string) bool {
+	token, ok := exprPeek(parser)
+	if ok && IsSymbol(token, symbol) {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func parseExprOr(parser *exprParser) (*Expr, bool) {
+	left, ok := parseExprAnd(parser)
+	for ok && exprAcceptKeyword(parser, "or") {
+		var right *Expr
+		right, ok = parseExprAnd(parser)
+		left = &Expr{Type: ExprBinary, Op: "or", Left: left, Right: right}
+	}
+	return left, ok
+}
+
+func parseExprAnd(parser *exprParser) (*Expr, bool) {
+	left, ok := parseExprNot(parser)
+	for ok && exprAcceptKeyword(parser, "and") {
+		var right *Expr
+		right, ok = parseExprNot(parser)
+		left = &Expr{Type: ExprBinary, Op: "and", Left: left, Right: right}
+	}
+	return left, ok
+}
+
+func parseExprNot(parser *exprParser) (*Expr, bool) {
+	if exprAcceptKeyword(parser, "not") {
+		operand, ok := parseExprNot(parser)
+		return &Expr{Type: ExprNot, Left: operand}, ok
+	}
+	return parseExprComparison(parser)
+}
+
+func parseExprComparison(parser *exprParser) (*Expr, bool) {
+	left, ok := parseExprOperand(parser)
+	if !ok {
+		return nil, false
+	}
+
+	token, ok := exprPeek(parser)
+	if !ok {
+		return left, true
+	}
+
+	if token.Kind == TokenSymbol {
+		switch token.Text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			parser.pos++
+			right, ok := parseExprOperand(parser)
+			return &Expr{Type: ExprBinary, Op: token.Text, Left: left, Right: right}, ok
+		}
+		return left, true
+	}
+
+	if exprAcceptKeyword(parser, "is") {
+		var negate bool = exprAcceptKeyword(parser, "not")
+		if !exprAcceptKeyword(parser, "null") {
+			return nil, false
+		}
+		return &Expr{Type: ExprIsNull, Negate: negate, Left: left}, true
+	}
+
+	var start int = parser.pos
+	var negate bool = exprAcceptKeyword(parser, "not")
+	if exprAcceptKeyword(parser, "like") {
+		right, ok := parseExprOperand(parser)
+		return &Expr{Type: ExprBinary, Op: "like", Negate: negate, Left: left, Right: right}, ok
+	}
+	parser.pos = start
+	return left, true
+}
+
+func parseExprOperand(parser *exprParser) (*Expr, bool) {
+	token, ok := exprPeek(parser)
+	if !ok {
+		return nil, false
+	}
+	parser.pos++
+
+	switch token.Kind {
+	case TokenString:
+		return &Expr{Type: ExprLiteral, Value: Value{Type: ValueString, String: token.Text}}, true
+	case TokenSymbol:
+		if token.Text != "(" {
+			return nil, false
+		}
+		expr, ok := parseExprOr(parser)
+		if !ok || !exprAcceptSymbol(parser, ")") {
+			return nil, false
+		}
+		return expr, true
+	}
+
+	if IsKeyword(token, "null") {
+		return &Expr{Type: ExprLiteral, Value: Value{Type: ValueNull}}, true
+	}
+
+	if number, ok := parseNumber(token.Text); ok {
+		return &Expr{Type: ExprLiteral, Value: number}, true
+	}
+
+	// Placeholders are numbered as the ones of insert and update statement
+	if token.Text == "?" {
+		parser.nextParam++
+		return &Expr{Type: ExprParam, ParamIndex: parser.nextParam - 1}, true
+	}
+	if strings.HasPrefix(token.Text, "$") {
+		index, err := strconv.Atoi(token.Text[1:])
+		if err != nil || index < 1 {
+			return nil, false
+		}
+		return &Expr{Type: ExprParam, ParamIndex: index}, true
+	}
+
+	if exprAcceptSymbol(parser, "(") {
+		// Function call, only length(x) is supported
+		if !strings.EqualFold(token.Text, "length") {
+			return nil, false
+		}
+		argument, ok := parseExprOr(parser)
+		if !ok || !exprAcceptSymbol(parser, ")") {
+			return nil, false
+		}
+		return &Expr{Type: ExprFunction, Op: "length", Left: argument}, true
+	}
+
+	for _, ch := range token.Text {
+		if !(ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			return nil, false
+		}
+	}
+	return &Expr{Type: ExprColumn, Column: token.Text}, true
+}
+
+func parseNumber(text string) (Value, bool) {
+	if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return Value{Type: ValueInt, Int: integer}, true
+	}
+	if float, err := strconv.ParseFloat(text, 64); err == nil && (text[0] >= '0' && text[0] <= '9' || text[0] == '-' || text[0] == '.') {
+		return Value{Type: ValueFloat, Float: float}, true
+	}
+	return Value{}, false
+}
+
+// ResolveExpr Check if all columns referenced by the expression exist in the schema
+func ResolveExpr(expr *Expr, schema *backend.Schema) bool {
+	if expr == nil {
+		return true
+	}
+	if expr.Type == ExprColumn && backend.ColumnIndex(schema, expr.Column) < 0 {
+		return false
+	}
+	return ResolveExpr(expr.Left, schema) && ResolveExpr(expr.Right, schema)
+}
+
+// MaxParamIndex Get the largest placeholder index in the expression, 0 if there is no placeholder
+func MaxParamIndex(expr *Expr) int {
+	if expr == nil {
+		return 0
+	}
+
+	var maxIndex int = expr.ParamIndex
+	if left := MaxParamIndex(expr.Left); left > maxIndex {
+		maxIndex = left
+	}
+	if right := MaxParamIndex(expr.Right); right > maxIndex {
+		maxIndex = right
+	}
+	return maxIndex
+}
+
+// BindExpr Copy the expression with placeholders replaced by bound parameters, the expression itself is not changed
+func BindExpr(expr *Expr, params []Value) (*Expr, PrepareStatementResult) {
+	if expr == nil {
+		return nil, PrepareSuccess
+	}
+
+	if expr.Type == ExprParam {
+		if expr.ParamIndex > len(params) || params[expr.ParamIndex-1].Type == ValueUnbound {
+			return nil, PrepareUnboundParameter
+		}
+		var value Value = params[expr.ParamIndex-1]
+		if value.Type == ValueDefault {
+			return nil, PrepareTypeMismatch
+		}
+		return &Expr{Type: ExprLiteral, Value: value}, PrepareSuccess
+	}
+
+	var bound Expr = *expr
+	var result PrepareStatementResult
+	if bound.Left, result = BindExpr(expr.Left, params); result != PrepareSuccess {
+		return nil, result
+	}
+	if bound.Right, result = BindExpr(expr.Right, params); result != PrepareSuccess {
+		return nil, result
+	}
+	return &bound, PrepareSuccess
+}
+
+// ColumnValue Get the value of column in row
+func ColumnValue(row *backend.Row, column int) Value {
+	if backend.IsNullColumn(row.NullBitmap, uint32(column)) {
+		return Value{Type: ValueNull}
+	}
+
+	switch column {
+	case backend.ColumnPrimaryID:
+		return Value{Type: ValueInt, Int: int64(row.PrimaryID)}
+	case backend.ColumnUserName:
+		return Value{Type: ValueString, String: util.ToString(row.UserName[:])}
+	default:
+		return Value{Type: ValueString, String: util.ToString(row.Email[:])}
+	}
+}
+
+func boolValue(truth bool) Value {
+	if truth {
+		return Value{Type: ValueInt, Int: 1}
+	}
+	return Value{Type: ValueInt, Int: 0}
+}
+
+// IsTrue Check if the value is TRUE, both FALSE and UNKNOWN(NULL) are not true
+func IsTrue(value Value) bool {
+	switch value.Type {
+	case ValueInt:
+		return value.Int != 0
+	case ValueFloat:
+		return value.Float != 0
+	case ValueString:
+		number, ok := parseNumber(value.String)
+		return ok && IsTrue(number)
+	}
+	return false
+}
+
+// IsFalse Check if the value is FALSE, UNKNOWN(NULL) is not false
+func IsFalse(value Value) bool {
+	return value.Type != ValueNull && !IsTrue(value)
+}
+
+// EvalExpr Evaluate the expression against the row
+func EvalExpr(expr *Expr, row *backend.Row, schema *backend.Schema) Value {
+	switch expr.Type {
+	case ExprLiteral:
+		return expr.Value
+	case ExprColumn:
+		return ColumnValue(row, backend.ColumnIndex(schema, expr.Column))
+	case ExprNot:
+		var operand Value = EvalExpr(expr.Left, row, schema)
+		if operand.Type == ValueNull {
+			return operand
+		}
+		return boolValue(!IsTrue(operand))
+	case ExprIsNull:
+		var isNull bool = EvalExpr(expr.Left, row, schema).Type == ValueNull
+		return boolValue(isNull != expr.Negate)
+	case ExprFunction:
+		var argument Value = EvalExpr(expr.Left, row, schema)
+		if argument.Type == ValueNull {
+			return argument
+		}
+		return Value{Type: ValueInt, Int: int64(utf8.RuneCountInString(valueText(argument)))}
+	}
+
+	var left Value = EvalExpr(expr.Left, row, schema)
+	if expr.Op == "and" {
+		// FALSE and anything is FALSE, TRUE and UNKNOWN is UNKNOWN
+		if IsFalse(left) {
+			return boolValue(false)
+		}
+		var right Value = EvalExpr(expr.Right, row, schema)
+		if IsFalse(right) {
+			return boolValue(false)
+		}
+		if left.Type == ValueNull || right.Type == ValueNull {
+			return Value{Type: ValueNull}
+		}
+		return boolValue(true)
+	}
+
+	if expr.Op == "or" {
+		// TRUE or anything is TRUE, FALSE or UNKNOWN is UNKNOWN
+		if IsTrue(left) {
+			return boolValue(true)
+		}
+		var right Value = EvalExpr(expr.Right, row, schema)
+		if IsTrue(right) {
+			return boolValue(true)
+		}
+		if left.Type == ValueNull || right.Type == ValueNull {
+			return Value{Type: ValueNull}
+		}
+		return boolValue(false)
+	}
+
+	// Comparison with NULL is UNKNOWN
+	var right Value = EvalExpr(expr.Right, row, schema)
+	if left.Type == ValueNull || right.Type == ValueNull {
+		return Value{Type: ValueNull}
+	}
+
+	if expr.Op == "like" {
+		var matched bool = matchLike([]rune(strings.ToLower(valueText(right))), []rune(strings.ToLower(valueText(left))))
+		return boolValue(matched != expr.Negate)
+	}
+
+	var order int = compareValues(left, right)
+	switch expr.Op {
+	case "=":
+		return boolValue(order == 0)
+	case "!=", "<>":
+		return boolValue(order != 0)
+	case "<":
+		return boolValue(order < 0)
+	case "<=":
+		return boolValue(order <= 0)
+	case ">":
+		return boolValue(order > 0)
+	default:
+		return boolValue(order >= 0)
+	}
+}
+
+func valueText(value Value) string {
+	switch value.Type {
+	case ValueInt:
+		return strconv.FormatInt(value.Int, 10)
+	case ValueFloat:
+		return strconv.FormatFloat(value.Float, 'g', -1, 64)
+	}
+	return value.String
+}
+
+func valueNumber(value Value) (float64, bool) {
+	switch value.Type {
+	case ValueInt:
+		return float64(value.Int), true
+	case ValueFloat:
+		return value.Float, true
+	case ValueString:
+		number, ok := parseNumber(value.String)
+		if ok {
+			return valueNumber(number)
+		}
+	}
+	return math.NaN(), false
+}
+
+// compareValues Compare two non-NULL values, numbers are compared numerically and the others as text
+func compareValues(left Value, right Value) int {
+	leftNumber, leftOk := valueNumber(left)
+	rightNumber, rightOk := valueNumber(right)
+	if leftOk && rightOk && (left.Type != ValueString || right.Type != ValueString) {
+		if leftNumber < rightNumber {
+			return -1
+		} else if leftNumber > rightNumber {
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(valueText(left), valueText(right))
+}
+
+// matchLike Match text with LIKE pattern, % matches any sequence and _ matches one character
+func matchLike(pattern []rune, text []rune) bool {
+	if len(pattern) == 0 {
+		return len(text) == 0
+	}
+
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(text); i++ {
+			if matchLike(pattern[1:], text[i:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return len(text) > 0 && matchLike(pattern[1:], text[1:])
+	}
+	return len(text) > 0 && pattern[0] == text[0] && matchLike(pattern[1:], text[1:])
+}
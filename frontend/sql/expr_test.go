@@ -0,0 +1,75 @@
+package sql
+
+import (
+	"testing"
+	"tiny-rdb/backend"
+)
+
+func evalText(t *testing.T, text string, row *backend.Row) Value {
+	tokens, ok := Tokenize(text)
+	if !ok {
+		t.Fatalf("tokenize %v fail", text)
+	}
+
+	expr, consumed, ok := ParseExpr(tokens)
+	if !ok || consumed != len(tokens) {
+		t.Fatalf("parse %v fail", text)
+	}
+	return EvalExpr(expr, row, backend.DefaultSchema())
+}
+
+func TestEvalExpr(t *testing.T) {
+	var row backend.Row
+	row.PrimaryID = 7
+	copy(row.UserName[:], "chen")
+	backend.SetNullColumn(&row, backend.ColumnEmail, true)
+
+	trueCases := []string{
+		"id = 7",
+		"id >= 3 and id < 10",
+		"username = 'chen'",
+		"username like 'C%'",
+		"email is null",
+		"username is not null",
+		"length(username) = 4",
+		"email = 'x' or id = 7",
+		"not (id = 8)",
+	}
+	for _, text := range trueCases {
+		if !IsTrue(evalText(t, text, &row)) {
+			t.Errorf("%v must be TRUE", text)
+		}
+	}
+
+	falseCases := []string{
+		"id != 7",
+		"email = 'x' and id = 8",
+		"username not like '%e%'",
+	}
+	for _, text := range falseCases {
+		if !IsFalse(evalText(t, text, &row)) {
+			t.Errorf("%v must be FALSE", text)
+		}
+	}
+
+	// Three-valued logic, comparison with NULL is UNKNOWN
+	unknownCases := []string{
+		"email = 'x'",
+		"email != 'x'",
+		"not (email = 'x')",
+		"email = 'x' and id = 7",
+		"email = 'x' or id = 8",
+		"length(email) > 3",
+	}
+	for _, text := range unknownCases {
+		if evalText(t, text, &row).Type != ValueNull {
+			t.Errorf("%v must be UNKNOWN", text)
+		}
+	}
+
+	tokens, _ := Tokenize("name = 'chen'")
+	expr, _, _ := ParseExpr(tokens)
+	if ResolveExpr(expr, backend.DefaultSchema()) {
+		t.Errorf("column name must not be resolved")
+	}
+}
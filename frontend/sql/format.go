@@ -0,0 +1,233 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"tiny-rdb/backend"
+	"tiny-rdb/util"
+	"unicode/utf8"
+)
+
+// Output Mode
+const (
+	OutputTable     = iota
+	OutputCSV       = iota
+	OutputJSON      = iota
+	OutputJSONLines = iota
+	OutputMarkdown  = iota
+)
+
+// OutputMode how the REPL prints result rows
+type OutputMode = int
+
+// OutputModeNames names of output modes used by #mode
+var OutputModeNames = map[string]OutputMode{
+	"table":    OutputTable,
+	"csv":      OutputCSV,
+	"json":     OutputJSON,
+	"jsonl":    OutputJSONLines,
+	"markdown": OutputMarkdown,
+}
+
+// OutputSettings settings of printing result rows, they are changed by #mode and #headers
+type OutputSettings struct {
+	Mode    OutputMode
+	Headers bool // print the column names in table, csv and markdown mode
+	Writer  io.Writer
+}
+
+// Output settings of the REPL
+var Output *OutputSettings = &OutputSettings{Mode: OutputTable, Headers: true, Writer: os.Stdout}
+
+// RowValues Convert row to the values of columns, integers are int64 and NULL is nil
+func RowValues(row *backend.Row) []interface{} {
+	var values []interface{} = make([]interface{}, backend.NumColumns)
+	for column := range values {
+		if backend.IsNullColumn(row.NullBitmap, uint32(column)) {
+			continue
+		}
+		switch column {
+		case backend.ColumnPrimaryID:
+			values[column] = int64(row.PrimaryID)
+		case backend.ColumnUserName:
+			values[column] = util.ToString(row.UserName[:])
+		case backend.ColumnEmail:
+			values[column] = util.ToString(row.Email[:])
+		}
+	}
+	return values
+}
+
+// FormatResult Print the result rows in the output mode of settings
+func FormatResult(settings *OutputSettings, columns []string, rows [][]interface{}) {
+	switch settings.Mode {
+	case OutputCSV:
+		formatCSV(settings, columns, rows)
+	case OutputJSON:
+		formatJSON(settings.Writer, columns, rows, false)
+	case OutputJSONLines:
+		formatJSON(settings.Writer, columns, rows, true)
+	case OutputMarkdown:
+		formatMarkdown(settings, columns, rows)
+	default:
+		formatTable(settings, columns, rows)
+	}
+}
+
+// textOf Text of value in table, csv and markdown mode, NULL is "NULL" in table and markdown and empty in csv
+func textOf(value interface{}, null string) string {
+	switch value := value.(type) {
+	case nil:
+		return null
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case string:
+		return value
+	}
+	return fmt.Sprint(value)
+}
+
+// tableText Text of value in a table cell, line breaks are escaped so the row stays on one line
+func tableText(value interface{}) string {
+	return strings.Replace(textOf(value, "NULL"), "\n", `\n`, -1)
+}
+
+func formatTable(settings *OutputSettings, columns []string, rows [][]interface{}) {
+	if !settings.Headers && len(rows) == 0 {
+		return
+	}
+
+	var widths []int = make([]int, len(columns))
+	if settings.Headers {
+		for i, column := range columns {
+			widths[i] = utf8.RuneCountInString(column)
+		}
+	}
+	for _, row := range rows {
+		for i, value := range row {
+			if width := utf8.RuneCountInString(tableText(value)); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+
+	var border = func(left string, middle string, right string) {
+		var parts []string
+		for _, width := range widths {
+			parts = append(parts, strings.Repeat("─", width+2))
+		}
+		fmt.Fprintln(settings.Writer, left+strings.Join(parts, middle)+right)
+	}
+	var line = func(cells []string, rightAligned []bool) {
+		var parts []string
+		for i, cell := range cells {
+			var padding string = strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if rightAligned[i] {
+				parts = append(parts, " "+padding+cell+" ")
+			} else {
+				parts = append(parts, " "+cell+padding+" ")
+			}
+		}
+		fmt.Fprintln(settings.Writer, "│"+strings.Join(parts, "│")+"│")
+	}
+
+	border("┌", "┬", "┐")
+	if settings.Headers {
+		line(columns, make([]bool, len(columns)))
+		if len(rows) > 0 {
+			border("├", "┼", "┤")
+		}
+	}
+	for _, row := range rows {
+		var cells []string = make([]string, len(row))
+		var rightAligned []bool = make([]bool, len(row))
+		for i, value := range row {
+			cells[i] = tableText(value)
+			_, rightAligned[i] = value.(int64)
+		}
+		line(cells, rightAligned)
+	}
+	border("└", "┴", "┘")
+}
+
+// formatCSV Write rows as CSV the same way ExportCSV does, NULL is an empty field and an empty string is ""
+func formatCSV(settings *OutputSettings, columns []string, rows [][]interface{}) {
+	if settings.Headers {
+		var header []string = make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = csvField(column, false)
+		}
+		io.WriteString(settings.Writer, strings.Join(header, ",")+"\n")
+	}
+	for _, row := range rows {
+		var record []string = make([]string, len(row))
+		for i, value := range row {
+			record[i] = csvField(textOf(value, ""), value == nil)
+		}
+		io.WriteString(settings.Writer, strings.Join(record, ",")+"\n")
+	}
+}
+
+// jsonObject Encode row as a JSON object, the keys are in the order of columns
+func jsonObject(columns []string, row []interface{}) string {
+	var fields []string
+	for i, column := range columns {
+		key, _ := json.Marshal(column)
+		value, _ := json.Marshal(row[i])
+		fields = append(fields, string(key)+":"+string(value))
+	}
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+// formatJSON Print rows as a JSON array of objects, or one object per line in lines mode
+func formatJSON(writer io.Writer, columns []string, rows [][]interface{}, lines bool) {
+	if lines {
+		for _, row := range rows {
+			fmt.Fprintln(writer, jsonObject(columns, row))
+		}
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Fprintln(writer, "[]")
+		return
+	}
+	fmt.Fprintln(writer, "[")
+	for i, row := range rows {
+		var separator string = ","
+		if i == len(rows)-1 {
+			separator = ""
+		}
+		fmt.Fprintln(writer, "  "+jsonObject(columns, row)+separator)
+	}
+	fmt.Fprintln(writer, "]")
+}
+
+func formatMarkdown(settings *OutputSettings, columns []string, rows [][]interface{}) {
+	var line = func(cells []string) {
+		for i := range cells {
+			cells[i] = strings.Replace(cells[i], "|", `\|`, -1)
+		}
+		fmt.Fprintln(settings.Writer, "| "+strings.Join(cells, " | ")+" |")
+	}
+
+	// A markdown table needs its header line, headers off leaves the names empty
+	var header []string = make([]string, len(columns))
+	if settings.Headers {
+		copy(header, columns)
+	}
+	line(header)
+	fmt.Fprintln(settings.Writer, "|"+strings.Repeat(" --- |", len(columns)))
+
+	for _, row := range rows {
+		var cells []string = make([]string, len(row))
+		for i, value := range row {
+			cells[i] = textOf(value, "NULL")
+		}
+		line(cells)
+	}
+}
@@ -0,0 +1,68 @@
+package sql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatResult(t *testing.T) {
+	var columns []string = []string{"id", "username", "email"}
+	var rows [][]interface{} = [][]interface{}{
+		{int64(1), "chen", "we@qq.com"},
+		{int64(12), "a|b,c", nil},
+	}
+
+	var cases = []struct {
+		mode    OutputMode
+		headers bool
+		output  string
+	}{
+		{OutputTable, true, "" +
+			"┌────┬──────────┬───────────┐\n" +
+			"│ id │ username │ email     │\n" +
+			"├────┼──────────┼───────────┤\n" +
+			"│  1 │ chen     │ we@qq.com │\n" +
+			"│ 12 │ a|b,c    │ NULL      │\n" +
+			"└────┴──────────┴───────────┘\n"},
+		{OutputTable, false, "" +
+			"┌────┬───────┬───────────┐\n" +
+			"│  1 │ chen  │ we@qq.com │\n" +
+			"│ 12 │ a|b,c │ NULL      │\n" +
+			"└────┴───────┴───────────┘\n"},
+		{OutputCSV, true, "id,username,email\n1,chen,we@qq.com\n12,\"a|b,c\",\n"},
+		{OutputCSV, false, "1,chen,we@qq.com\n12,\"a|b,c\",\n"},
+		{OutputJSON, true, "" +
+			"[\n" +
+			"  {\"id\":1,\"username\":\"chen\",\"email\":\"we@qq.com\"},\n" +
+			"  {\"id\":12,\"username\":\"a|b,c\",\"email\":null}\n" +
+			"]\n"},
+		{OutputJSONLines, true, "" +
+			"{\"id\":1,\"username\":\"chen\",\"email\":\"we@qq.com\"}\n" +
+			"{\"id\":12,\"username\":\"a|b,c\",\"email\":null}\n"},
+		{OutputMarkdown, true, "" +
+			"| id | username | email |\n" +
+			"| --- | --- | --- |\n" +
+			"| 1 | chen | we@qq.com |\n" +
+			"| 12 | a\\|b,c | NULL |\n"},
+	}
+
+	for _, c := range cases {
+		var output bytes.Buffer
+		FormatResult(&OutputSettings{Mode: c.mode, Headers: c.headers, Writer: &output}, columns, rows)
+		if output.String() != c.output {
+			t.Errorf("output of mode %v headers %v must be\n%v\nbut it is\n%v", c.mode, c.headers, c.output, output.String())
+		}
+	}
+
+	var output bytes.Buffer
+	FormatResult(&OutputSettings{Mode: OutputCSV, Writer: &output}, columns, [][]interface{}{{int64(2), "", nil}})
+	if output.String() != "2,\"\",\n" {
+		t.Errorf("empty string must be \"\" and NULL an empty field in CSV: %q", output.String())
+	}
+
+	output.Reset()
+	FormatResult(&OutputSettings{Mode: OutputJSON, Writer: &output}, columns, nil)
+	if output.String() != "[]\n" {
+		t.Errorf("empty result must be an empty JSON array: %q", output.String())
+	}
+}
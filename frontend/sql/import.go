@@ -0,0 +1,365 @@
+package sql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"tiny-rdb/backend"
+)
+
+// ImportError a record of CSV which is not imported and why
+type ImportError struct {
+	Record  int // number of the record in the file from 1, the header is a record too
+	Message string
+}
+
+// ImportReport result of importing CSV
+type ImportReport struct {
+	Imported int
+	Errors   []ImportError
+}
+
+// importRow a row read from CSV
+type importRow struct {
+	record int
+	row    backend.Row
+	autoID bool // no id is given, the next id is assigned like insert without id
+}
+
+func (report *ImportReport) fail(record int, format string, args ...interface{}) {
+	report.Errors = append(report.Errors, ImportError{Record: record, Message: fmt.Sprintf(format, args...)})
+}
+
+// importColumns Get the column of each field by the header record. The first record is the header if all of its
+// fields are the names of different columns, otherwise the fields are all columns in order and there is no header.
+func importColumns(schema *backend.Schema, fields []string) ([]int, bool) {
+	var columns []int
+	var seen map[int]bool = make(map[int]bool)
+	for _, field := range fields {
+		var column int = -1
+		for i := range schema.Columns {
+			if strings.EqualFold(strings.TrimSpace(field), schema.Columns[i].Name) {
+				column = i
+			}
+		}
+		if column < 0 || seen[column] {
+			return []int{backend.ColumnPrimaryID, backend.ColumnUserName, backend.ColumnEmail}, false
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+	return columns, true
+}
+
+// parseImportedID Coerce the id field to integer, a float without fraction such as "3.0" is accepted
+func parseImportedID(text string) (uint32, bool) {
+	if id, err := strconv.ParseUint(text, 10, 32); err == nil {
+		return uint32(id), true
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value != math.Trunc(value) || value < 0 || value > math.MaxUint32 {
+		return 0, false
+	}
+	return uint32(value), true
+}
+
+// csvQuoted Check which fields of the record just read are quoted, by the byte at the start of each field.
+// lineStarts has the offset of each line in input.
+func csvQuoted(reader *csv.Reader, input []byte, lineStarts []int, fields []string) []bool {
+	var quoted []bool = make([]bool, len(fields))
+	for i := range fields {
+		line, column := reader.FieldPos(i)
+		if line < 1 || line > len(lineStarts) {
+			continue
+		}
+		var offset int = lineStarts[line-1] + column - 1
+		quoted[i] = offset < len(input) && input[offset] == '"'
+	}
+	return quoted
+}
+
+// csvLineStarts Get the offset of each line in input
+func csvLineStarts(input []byte) []int {
+	var lineStarts []int = []int{0}
+	for i, b := range input {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return lineStarts
+}
+
+// coerceRecord Convert the fields of record to row by the column types. An empty field is NULL and a quoted empty
+// field "" is an empty string, like the CSV of PostgreSQL. An empty id is assigned like insert without id.
+// The columns not in the file get their default value.
+func coerceRecord(schema *backend.Schema, columns []int, fields []string, quoted []bool, row *importRow) string {
+	if len(fields) != len(columns) {
+		return fmt.Sprintf("Expected %v fields but got %v", len(columns), len(fields))
+	}
+
+	var assigned uint32
+	row.autoID = true
+	for i, field := range fields {
+		var column int = columns[i]
+		assigned |= 1 << uint32(column)
+		if column == backend.ColumnPrimaryID {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			id, ok := parseImportedID(strings.TrimSpace(field))
+			if !ok {
+				return fmt.Sprintf("Type Mismatch: %q is not an integer for column %v", field, schema.Columns[column].Name)
+			}
+			row.row.PrimaryID = id
+			row.autoID = false
+			continue
+		}
+
+		if field == "" && !quoted[i] {
+			backend.SetNullColumn(&row.row, uint32(column), true)
+			continue
+		}
+		if len(field) > columnStorageSize(column) {
+			return fmt.Sprintf("String too long for column %v", schema.Columns[column].Name)
+		}
+		setColumnText(&row.row, uint32(column), field)
+	}
+	applyDefaults(schema, &row.row, ^assigned)
+	return ""
+}
+
+// ImportCSV Insert the rows of CSV into table. The rows which can not be converted or violate a constraint are
+// reported and skipped, the others are imported.
+//
+// The rows are sorted by id and merged with the rows of table into a new B-tree built bottom-up by bulk loading,
+// instead of inserting them one by one, and UNIQUE columns are checked against the values collected by
+// a single scan instead of a scan per row.
+func ImportCSV(table *backend.Table, input io.Reader) (*ImportReport, ExecuteResult) {
+	table = SessionTable(table)
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+	if table.ReadOnly {
+		return nil, ExecuteReadOnly
+	}
+	defer func() { table.Version++ }()
+
+	var schema *backend.Schema = table.Schema
+	var report *ImportReport = new(ImportReport)
+	content, err := ioutil.ReadAll(input)
+	if err != nil {
+		report.fail(1, "%s", err.Error())
+		return report, ExecuteSuccess
+	}
+	var lineStarts []int = csvLineStarts(content)
+	var reader *csv.Reader = csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+
+	var columns []int
+	var rows []importRow
+	var maxID uint32
+	var hasID bool
+	for record := 1; ; record++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if parseError, ok := err.(*csv.ParseError); ok {
+			report.fail(record, "%s", parseError.Err.Error())
+			continue
+		}
+		if err != nil {
+			report.fail(record, "%s", err.Error())
+			break
+		}
+
+		if columns == nil {
+			var isHeader bool
+			if columns, isHeader = importColumns(schema, fields); isHeader {
+				continue
+			}
+		}
+
+		var row importRow = importRow{record: record}
+		if message := coerceRecord(schema, columns, fields, csvQuoted(reader, content, lineStarts, fields), &row); message != "" {
+			report.fail(record, "%s", message)
+			continue
+		}
+		if !row.autoID && (!hasID || row.row.PrimaryID > maxID) {
+			maxID, hasID = row.row.PrimaryID, true
+		}
+		rows = append(rows, row)
+	}
+
+	// The rows without id get the ids after both the table and the file, in the order of file
+	nextID, ok := NextPrimaryID(table)
+	if hasID && (!ok || maxID >= nextID) {
+		nextID, ok = maxID+1, maxID < math.MaxUint32
+	}
+	for i := range rows {
+		if !rows[i].autoID {
+			continue
+		}
+		if !ok {
+			report.fail(rows[i].record, "%s", ExecuteResultMessage(ExecuteTableFull))
+			rows[i].record = -1
+			continue
+		}
+		rows[i].row.PrimaryID = nextID
+		nextID, ok = nextID+1, nextID < math.MaxUint32
+	}
+
+	// The existing rows are merged with the sorted rows of file into a tree built bottom-up, the room of
+	// the existing rows is kept so only the rows of file are left out when the table is full
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].row.PrimaryID < rows[j].row.PrimaryID })
+	var unique map[int]map[string]bool = uniqueValues(table)
+	var loader *backend.BulkLoader = backend.NewBulkLoader(backend.DefaultFillFactor)
+	_, numExisting := backend.CountLeafCells(table)
+	var cursor *backend.Cursor = backend.CursorBegin(table)
+	var lastID uint32
+	var imported bool
+	for i := range rows {
+		if rows[i].record < 0 {
+			continue
+		}
+		var row *backend.Row = &rows[i].row
+		for ; !cursor.IsEndOfTable && backend.CursorKey(cursor) < row.PrimaryID; backend.CursorNext(cursor) {
+			if !addExistingRow(loader, cursor) {
+				return nil, ExecuteTableFull
+			}
+			numExisting--
+		}
+
+		var result ExecuteResult = ExecuteSuccess
+		if (!cursor.IsEndOfTable && backend.CursorKey(cursor) == row.PrimaryID) || (imported && lastID == row.PrimaryID) {
+			result = ExecuteDuplicateKey
+		} else if result = checkImportedRow(table.Schema, row, unique); result == ExecuteSuccess && !loader.CanAdd(numExisting+1) {
+			result = ExecuteTableFull
+		}
+		if result == ExecuteTableFull {
+			report.fail(rows[i].record, "%s, the rest %v rows are not imported", ExecuteResultMessage(result), len(rows)-i-1)
+			break
+		}
+		if result != ExecuteSuccess {
+			report.fail(rows[i].record, "%s", ExecuteResultMessage(result))
+			continue
+		}
+
+		loader.Add(row)
+		lastID, imported = row.PrimaryID, true
+		for column, values := range unique {
+			if value := ColumnValue(row, column); value.Type != ValueNull {
+				values[value.String] = true
+			}
+		}
+		if schema.Columns[backend.ColumnPrimaryID].AutoIncrement && row.PrimaryID > schema.Sequence {
+			schema.Sequence = row.PrimaryID
+		}
+		table.LastInsertID = row.PrimaryID
+		report.Imported++
+	}
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		if !addExistingRow(loader, cursor) {
+			return nil, ExecuteTableFull
+		}
+	}
+	if report.Imported > 0 {
+		backend.BulkLoad(table, loader)
+		if err := backend.FlushStatement(table); err != nil {
+			panic(&backend.Error{Err: err})
+		}
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Record < report.Errors[j].Record })
+	return report, ExecuteSuccess
+}
+
+// uniqueValues Collect the values of UNIQUE columns by scanning the table once, NULLs are never equal
+func uniqueValues(table *backend.Table) map[int]map[string]bool {
+	var unique map[int]map[string]bool = make(map[int]map[string]bool)
+	for i, column := range table.Schema.Columns {
+		if column.Unique && i != backend.ColumnPrimaryID {
+			unique[i] = make(map[string]bool)
+		}
+	}
+	if len(unique) == 0 {
+		return unique
+	}
+
+	var cursor *backend.Cursor = backend.CursorBegin(table)
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+		for column, values := range unique {
+			if value := ColumnValue(&row, column); value.Type != ValueNull {
+				values[value.String] = true
+			}
+		}
+	}
+	return unique
+}
+
+// addExistingRow Add the row of table at cursor to the tree of import, the room of it is kept so it always fits
+func addExistingRow(loader *backend.BulkLoader, cursor *backend.Cursor) bool {
+	var row backend.Row
+	backend.DeserializeRow(backend.CursorValue(cursor), &row)
+	return loader.Add(&row) == nil
+}
+
+// checkImportedRow Check the constraints of a row of import, unique has the values of UNIQUE columns
+func checkImportedRow(schema *backend.Schema, row *backend.Row, unique map[int]map[string]bool) ExecuteResult {
+	if result := checkColumnConstraints(schema, row); result != ExecuteSuccess {
+		return result
+	}
+	for column, values := range unique {
+		if value := ColumnValue(row, column); value.Type != ValueNull && values[value.String] {
+			return ExecuteUniqueConstraint
+		}
+	}
+	return ExecuteSuccess
+}
+
+// csvField Quote the text of a field of CSV if it needs, an empty string is quoted so it differs from NULL
+func csvField(text string, null bool) string {
+	if null {
+		return ""
+	}
+	if text == "" || text[0] == ' ' || text[0] == '\t' || strings.ContainsAny(text, ",\"\r\n") {
+		return `"` + strings.Replace(text, `"`, `""`, -1) + `"`
+	}
+	return text
+}
+
+// ExportCSV Write the header and all rows of table as CSV by a full scan of the snapshot. NULL is an empty field and
+// an empty string is a quoted empty field "", so the file is imported back to the same rows.
+// Return the number of rows written.
+func ExportCSV(table *backend.Table, output io.Writer) (int, error) {
+	var snapshot *backend.Table = backend.Snapshot(SessionTable(table))
+	var writer *bufio.Writer = bufio.NewWriter(output)
+
+	var header []string
+	for _, column := range snapshot.Schema.Columns {
+		header = append(header, csvField(column.Name, false))
+	}
+	writer.WriteString(strings.Join(header, ",") + "\n")
+
+	var count int
+	var cursor *backend.Cursor = backend.CursorBegin(snapshot)
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+		var record []string
+		for _, value := range RowValues(&row) {
+			record = append(record, csvField(textOf(value, ""), value == nil))
+		}
+		writer.WriteString(strings.Join(record, ",") + "\n")
+		count++
+	}
+	return count, writer.Flush()
+}
@@ -0,0 +1,120 @@
+package sql
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"tiny-rdb/backend"
+)
+
+func TestImportCSV(t *testing.T) {
+	dbFile := "./ImportCSV.db"
+	table := backend.OpenDB(dbFile)
+
+	var shell *Shell = &Shell{Table: table, Errors: &bytes.Buffer{}}
+	shell.RunScript("create table users (id integer primary key, username text not null unique, email text);" +
+		"insert 5 five f@qq.com;")
+
+	// The header names the columns in any order, the empty email is NULL and the empty id is assigned after
+	// the max id of table and file
+	var csv string = "" +
+		"Email,username,id\n" +
+		"a@qq.com,alice,3.0\n" +
+		",bob,1\n" +
+		"c@qq.com,carol,\n" +
+		"x@qq.com,five,7\n" +
+		"y@qq.com,,8\n" +
+		"z@qq.com,zed,abc\n" +
+		"d@qq.com,dave,1\n" +
+		"e@qq.com,eve\n"
+	report, result := ImportCSV(table, strings.NewReader(csv))
+	if result != ExecuteSuccess || report.Imported != 3 {
+		t.Fatalf("3 rows must be imported: %v %+v", result, report)
+	}
+	var expected []ImportError = []ImportError{
+		{5, "Error: UNIQUE constraint failed"},
+		{6, "Error: NOT NULL constraint failed"},
+		{7, "Type Mismatch: \"abc\" is not an integer for column id"},
+		{8, "Error: Duplicate Key"},
+		{9, "Expected 3 fields but got 2"},
+	}
+	if !reflect.DeepEqual(report.Errors, expected) {
+		t.Errorf("errors must be %+v, but they are %+v", expected, report.Errors)
+	}
+
+	var output bytes.Buffer
+	if count, err := ExportCSV(table, &output); count != 4 || err != nil {
+		t.Errorf("4 rows must be exported: %v %v", count, err)
+	}
+	if output.String() != "id,username,email\n1,bob,\n3,alice,a@qq.com\n5,five,f@qq.com\n9,carol,c@qq.com\n" {
+		t.Errorf("exported rows are wrong: %q", output.String())
+	}
+
+	// Without header the fields are all columns in order, a header after the first record is a bad record
+	table.RWLock.Lock()
+	table.Schema.Columns[backend.ColumnUserName].Unique = false
+	table.RWLock.Unlock()
+	report, _ = ImportCSV(table, strings.NewReader("10,ten,t@qq.com\n"+strings.Replace(output.String(), ",", "x,", 1)))
+	if report.Imported != 1 || len(report.Errors) != 5 {
+		t.Errorf("the first record is not a header: %+v", report)
+	}
+
+	// Many rows split the leaves, and the rows beyond the capacity are reported
+	var many strings.Builder
+	for i := 0; i < backend.TableMaxPages*int(backend.LeafNodeMaxCells); i++ {
+		many.WriteString(",name,e@qq.com\n")
+	}
+	report, _ = ImportCSV(table, strings.NewReader(many.String()))
+	if len(report.Errors) != 1 || !strings.HasPrefix(report.Errors[0].Message, "Error: Table Full") {
+		t.Errorf("the import must stop at table full: %+v", report.Errors)
+	}
+	_, numCells := backend.CountLeafCells(table)
+	if numCells != uint32(report.Imported)+5 {
+		t.Errorf("the imported rows must be in the table: %v %v", numCells, report.Imported)
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+}
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	dbFile := "./ExportCSVRoundTrip.db"
+	table := backend.OpenDB(dbFile)
+
+	// NULL is an empty field and the empty string is quoted, the fields which need quotes keep them
+	var csv string = "" +
+		"id,username,email\n" +
+		"1,bob,\n" +
+		"2,\"\",e@qq.com\n" +
+		"3,\"a,b\",\"say \"\"hi\"\"\"\n" +
+		"4,\" x\",\"two\nlines\"\n"
+	if report, result := ImportCSV(table, strings.NewReader(csv)); result != ExecuteSuccess || report.Imported != 4 {
+		t.Fatalf("4 rows must be imported: %v %+v", result, report)
+	}
+	var output bytes.Buffer
+	if count, err := ExportCSV(table, &output); count != 4 || err != nil {
+		t.Errorf("4 rows must be exported: %v %v", count, err)
+	}
+	if output.String() != csv {
+		t.Errorf("the rows must be exported as they are imported: %q", output.String())
+	}
+
+	var cursor *backend.Cursor = backend.CursorBegin(table)
+	var rows []backend.Row
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+		rows = append(rows, row)
+	}
+	if !backend.IsNullColumn(rows[0].NullBitmap, backend.ColumnEmail) ||
+		backend.IsNullColumn(rows[1].NullBitmap, backend.ColumnUserName) || rows[1].UserName[0] != 0 {
+		t.Errorf("NULL and the empty string must differ: %+v %+v", rows[0], rows[1])
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+}
@@ -0,0 +1,107 @@
+package sql
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token Kind
+const (
+	TokenWord   = iota // keyword, identifier, number, placeholder or bare value like we@qq.com
+	TokenString = iota // single quoted string, '' is an escaped quote
+	TokenSymbol = iota // ( ) , = != <> < <= > >=
+)
+
+// TokenKind kind of token
+type TokenKind = int
+
+// Token a lexical token of statement
+type Token struct {
+	Kind TokenKind
+	Text string
+}
+
+func isSymbolChar(ch rune) bool {
+	return strings.ContainsRune("(),=<>!'", ch)
+}
+
+// Tokenize Split the statement into tokens, return false if there is an unterminated string or unknown symbol
+func Tokenize(text string) ([]Token, bool) {
+	var tokens []Token
+	var runes []rune = []rune(text)
+	for i := 0; i < len(runes); {
+		var ch rune = runes[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '\'':
+			var builder strings.Builder
+			var terminated bool = false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						builder.WriteRune('\'')
+						i++
+						continue
+					}
+					terminated = true
+					i++
+					break
+				}
+				builder.WriteRune(runes[i])
+			}
+			if !terminated {
+				return nil, false
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: builder.String()})
+		case isSymbolChar(ch):
+			var symbol string = string(ch)
+			if i+1 < len(runes) {
+				var twoChars string = string(runes[i : i+2])
+				if twoChars == "!=" || twoChars == "<>" || twoChars == "<=" || twoChars == ">=" {
+					symbol = twoChars
+				}
+			}
+			if symbol == "!" {
+				return nil, false
+			}
+			tokens = append(tokens, Token{Kind: TokenSymbol, Text: symbol})
+			i += len(symbol)
+		default:
+			var start int = i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !isSymbolChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenWord, Text: string(runes[start:i])})
+		}
+	}
+	return tokens, true
+}
+
+// IsKeyword Check if the token is the keyword, keywords are case insensitive
+func IsKeyword(token Token, keyword string) bool {
+	return token.Kind == TokenWord && strings.EqualFold(token.Text, keyword)
+}
+
+// IsSymbol Check if the token is the symbol
+func IsSymbol(token Token, symbol string) bool {
+	return token.Kind == TokenSymbol && token.Text == symbol
+}
+
+// QuoteString Quote the string as a string literal of statement
+func QuoteString(text string) string {
+	return "'" + strings.Replace(text, "'", "''", -1) + "'"
+}
+
+// JoinTokens Join tokens back to the statement text
+func JoinTokens(tokens []Token) string {
+	var parts []string
+	for _, token := range tokens {
+		if token.Kind == TokenString {
+			parts = append(parts, QuoteString(token.Text))
+		} else {
+			parts = append(parts, token.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
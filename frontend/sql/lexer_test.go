@@ -0,0 +1,31 @@
+package sql
+
+import "testing"
+
+func TestTokenize(t *testing.T) {
+	tokens, ok := Tokenize("insert 1 'it''s me' we@qq.com")
+	if !ok || len(tokens) != 4 {
+		t.Errorf("tokens must be 4: %v", tokens)
+	}
+
+	if tokens[2].Kind != TokenString || tokens[2].Text != "it's me" {
+		t.Errorf("quoted string is wrong: %v", tokens[2])
+	}
+
+	if tokens[3].Kind != TokenWord || tokens[3].Text != "we@qq.com" {
+		t.Errorf("bare word is wrong: %v", tokens[3])
+	}
+
+	tokens, ok = Tokenize("id>=3 and email<>'x'")
+	if !ok || len(tokens) != 7 || !IsSymbol(tokens[1], ">=") || !IsSymbol(tokens[5], "<>") {
+		t.Errorf("symbols are wrong: %v", tokens)
+	}
+
+	if _, ok = Tokenize("insert 1 'chen"); ok {
+		t.Errorf("unterminated string must fail")
+	}
+
+	if JoinTokens(tokens) != "id >= 3 and email <> 'x'" {
+		t.Errorf("joined tokens are wrong: %v", JoinTokens(tokens))
+	}
+}
@@ -0,0 +1,318 @@
+package sql
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"tiny-rdb/backend"
+)
+
+// const Bind Result
+const (
+	BindSuccess         = iota
+	BindIndexOutOfRange = iota
+)
+
+// const Value Type, the zero value of Value is unbound
+const (
+	ValueUnbound = iota
+	ValueNull    = iota
+	ValueInt     = iota
+	ValueString  = iota
+	ValueFloat   = iota
+	ValueDefault = iota // DEFAULT keyword, the column takes its default value
+)
+
+// const var
+const (
+	// StatementCacheSize max num of compiled statements kept by a statement cache
+	StatementCacheSize = 64
+)
+
+// BindResult result of binding a parameter
+type BindResult = int
+
+// ValueType type of bound value
+type ValueType = int
+
+// Value a value bound to a parameter of prepared statement
+type Value struct {
+	Type   ValueType
+	Int    int64
+	String string
+	Float  float64
+}
+
+// argumentSlot is an argument of compiled statement, either a literal or a placeholder index(start from 1)
+type argumentSlot struct {
+	Literal    Value
+	ParamIndex int
+}
+
+// PreparedStatement a compiled statement, it can be executed many times with different parameters.
+// Placeholders are "?" (numbered from left to right) or "$N" (explicit number, start from 1)
+type PreparedStatement struct {
+	SQL       string
+	Template  Statement
+	Arguments []argumentSlot
+	Params    []Value
+}
+
+// StatementCache cache compiled statements by SQL text
+type StatementCache struct {
+	Statements map[string]*PreparedStatement
+	order      []string
+}
+
+// NewStatementCache Make new statement cache
+func NewStatementCache() *StatementCache {
+	var cache *StatementCache = new(StatementCache)
+	cache.Statements = make(map[string]*PreparedStatement)
+	return cache
+}
+
+// PrepareCached Get compiled statement from the cache, compile and cache it if missing.
+// The returned statement is a copy of the cached one with its own unbound parameters, so the users of a cache
+// never overwrite the bindings of each other. The compiled template is shared, it is never changed after compile.
+func PrepareCached(cache *StatementCache, sqlText string) (*PreparedStatement, PrepareStatementResult) {
+	sqlText = strings.TrimSpace(sqlText)
+	if prepared, ok := cache.Statements[sqlText]; ok {
+		return copyPrepared(prepared), PrepareSuccess
+	}
+
+	prepared, result := CompileStatement(sqlText)
+	if result != PrepareSuccess {
+		return nil, result
+	}
+
+	if len(cache.order) >= StatementCacheSize {
+		// Evict the oldest compiled statement
+		delete(cache.Statements, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+	cache.Statements[sqlText] = prepared
+	cache.order = append(cache.order, sqlText)
+	return copyPrepared(prepared), PrepareSuccess
+}
+
+// copyPrepared Copy the compiled statement with unbound parameters of its own
+func copyPrepared(prepared *PreparedStatement) *PreparedStatement {
+	var copied PreparedStatement = *prepared
+	copied.Params = make([]Value, len(prepared.Params))
+	return &copied
+}
+
+// CompileStatement Compile SQL text with placeholders to a reusable prepared statement
+func CompileStatement(sqlText string) (*PreparedStatement, PrepareStatementResult) {
+	var prepared *PreparedStatement = new(PreparedStatement)
+	prepared.SQL = strings.TrimSpace(sqlText)
+
+	tokens, ok := Tokenize(prepared.SQL)
+	if !ok {
+		return nil, PrepareSyntaxError
+	}
+
+	var body []Token = tokens
+	if len(body) > 0 && IsKeyword(body[0], "explain") {
+		prepared.Template.Explain = true
+		body = body[1:]
+	}
+
+	if len(body) == 0 {
+		return nil, PrepareUnrecognizedStatement
+	}
+
+	if IsKeyword(body[0], "insert") {
+		prepared.Template.Type = InsertStatement
+	} else if IsKeyword(body[0], "update") {
+		prepared.Template.Type = UpdateStatement
+	} else {
+		// Statements without values are prepared once, only the placeholders of where clause are left to bind
+		if result := prepareStatementText(prepared.SQL, &prepared.Template); result != PrepareSuccess {
+			return nil, result
+		}
+		prepared.Params = make([]Value, MaxParamIndex(prepared.Template.Where))
+		return prepared, PrepareSuccess
+	}
+
+	// insert/update id [username [email]]
+	var values []Token = body[1:]
+	if len(values) < 1 || len(values) > backend.NumColumns {
+		return nil, PrepareSyntaxError
+	}
+
+	var nextIndex int = 1
+	var numParams int = 0
+	for _, token := range values {
+		var slot argumentSlot
+		if token.Kind == TokenSymbol {
+			return nil, PrepareSyntaxError
+		} else if token.Kind == TokenWord && token.Text == "?" {
+			slot.ParamIndex = nextIndex
+			nextIndex++
+		} else if token.Kind == TokenWord && strings.HasPrefix(token.Text, "$") {
+			index, err := strconv.Atoi(token.Text[1:])
+			if err != nil || index < 1 {
+				return nil, PrepareSyntaxError
+			}
+			slot.ParamIndex = index
+		} else {
+			slot.Literal = tokenValue(token)
+		}
+
+		if slot.ParamIndex > numParams {
+			numParams = slot.ParamIndex
+		}
+		prepared.Arguments = append(prepared.Arguments, slot)
+	}
+
+	// Check literals at compile time, so the errors are reported once
+	var statement Statement = prepared.Template
+	for i, slot := range prepared.Arguments {
+		if slot.ParamIndex == 0 {
+			if result := bindArgument(&statement, i, &slot.Literal); result != PrepareSuccess {
+				return nil, result
+			}
+		}
+	}
+
+	prepared.Params = make([]Value, numParams)
+	return prepared, PrepareSuccess
+}
+
+// NumParams Get the number of parameters of prepared statement
+func NumParams(prepared *PreparedStatement) int {
+	return len(prepared.Params)
+}
+
+func bindValue(prepared *PreparedStatement, index int, value Value) BindResult {
+	if index < 1 || index > len(prepared.Params) {
+		return BindIndexOutOfRange
+	}
+	prepared.Params[index-1] = value
+	return BindSuccess
+}
+
+// BindInt Bind integer value to the parameter, index start from 1
+func BindInt(prepared *PreparedStatement, index int, value int64) BindResult {
+	return bindValue(prepared, index, Value{Type: ValueInt, Int: value})
+}
+
+// BindString Bind string value to the parameter, index start from 1
+func BindString(prepared *PreparedStatement, index int, value string) BindResult {
+	return bindValue(prepared, index, Value{Type: ValueString, String: value})
+}
+
+// BindFloat Bind float value to the parameter, index start from 1
+func BindFloat(prepared *PreparedStatement, index int, value float64) BindResult {
+	return bindValue(prepared, index, Value{Type: ValueFloat, Float: value})
+}
+
+// BindNull Bind NULL to the parameter, index start from 1
+func BindNull(prepared *PreparedStatement, index int) BindResult {
+	return bindValue(prepared, index, Value{Type: ValueNull})
+}
+
+// ClearBindings Reset all parameters to unbound
+func ClearBindings(prepared *PreparedStatement) {
+	for i := range prepared.Params {
+		prepared.Params[i] = Value{}
+	}
+}
+
+// BindStatement Make an executable statement from prepared statement and its bound parameters.
+// Values never go through the SQL text, so they can not change the meaning of the statement.
+func BindStatement(prepared *PreparedStatement, statement *Statement) PrepareStatementResult {
+	*statement = prepared.Template
+
+	if statement.Where != nil {
+		var result PrepareStatementResult
+		if statement.Where, result = BindExpr(prepared.Template.Where, prepared.Params); result != PrepareSuccess {
+			return result
+		}
+	}
+
+	for i, slot := range prepared.Arguments {
+		var value Value = slot.Literal
+		if slot.ParamIndex != 0 {
+			value = prepared.Params[slot.ParamIndex-1]
+		}
+
+		if result := bindArgument(statement, i, &value); result != PrepareSuccess {
+			return result
+		}
+	}
+	return PrepareSuccess
+}
+
+// bindArgument Set the argumentNum-th value of insert or update statement (id, username, email)
+func bindArgument(statement *Statement, argumentNum int, value *Value) PrepareStatementResult {
+	if value.Type == ValueUnbound {
+		return PrepareUnboundParameter
+	}
+
+	var row *backend.Row = &statement.RowToInsert
+	if statement.Type == UpdateStatement {
+		row = &statement.RowToUpdate
+	}
+	var column uint32 = uint32(argumentNum)
+	statement.AssignedColumns |= 1 << column
+
+	if argumentNum == backend.ColumnPrimaryID {
+		if statement.Type == InsertStatement && (value.Type == ValueNull || value.Type == ValueDefault) {
+			statement.AutoID = true
+			return PrepareSuccess
+		}
+
+		id, ok := valueToUint32(value)
+		if !ok {
+			return PrepareTypeMismatch
+		}
+		row.PrimaryID = id
+		return PrepareSuccess
+	}
+
+	var text string
+	switch value.Type {
+	case ValueNull:
+		backend.SetNullColumn(row, column, true)
+		return PrepareSuccess
+	case ValueDefault:
+		statement.DefaultColumns |= 1 << column
+		return PrepareSuccess
+	case ValueString:
+		text = value.String
+	case ValueInt:
+		text = strconv.FormatInt(value.Int, 10)
+	case ValueFloat:
+		text = strconv.FormatFloat(value.Float, 'g', -1, 64)
+	}
+
+	if len(text) > columnStorageSize(argumentNum) {
+		return PrepareStringTooLong
+	}
+	setColumnText(row, column, text)
+	return PrepareSuccess
+}
+
+func valueToUint32(value *Value) (uint32, bool) {
+	switch value.Type {
+	case ValueInt:
+		if value.Int < 0 || value.Int > math.MaxUint32 {
+			return 0, false
+		}
+		return uint32(value.Int), true
+	case ValueFloat:
+		if value.Float != math.Trunc(value.Float) || value.Float < 0 || value.Float > math.MaxUint32 {
+			return 0, false
+		}
+		return uint32(value.Float), true
+	case ValueString:
+		id, err := strconv.ParseUint(value.String, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(id), true
+	}
+	return 0, false
+}
@@ -0,0 +1,159 @@
+package sql
+
+import (
+	"os"
+	"testing"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+	"tiny-rdb/util"
+)
+
+func TestCompileStatement(t *testing.T) {
+	prepared, result := CompileStatement("insert ? ? ?")
+	if result != PrepareSuccess {
+		t.Errorf("result must be success: %v", result)
+	}
+
+	if NumParams(prepared) != 3 {
+		t.Errorf("num of params must be 3, but it is %v", NumParams(prepared))
+	}
+
+	prepared, result = CompileStatement("insert $2 chen $1")
+	if result != PrepareSuccess || NumParams(prepared) != 2 {
+		t.Errorf("statement with numbered placeholders must be compiled")
+	}
+
+	_, result = CompileStatement("insert ? chen we@qq.com extra")
+	if result != PrepareSyntaxError {
+		t.Errorf("result must be syntax error: %v", result)
+	}
+
+	_, result = CompileStatement("insert abc chen we@qq.com")
+	if result != PrepareTypeMismatch {
+		t.Errorf("result must be type mismatch: %v", result)
+	}
+
+	_, result = CompileStatement("drop ? ? ?")
+	if result != PrepareUnrecognizedStatement {
+		t.Errorf("result must be unrecognized statement: %v", result)
+	}
+}
+
+func TestBindStatement(t *testing.T) {
+	dbFile := "./BindStatement.db"
+	table := backend.OpenDB(dbFile)
+
+	prepared, _ := CompileStatement("insert ? ? ?")
+	var statement Statement
+	if BindStatement(prepared, &statement) != PrepareUnboundParameter {
+		t.Errorf("result must be unbound parameter")
+	}
+
+	if BindInt(prepared, 4, 1) != BindIndexOutOfRange {
+		t.Errorf("result must be index out of range")
+	}
+
+	for i := int64(1); i <= 10; i++ {
+		BindInt(prepared, 1, i)
+		BindString(prepared, 2, "chen' or 1=1")
+		BindFloat(prepared, 3, 1.5)
+		if BindStatement(prepared, &statement) != PrepareSuccess {
+			t.Errorf("bind statement must be success")
+		}
+
+		if RunStatement(table, &statement) != ExecuteSuccess {
+			t.Errorf("result must be execute success")
+		}
+	}
+
+	var row backend.Row
+	backend.DeserializeRow(backend.CursorValue(backend.CursorBegin(table)), &row)
+	if row.PrimaryID != 1 || util.ToString(row.UserName[:]) != "chen' or 1=1" || util.ToString(row.Email[:]) != "1.5" {
+		t.Errorf("Row (%v, %s, %s) Error", row.PrimaryID, util.ToString(row.UserName[:]), util.ToString(row.Email[:]))
+	}
+
+	BindFloat(prepared, 1, 1.5)
+	if BindStatement(prepared, &statement) != PrepareTypeMismatch {
+		t.Errorf("non-integral float can not be primary id")
+	}
+
+	BindInt(prepared, 1, -1)
+	if BindStatement(prepared, &statement) != PrepareTypeMismatch {
+		t.Errorf("negative int can not be primary id")
+	}
+
+	BindInt(prepared, 1, 11)
+	BindString(prepared, 2, util.RandString(backend.UserNameSize+1))
+	if BindStatement(prepared, &statement) != PrepareStringTooLong {
+		t.Errorf("result must be string too long")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestStatementCache(t *testing.T) {
+	cache := NewStatementCache()
+	prepared, result := PrepareCached(cache, "insert ? ? ?")
+	if result != PrepareSuccess {
+		t.Errorf("result must be success: %v", result)
+	}
+	BindInt(prepared, 1, 1)
+
+	cached, _ := PrepareCached(cache, "insert ? ? ?")
+	if len(cache.Statements) != 1 || cached == prepared {
+		t.Errorf("compiled statement must be cached by SQL text and copied for each user")
+	}
+
+	// The users of a cache have their own bindings
+	if cached.Params[0].Type != ValueUnbound || prepared.Params[0].Type != ValueInt {
+		t.Errorf("bindings of cached statement must not be shared")
+	}
+	if cache.Statements["insert ? ? ?"].Params[0].Type != ValueUnbound {
+		t.Errorf("bindings must not change the cached statement")
+	}
+
+	for i := 0; i < StatementCacheSize+1; i++ {
+		PrepareCached(cache, "insert ? ? "+util.RandString(4))
+	}
+
+	if len(cache.Statements) != StatementCacheSize {
+		t.Errorf("cache size must be %v, but it is %v", StatementCacheSize, len(cache.Statements))
+	}
+}
+
+func TestWhereParameters(t *testing.T) {
+	prepared, result := CompileStatement("select where id >= ? and username = $2")
+	if result != PrepareSuccess || NumParams(prepared) != 2 {
+		t.Errorf("select with placeholders must be compiled with 2 params: %v", result)
+	}
+
+	var statement Statement
+	BindInt(prepared, 1, 3)
+	if BindStatement(prepared, &statement) != PrepareUnboundParameter {
+		t.Errorf("result must be unbound parameter")
+	}
+
+	BindString(prepared, 2, "chen' or 1=1")
+	if BindStatement(prepared, &statement) != PrepareSuccess {
+		t.Errorf("bind statement must be success")
+	}
+	if statement.Where.Left.Right.Type != ExprLiteral || statement.Where.Left.Right.Value.Int != 3 ||
+		statement.Where.Right.Right.Value.String != "chen' or 1=1" {
+		t.Errorf("placeholders must be replaced by bound values")
+	}
+	if prepared.Template.Where.Left.Right.Type != ExprParam {
+		t.Errorf("binding must not change the compiled statement")
+	}
+
+	inputBuffer := cli.InputBuffer{Buffer: "select where id = ?"}
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+	if PrepareStatement(&inputBuffer, &statement) != PrepareUnboundParameter {
+		t.Errorf("placeholder of statement text must be unbound parameter")
+	}
+
+	_, result = CompileStatement("create table t (id integer primary key, name text check (name != ?), email text)")
+	if result != PrepareSyntaxError {
+		t.Errorf("placeholder in CHECK constraint must be syntax error: %v", result)
+	}
+}
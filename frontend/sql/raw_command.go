@@ -0,0 +1,477 @@
+package sql
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+	"tiny-rdb/util"
+)
+
+// RawCommand a raw command of the REPL, the line starting with '#'
+type RawCommand struct {
+	Name          string
+	Usage         string   // arguments shown by #help, empty if it has none
+	Help          string   // one line description shown by #help, empty hides the command from #help and completion
+	Arguments     []string // words completed as the argument
+	TableArgument bool     // the argument is a table name, it is completed with the table name
+	Run           func(shell *Shell, args []string) RawCommandResult
+}
+
+var rawCommands = map[string]*RawCommand{}
+
+// RegisterRawCommand Register a raw command, a command of the same name is replaced
+func RegisterRawCommand(command *RawCommand) {
+	rawCommands[command.Name] = command
+}
+
+// LookupRawCommand Get the raw command by name, return nil if there is no such command
+func LookupRawCommand(name string) *RawCommand {
+	return rawCommands[name]
+}
+
+// RawCommandNames Get the sorted names of the raw commands which are not hidden
+func RawCommandNames() []string {
+	var names []string
+	for name, command := range rawCommands {
+		if command.Help != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterRawCommand(&RawCommand{Name: "#exit", Help: "Close the database and exit", Run: runExitCommand})
+	RegisterRawCommand(&RawCommand{Name: "#quit", Help: "Close the database and exit", Run: runExitCommand})
+	RegisterRawCommand(&RawCommand{Name: "#other", Run: func(shell *Shell, args []string) RawCommandResult {
+		return RawCommandSuccess
+	}})
+	RegisterRawCommand(&RawCommand{Name: "#help", Help: "Show the raw commands", Run: runHelpCommand})
+	RegisterRawCommand(&RawCommand{Name: "#btree", Help: "Print the B-tree", Run: runBTreeCommand})
+	RegisterRawCommand(&RawCommand{Name: "#mode", Usage: "table|csv|json|jsonl|markdown",
+		Help:      "Set the output mode, print the current mode without argument",
+		Arguments: []string{"table", "csv", "json", "jsonl", "markdown"}, Run: runModeCommand})
+	RegisterRawCommand(&RawCommand{Name: "#headers", Usage: "on|off", Help: "Show or hide the column names",
+		Arguments: []string{"on", "off"}, Run: runHeadersCommand})
+	RegisterRawCommand(&RawCommand{Name: "#read", Usage: "file.sql", Help: "Run the statements of script file",
+		Run: runReadCommand})
+	RegisterRawCommand(&RawCommand{Name: "#tables", Help: "List the tables", Run: runTablesCommand})
+	RegisterRawCommand(&RawCommand{Name: "#schema", Usage: "[table]", Help: "Print the create statement of tables",
+		TableArgument: true, Run: runSchemaCommand})
+	RegisterRawCommand(&RawCommand{Name: "#indexes", Help: "List the indexes", Run: runIndexesCommand})
+	RegisterRawCommand(&RawCommand{Name: "#dbinfo", Help: "Print the page and file statistics of the database",
+		Run: runDBInfoCommand})
+	RegisterRawCommand(&RawCommand{Name: "#pages", Help: "List the pages of the B-tree", Run: runPagesCommand})
+	RegisterRawCommand(&RawCommand{Name: "#timer", Usage: "on|off", Help: "Print the run time of each statement",
+		Arguments: []string{"on", "off"}, Run: runTimerCommand})
+	RegisterRawCommand(&RawCommand{Name: "#synchronous", Usage: "[off|normal|full]",
+		Help: "Show or set when the written pages are synced to disk", Arguments: []string{"off", "normal", "full"},
+		Run: runSynchronousCommand})
+	RegisterRawCommand(&RawCommand{Name: "#import", Usage: "file.csv table", Help: "Insert the rows of CSV file into table",
+		Run: runImportCommand})
+	RegisterRawCommand(&RawCommand{Name: "#export", Usage: "table file.csv", Help: "Write the rows of table to CSV file",
+		TableArgument: true, Run: runExportCommand})
+	RegisterRawCommand(&RawCommand{Name: "#dump", Usage: "[table]", Help: "Print the statements which make the table again",
+		TableArgument: true, Run: runDumpCommand})
+	RegisterRawCommand(&RawCommand{Name: "#backup", Usage: "dest.db", Help: "Copy the database to another DB file online",
+		Run: runBackupCommand})
+}
+
+// RunRawCommand Run raw command
+func RunRawCommand(inputBuffer *cli.InputBuffer, table *backend.Table) RawCommandResult {
+	var shell *Shell = &Shell{Table: table, Errors: os.Stdout}
+	return shell.runRawCommand(inputBuffer.Buffer)
+}
+
+// runRawCommand Look up the raw command of line and run it with the rest words of line as arguments
+func (shell *Shell) runRawCommand(line string) RawCommandResult {
+	var fields []string = strings.Fields(line)
+	if len(fields) == 0 {
+		return RawCommandUnrecognizedCMD
+	}
+	var command *RawCommand = LookupRawCommand(fields[0])
+	if command == nil {
+		return RawCommandUnrecognizedCMD
+	}
+	return command.Run(shell, fields[1:])
+}
+
+// usage Report the wrong arguments of command
+func (shell *Shell) usage(command string) RawCommandResult {
+	shell.fail("Usage: %s %s\n", command, LookupRawCommand(command).Usage)
+	return RawCommandFailed
+}
+
+func runExitCommand(shell *Shell, args []string) RawCommandResult {
+	backend.CloseDB(shell.Table)
+	os.Exit(util.ExitSuccess)
+	return RawCommandSuccess
+}
+
+func runHelpCommand(shell *Shell, args []string) RawCommandResult {
+	var lines [][2]string
+	var width int
+	for _, name := range RawCommandNames() {
+		var command *RawCommand = LookupRawCommand(name)
+		var synopsis string = strings.TrimSpace(name + " " + command.Usage)
+		if len(synopsis) > width {
+			width = len(synopsis)
+		}
+		lines = append(lines, [2]string{synopsis, command.Help})
+	}
+	for _, line := range lines {
+		fmt.Fprintf(Output.Writer, "%-*s  %s\n", width, line[0], line[1])
+	}
+	return RawCommandSuccess
+}
+
+func runBTreeCommand(shell *Shell, args []string) RawCommandResult {
+	fmt.Println("Visual B-Tree:")
+	shell.Table.RWLock.RLock()
+	backend.PrintTree(shell.Table.Pager, shell.Table.RootPageNum, 0)
+	shell.Table.RWLock.RUnlock()
+	return RawCommandSuccess
+}
+
+// runModeCommand #mode [table|csv|json|jsonl|markdown], print the current mode without argument
+func runModeCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) == 0 {
+		for name, mode := range OutputModeNames {
+			if mode == Output.Mode {
+				fmt.Fprintln(Output.Writer, name)
+			}
+		}
+		return RawCommandSuccess
+	}
+
+	mode, ok := OutputModeNames[args[0]]
+	if len(args) != 1 || !ok {
+		return shell.usage("#mode")
+	}
+	Output.Mode = mode
+	return RawCommandSuccess
+}
+
+// runHeadersCommand #headers on|off
+func runHeadersCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return shell.usage("#headers")
+	}
+	Output.Headers = args[0] == "on"
+	return RawCommandSuccess
+}
+
+// runReadCommand #read file.sql, it fails if the script can not be read or it stopped at an error by Bail
+func runReadCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 1 {
+		return shell.usage("#read")
+	}
+	if !shell.RunFile(args[0]) {
+		return RawCommandFailed
+	}
+	return RawCommandSuccess
+}
+
+// runTimerCommand #timer on|off
+func runTimerCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return shell.usage("#timer")
+	}
+	shell.Timer = args[0] == "on"
+	return RawCommandSuccess
+}
+
+// runSynchronousCommand #synchronous [off|normal|full]
+func runSynchronousCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) > 1 {
+		return shell.usage("#synchronous")
+	}
+	var pager *backend.Pager = shell.Table.Pager
+	if len(args) == 0 {
+		shell.Table.RWLock.RLock()
+		var level backend.Synchronous = pager.Synchronous
+		shell.Table.RWLock.RUnlock()
+		fmt.Fprintln(Output.Writer, backend.SynchronousName(level))
+		return RawCommandSuccess
+	}
+
+	level, ok := backend.ParseSynchronous(args[0])
+	if !ok {
+		return shell.usage("#synchronous")
+	}
+	shell.Table.RWLock.Lock()
+	pager.Synchronous = level
+	shell.Table.RWLock.Unlock()
+	return RawCommandSuccess
+}
+
+// runTablesCommand #tables, the DB file holds a single table
+func runTablesCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 0 {
+		return shell.usage("#tables")
+	}
+	shell.Table.RWLock.RLock()
+	var name string = shell.Table.Schema.TableName
+	shell.Table.RWLock.RUnlock()
+	fmt.Fprintln(Output.Writer, name)
+	return RawCommandSuccess
+}
+
+// runSchemaCommand #schema [table]
+func runSchemaCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) > 1 {
+		return shell.usage("#schema")
+	}
+	if len(args) == 1 && !shell.checkTableName(args[0]) {
+		return RawCommandFailed
+	}
+	shell.Table.RWLock.RLock()
+	var schema backend.Schema = *shell.Table.Schema
+	shell.Table.RWLock.RUnlock()
+	fmt.Fprintln(Output.Writer, SchemaSQL(&schema)+";")
+	return RawCommandSuccess
+}
+
+// SchemaSQL Get the create statement of schema, running it creates the same table
+func SchemaSQL(schema *backend.Schema) string {
+	var definitions []string
+	for i := range schema.Columns {
+		var column *backend.Column = &schema.Columns[i]
+		var definition []string = []string{column.Name, columnTypeName(column.Type)}
+		if column.PrimaryKey {
+			definition = append(definition, "primary key")
+		}
+		if column.AutoIncrement {
+			definition = append(definition, "autoincrement")
+		}
+		if column.NotNull && !column.PrimaryKey {
+			definition = append(definition, "not null")
+		}
+		if column.Unique {
+			definition = append(definition, "unique")
+		}
+		if column.Default != nil {
+			definition = append(definition, "default", QuoteString(*column.Default))
+		}
+		if column.Check != "" {
+			definition = append(definition, "check ("+column.Check+")")
+		}
+		definitions = append(definitions, strings.Join(definition, " "))
+	}
+	return fmt.Sprintf("create table %s (%s)", schema.TableName, strings.Join(definitions, ", "))
+}
+
+// columnTypeName Get the name of column type used in create statement
+func columnTypeName(columnType backend.ColumnType) string {
+	if columnType == backend.ColumnInteger {
+		return "integer"
+	}
+	return "text"
+}
+
+// runIndexesCommand #indexes, the rows are indexed by the B-tree of primary key only,
+// UNIQUE constraints are checked by scanning the table
+func runIndexesCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 0 {
+		return shell.usage("#indexes")
+	}
+	shell.Table.RWLock.RLock()
+	var schema *backend.Schema = shell.Table.Schema
+	var rows [][]interface{} = [][]interface{}{{
+		schema.TableName + "_pkey", schema.TableName, schema.Columns[backend.ColumnPrimaryID].Name,
+		int64(shell.Table.RootPageNum), "B-tree",
+	}}
+
+	// There is no secondary index, each insert and update checks a UNIQUE column by scanning the table
+	for i, column := range schema.Columns {
+		if column.Unique && i != backend.ColumnPrimaryID {
+			rows = append(rows, []interface{}{schema.TableName + "_" + column.Name + "_key", schema.TableName, column.Name,
+				nil, "full scan"})
+		}
+	}
+	shell.Table.RWLock.RUnlock()
+
+	FormatResult(Output, []string{"index", "table", "column", "root", "lookup"}, rows)
+	return RawCommandSuccess
+}
+
+// runDBInfoCommand #dbinfo
+func runDBInfoCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 0 {
+		return shell.usage("#dbinfo")
+	}
+	var table *backend.Table = shell.Table
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+
+	// The pages in the cache are written at close, so the file may be shorter than the pages
+	var fileName string
+	var fileLength int64
+	if table.Pager.FilePtr != nil {
+		fileName = table.Pager.FilePtr.Name()
+		if info, err := table.Pager.FilePtr.Stat(); err == nil {
+			fileLength = info.Size()
+		}
+	}
+	leafPages, numCells := backend.CountLeafCells(table)
+
+	var info = []struct {
+		name  string
+		value interface{}
+	}{
+		{"file", fileName},
+		{"page size", backend.PageSize},
+		{"page count", table.Pager.NumPages},
+		{"file length", fileLength},
+		{"max pages", backend.TableMaxPages},
+		{"tree depth", backend.TreeDepth(table)},
+		{"root page", table.RootPageNum},
+		{"leaf pages", leafPages},
+		{"rows", numCells},
+		{"freelist size", 0}, // pages are never freed, deleting rows leaves them in their leaves
+		{"read only", table.ReadOnly},
+		{"synchronous", backend.SynchronousName(table.Pager.Synchronous)},
+	}
+	for _, field := range info {
+		fmt.Fprintf(Output.Writer, "%-14s %v\n", field.name+":", field.value)
+	}
+	return RawCommandSuccess
+}
+
+// runPagesCommand #pages, one row per page: its node type, number of cells, parent and next leaf
+func runPagesCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 0 {
+		return shell.usage("#pages")
+	}
+	var table *backend.Table = shell.Table
+	table.RWLock.RLock()
+	var rows [][]interface{}
+	for pageNum := uint32(0); pageNum < table.Pager.NumPages; pageNum++ {
+		var node []byte = backend.GetPage(table.Pager, pageNum).Mem[:]
+		var row []interface{} = []interface{}{int64(pageNum), "leaf", "no", nil, nil, nil}
+		if backend.IsRootNode(node) {
+			row[2] = "yes"
+		} else {
+			row[4] = int64(*backend.ParentNode(node))
+		}
+		if backend.GetNodeType(node) == backend.TypeInternalNode {
+			row[1] = "internal"
+			row[3] = int64(*backend.InternalNodeNumKeys(node))
+		} else {
+			row[3] = int64(*backend.LeafNodeNumCells(node))
+			if next := *backend.LeafNodeNextLeaf(node); next != 0 {
+				row[5] = int64(next)
+			}
+		}
+		rows = append(rows, row)
+	}
+	table.RWLock.RUnlock()
+
+	FormatResult(Output, []string{"page", "type", "root", "cells", "parent", "next"}, rows)
+	return RawCommandSuccess
+}
+
+// checkTableName Check if name is the name of table, the DB file holds a single table
+func (shell *Shell) checkTableName(name string) bool {
+	shell.Table.RWLock.RLock()
+	var tableName string = shell.Table.Schema.TableName
+	shell.Table.RWLock.RUnlock()
+	if name != tableName {
+		shell.fail("Error: No such table: %s\n", name)
+		return false
+	}
+	return true
+}
+
+// runImportCommand #import file.csv table, the records which are not imported are reported with their number
+func runImportCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 2 {
+		return shell.usage("#import")
+	}
+	if !shell.checkTableName(args[1]) {
+		return RawCommandFailed
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+	defer file.Close()
+
+	report, result := ImportCSV(shell.Table, file)
+	if result != ExecuteSuccess {
+		shell.fail("%s\n", ExecuteResultMessage(result))
+		return RawCommandFailed
+	}
+	for _, importError := range report.Errors {
+		shell.fail("%s:%v: %s\n", args[0], importError.Record, importError.Message)
+	}
+	fmt.Fprintf(Output.Writer, "Imported %v rows, %v failed.\n", report.Imported, len(report.Errors))
+	if len(report.Errors) > 0 {
+		return RawCommandFailed
+	}
+	return RawCommandSuccess
+}
+
+// runExportCommand #export table file.csv
+func runExportCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 2 {
+		return shell.usage("#export")
+	}
+	if !shell.checkTableName(args[0]) {
+		return RawCommandFailed
+	}
+	file, err := os.Create(args[1])
+	if err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+
+	count, err := ExportCSV(shell.Table, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+	fmt.Fprintf(Output.Writer, "Exported %v rows.\n", count)
+	return RawCommandSuccess
+}
+
+// runDumpCommand #dump [table]
+func runDumpCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) > 1 {
+		return shell.usage("#dump")
+	}
+	if len(args) == 1 && !shell.checkTableName(args[0]) {
+		return RawCommandFailed
+	}
+	if err := Dump(shell.Table, Output.Writer); err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+	return RawCommandSuccess
+}
+
+// runBackupCommand #backup dest.db, the pages are copied from a snapshot so the table can change meanwhile
+func runBackupCommand(shell *Shell, args []string) RawCommandResult {
+	if len(args) != 1 {
+		return shell.usage("#backup")
+	}
+	backup, err := backend.NewBackup(shell.Table, args[0])
+	if err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+	if _, err := backup.Step(backend.BackupStepAll); err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return RawCommandFailed
+	}
+	fmt.Fprintf(Output.Writer, "Backed up %v pages to %s.\n", backup.PageCount(), args[0])
+	return RawCommandSuccess
+}
@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"tiny-rdb/backend"
+)
+
+func TestRawCommands(t *testing.T) {
+	dbFile := "./RawCommands.db"
+	table := backend.OpenDB(dbFile)
+
+	var errors, output bytes.Buffer
+	var writer = Output.Writer
+	Output.Writer = &output
+	defer func() { Output.Writer = writer }()
+
+	var shell *Shell = &Shell{Table: table, Errors: &errors}
+	shell.RunScript("create table people (id integer primary key autoincrement, name text not null unique default 'it''s', " +
+		"email text check (email like '%@%'));")
+	for i := 1; i <= 20; i++ {
+		shell.RunStatementText("insert " + strconv.Itoa(i) + " name" + strconv.Itoa(i) + " a@b.c")
+	}
+
+	var cases = []struct {
+		line   string
+		output string
+	}{
+		{"#tables", "people\n"},
+		{"#schema", "create table people (id integer primary key autoincrement, name text not null unique default 'it''s', " +
+			"email text check (email like '%@%'));\n"},
+		{"#schema people", "create table people (id integer primary key autoincrement, name text not null unique default 'it''s', " +
+			"email text check (email like '%@%'));\n"},
+		{"#indexes", "" +
+			"┌─────────────────┬────────┬────────┬──────┬───────────┐\n" +
+			"│ index           │ table  │ column │ root │ lookup    │\n" +
+			"├─────────────────┼────────┼────────┼──────┼───────────┤\n" +
+			"│ people_pkey     │ people │ id     │    0 │ B-tree    │\n" +
+			"│ people_name_key │ people │ name   │ NULL │ full scan │\n" +
+			"└─────────────────┴────────┴────────┴──────┴───────────┘\n"},
+		{"#pages", "" +
+			"┌──────┬──────────┬──────┬───────┬────────┬──────┐\n" +
+			"│ page │ type     │ root │ cells │ parent │ next │\n" +
+			"├──────┼──────────┼──────┼───────┼────────┼──────┤\n" +
+			"│    0 │ internal │ yes  │     1 │ NULL   │ NULL │\n" +
+			"│    1 │ leaf     │ no   │     7 │      0 │ NULL │\n" +
+			"│    2 │ leaf     │ no   │    13 │      0 │    1 │\n" +
+			"└──────┴──────────┴──────┴───────┴────────┴──────┘\n"},
+	}
+	for _, c := range cases {
+		output.Reset()
+		if !shell.RunRawCommand(c.line) || output.String() != c.output {
+			t.Errorf("output of %v must be\n%v\nbut it is\n%v", c.line, c.output, output.String())
+		}
+	}
+
+	output.Reset()
+	shell.RunRawCommand("#dbinfo")
+	for _, line := range []string{"page size:     4096\n", "page count:    3\n", "tree depth:    2\n", "leaf pages:    2\n",
+		"rows:          20\n", "freelist size: 0\n", "synchronous:   full\n"} {
+		if !strings.Contains(output.String(), line) {
+			t.Errorf("#dbinfo must print %q: %q", line, output.String())
+		}
+	}
+
+	output.Reset()
+	shell.RunRawCommand("#timer on")
+	shell.RunStatementText("select where id = 1")
+	if !strings.Contains(output.String(), "Run Time: ") {
+		t.Errorf("run time must be printed: %q", output.String())
+	}
+	shell.RunRawCommand("#timer off")
+
+	output.Reset()
+	shell.RunRawCommand("#synchronous normal")
+	shell.RunRawCommand("#synchronous")
+	if output.String() != "normal\n" || table.Pager.Synchronous != backend.SynchronousNormal {
+		t.Errorf("synchronous must be normal: %q", output.String())
+	}
+
+	output.Reset()
+	shell.RunRawCommand("#help")
+	if !strings.Contains(output.String(), "#schema [table]") || strings.Contains(output.String(), "#other") {
+		t.Errorf("help must list the commands but the hidden ones: %q", output.String())
+	}
+
+	if shell.Failed {
+		t.Errorf("no command must fail: %q", errors.String())
+	}
+	for _, line := range []string{"#schema users", "#timer", "#mode xml", "#synchronous extra", "#unknown"} {
+		shell.Failed = false
+		if shell.RunRawCommand(line) || !shell.Failed {
+			t.Errorf("%v must fail", line)
+		}
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+}
@@ -0,0 +1,166 @@
+package sql
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"tiny-rdb/backend"
+)
+
+// KeyRange the range of primary key the select statement needs to scan
+type KeyRange struct {
+	Lower   uint32
+	Upper   uint32
+	IsEmpty bool
+}
+
+// FullKeyRange the range of all keys
+var FullKeyRange KeyRange = KeyRange{Lower: 0, Upper: math.MaxUint32}
+
+// IsFullRange Check if the key range covers all keys
+func IsFullRange(keyRange KeyRange) bool {
+	return !keyRange.IsEmpty && keyRange.Lower == 0 && keyRange.Upper == math.MaxUint32
+}
+
+// PredicateKeyRange Extract the range of primary key from the comparisons of primary key and number joined by AND.
+// The rows out of the range never satisfy the predicate, so only the range needs to be scanned.
+func PredicateKeyRange(expr *Expr, schema *backend.Schema) KeyRange {
+	var keyRange KeyRange = FullKeyRange
+	narrowKeyRange(expr, schema.Columns[backend.ColumnPrimaryID].Name, &keyRange)
+	return keyRange
+}
+
+var flippedOps map[string]string = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+func narrowKeyRange(expr *Expr, keyColumn string, keyRange *KeyRange) {
+	if expr == nil || expr.Type != ExprBinary {
+		return
+	}
+
+	if expr.Op == "and" {
+		narrowKeyRange(expr.Left, keyColumn, keyRange)
+		narrowKeyRange(expr.Right, keyColumn, keyRange)
+		return
+	}
+
+	// key op number, or number op key
+	var op string = expr.Op
+	var literal *Expr = expr.Right
+	if expr.Right.Type == ExprColumn && expr.Right.Column == keyColumn {
+		op = flippedOps[expr.Op]
+		literal = expr.Left
+	} else if expr.Left.Type != ExprColumn || expr.Left.Column != keyColumn {
+		return
+	}
+
+	if _, ok := flippedOps[op]; !ok || literal.Type != ExprLiteral || literal.Value.Type == ValueString {
+		return
+	}
+	number, ok := valueNumber(literal.Value)
+	if !ok {
+		return
+	}
+
+	// Clamp the bounds into the range of uint32, and the range is empty if they cross
+	var lower, upper float64 = float64(keyRange.Lower), float64(keyRange.Upper)
+	switch op {
+	case "=":
+		lower = math.Max(lower, math.Ceil(number))
+		upper = math.Min(upper, math.Floor(number))
+	case ">":
+		lower = math.Max(lower, math.Floor(number)+1)
+	case ">=":
+		lower = math.Max(lower, math.Ceil(number))
+	case "<":
+		upper = math.Min(upper, math.Ceil(number)-1)
+	case "<=":
+		upper = math.Min(upper, math.Floor(number))
+	}
+
+	if lower > upper || upper < 0 || lower > math.MaxUint32 {
+		keyRange.IsEmpty = true
+		return
+	}
+	keyRange.Lower = uint32(lower)
+	keyRange.Upper = uint32(upper)
+}
+
+// isKeyOrder Check if the rows are ordered by primary key, so they can be read from B-tree in order
+func isKeyOrder(statement *Statement, schema *backend.Schema) bool {
+	return statement.OrderBy == "" || statement.OrderBy == schema.Columns[backend.ColumnPrimaryID].Name
+}
+
+// SelectRows Visit the rows selected by the select statement in order, stop if visit returns false.
+// Rows are read by a bounded range scan if the predicate limits the primary key, and in descending
+// order with CursorPrev for "order by id desc". Ordering by the other columns is sorted in memory.
+// Rows are read from the snapshot of table, so the scan neither blocks writers nor sees the changes made during it.
+func SelectRows(table *backend.Table, statement *Statement, visit func(row *backend.Row) bool) ExecuteResult {
+	table = backend.Snapshot(table)
+
+	if !ResolveExpr(statement.Where, table.Schema) {
+		return ExecuteUnknownColumn
+	}
+
+	var orderColumn int = backend.ColumnPrimaryID
+	if statement.OrderBy != "" {
+		orderColumn = backend.ColumnIndex(table.Schema, statement.OrderBy)
+		if orderColumn < 0 {
+			return ExecuteUnknownColumn
+		}
+	}
+
+	var keyRange KeyRange = PredicateKeyRange(statement.Where, table.Schema)
+	if keyRange.IsEmpty {
+		return ExecuteSuccess
+	}
+
+	var descending bool = statement.Descending && orderColumn == backend.ColumnPrimaryID
+	var cursor *backend.Cursor
+	var next func(cursor *backend.Cursor)
+	if descending {
+		cursor = backend.CursorReverseRange(table, keyRange.Lower, keyRange.Upper)
+		next = backend.CursorPrev
+	} else {
+		cursor = backend.CursorRange(table, keyRange.Lower, keyRange.Upper)
+		next = backend.CursorNext
+	}
+
+	var sorted []backend.Row
+	for ; !cursor.IsEndOfTable; next(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+
+		// Only the rows which the predicate is TRUE are selected, FALSE and UNKNOWN are filtered
+		if statement.Where != nil && !IsTrue(EvalExpr(statement.Where, &row, table.Schema)) {
+			continue
+		}
+
+		if orderColumn != backend.ColumnPrimaryID {
+			sorted = append(sorted, row)
+		} else if !visit(&row) {
+			return ExecuteSuccess
+		}
+	}
+
+	if orderColumn == backend.ColumnPrimaryID {
+		return ExecuteSuccess
+	}
+
+	// NULLs come first in ascending order, like SQLite
+	sort.SliceStable(sorted, func(i int, j int) bool {
+		var left, right Value = ColumnValue(&sorted[i], orderColumn), ColumnValue(&sorted[j], orderColumn)
+		if statement.Descending {
+			left, right = right, left
+		}
+		if left.Type == ValueNull || right.Type == ValueNull {
+			return left.Type == ValueNull && right.Type != ValueNull
+		}
+		return strings.Compare(left.String, right.String) < 0
+	})
+	for i := range sorted {
+		if !visit(&sorted[i]) {
+			break
+		}
+	}
+	return ExecuteSuccess
+}
@@ -0,0 +1,97 @@
+package sql
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+	"tiny-rdb/util"
+)
+
+func prepareText(t *testing.T, text string) *Statement {
+	inputBuffer := cli.NewInputBuffer()
+	inputBuffer.Buffer = text
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+
+	var statement Statement
+	if result := PrepareStatement(inputBuffer, &statement); result != PrepareSuccess {
+		t.Fatalf("prepare %v must be success: %v", text, result)
+	}
+	return &statement
+}
+
+func TestPredicateKeyRange(t *testing.T) {
+	schema := backend.DefaultSchema()
+	cases := []struct {
+		where string
+		lower uint32
+		upper uint32
+		empty bool
+	}{
+		{"id = 5", 5, 5, false},
+		{"id >= 3 and id < 10", 3, 9, false},
+		{"10 > id and id > 2.5", 3, 9, false},
+		{"id > 3 and username = 'chen'", 4, 4294967295, false},
+		{"id < 0", 0, 0, true},
+		{"id = 2.5", 0, 0, true},
+		{"id > 5 and id < 3", 0, 0, true},
+		{"id = 1 or id = 9", 0, 4294967295, false},
+		{"id != 5", 0, 4294967295, false},
+	}
+	for _, c := range cases {
+		statement := prepareText(t, "select where "+c.where)
+		keyRange := PredicateKeyRange(statement.Where, schema)
+		if keyRange.IsEmpty != c.empty || (!c.empty && (keyRange.Lower != c.lower || keyRange.Upper != c.upper)) {
+			t.Errorf("%v: key range is wrong: %v", c.where, keyRange)
+		}
+	}
+}
+
+func TestSelectRows(t *testing.T) {
+	dbFile := "./SelectRows.db"
+	table := backend.OpenDB(dbFile)
+	for i := 1; i <= 50; i++ {
+		runStatementText(t, table, fmt.Sprintf("insert %d %s %s", i, util.RandString(8), util.RandString(8)+"@google.com"))
+	}
+	runStatementText(t, table, "update 25 NULL")
+
+	selectKeys := func(text string) []uint32 {
+		var keys []uint32
+		if result := SelectRows(table, prepareText(t, text), func(row *backend.Row) bool {
+			keys = append(keys, row.PrimaryID)
+			return true
+		}); result != ExecuteSuccess {
+			t.Errorf("%v: result must be execute success: %v", text, result)
+		}
+		return keys
+	}
+
+	keys := selectKeys("select where id >= 20 and id <= 30 and username is not null")
+	if len(keys) != 10 || keys[0] != 20 || keys[9] != 30 {
+		t.Errorf("range select is wrong: %v", keys)
+	}
+
+	keys = selectKeys("select where id > 40 order by id desc")
+	if len(keys) != 10 || keys[0] != 50 || keys[9] != 41 {
+		t.Errorf("descending select is wrong: %v", keys)
+	}
+
+	keys = selectKeys("select order by username desc")
+	if len(keys) != 50 || keys[49] != 25 {
+		t.Errorf("NULL must be the last in descending order: %v", keys)
+	}
+
+	lines := FormatPlan(PlanStatement(table, prepareText(t, "select where id >= 20 and id <= 30 order by id desc")))
+	if !strings.Contains(strings.Join(lines, "\n"), "SeekLE(key=30)") || !strings.Contains(strings.Join(lines, "\n"), "~11 rows") {
+		t.Errorf("plan must seek the key range in reverse: %v", lines)
+	}
+
+	if RunStatement(table, prepareText(t, "select order by name")) != ExecuteUnknownColumn {
+		t.Errorf("order by unknown column must fail")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
@@ -0,0 +1,273 @@
+package sql
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+)
+
+// MaxReadDepth how deep #read can nest, so a script reading itself stops
+const MaxReadDepth = 16
+
+// Shell runs the statements and raw commands read from its input, it is the REPL and the script runner.
+//
+// In interactive mode a line is a statement, or several statements separated by ';', and a statement continues
+// on the next line only if it ends in a quoted string. In scripts statements end with ';' and can span lines,
+// the statement after the last ';' runs at the end of script. In both modes a line starting with '#' is a raw command
+// if no statement is pending, and "--" starts a comment to the end of line.
+type Shell struct {
+	Table       *backend.Table
+	Interactive bool      // print the prompts and the messages of success
+	Bail        bool      // stop at the first error
+	Errors      io.Writer // where the error messages go, stdout in interactive mode and stderr in scripts
+	Failed      bool      // a statement or raw command failed
+	Timer       bool      // print the run time of each statement, set by #timer
+
+	depth int // nesting of #read
+}
+
+// NewShell Make a shell of the table, it is interactive if stdin is a terminal
+func NewShell(table *backend.Table) *Shell {
+	var shell *Shell = new(Shell)
+	shell.Table = table
+	shell.Interactive = cli.IsTerminal(os.Stdin)
+	shell.Errors = os.Stderr
+	if shell.Interactive {
+		shell.Errors = os.Stdout
+	}
+	return shell
+}
+
+// statementSplitter Split the input lines to statements
+type statementSplitter struct {
+	pending strings.Builder
+	inQuote bool
+}
+
+// feed Feed a line, return the statements completed by it. endsStatement makes the line end the pending statement
+// unless it is in a quoted string.
+func (splitter *statementSplitter) feed(line string, endsStatement bool) []string {
+	var statements []string
+	var runes []rune = []rune(line)
+	for i := 0; i < len(runes); i++ {
+		var ch rune = runes[i]
+		switch {
+		case ch == '\'':
+			splitter.inQuote = !splitter.inQuote
+		case splitter.inQuote:
+		case ch == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			i = len(runes)
+			continue
+		case ch == ';':
+			statements = append(statements, splitter.flush()...)
+			continue
+		}
+		splitter.pending.WriteRune(ch)
+	}
+
+	if endsStatement && !splitter.inQuote {
+		return append(statements, splitter.flush()...)
+	}
+	if splitter.inQuote {
+		splitter.pending.WriteRune('\n')
+	} else {
+		splitter.pending.WriteRune(' ')
+	}
+	return statements
+}
+
+// flush Take the pending statement, an empty statement is dropped
+func (splitter *statementSplitter) flush() []string {
+	var statement string = strings.TrimSpace(splitter.pending.String())
+	splitter.pending.Reset()
+	splitter.inQuote = false
+	if statement == "" {
+		return nil
+	}
+	return []string{statement}
+}
+
+// hasPending Check if there is a statement not completed
+func (splitter *statementSplitter) hasPending() bool {
+	return strings.TrimSpace(splitter.pending.String()) != ""
+}
+
+// Run Run the statements read from input until its end, return false if it stopped at an error by Bail
+func (shell *Shell) Run(input *cli.InputBuffer) bool {
+	var splitter statementSplitter
+	for {
+		var err error
+		if shell.Interactive {
+			var prompt string = cli.Prompt
+			if splitter.hasPending() {
+				prompt = cli.ContinuePrompt
+			}
+			err = cli.ReadInputWithPrompt(input, prompt)
+		} else {
+			err = cli.ReadInput(input)
+		}
+		if err == cli.ErrInterrupted {
+			// Ctrl-C abandons the pending statement
+			splitter.flush()
+			continue
+		}
+		if err != nil {
+			if shell.Interactive && input.Editor == nil {
+				fmt.Println()
+			}
+			break
+		}
+
+		if !splitter.hasPending() && !splitter.inQuote && input.BufLen > 0 && cli.IsRawCommand(&input.Buffer) {
+			if !shell.RunRawCommand(input.Buffer) && shell.Bail {
+				return false
+			}
+			continue
+		}
+
+		for _, statement := range splitter.feed(input.Buffer, shell.Interactive) {
+			if !shell.RunStatementText(statement) && shell.Bail {
+				return false
+			}
+		}
+	}
+
+	// The statement after the last ';'
+	for _, statement := range splitter.flush() {
+		if !shell.RunStatementText(statement) && shell.Bail {
+			return false
+		}
+	}
+	return true
+}
+
+// RunScript Run the statements of script text, such as the statements given by -c
+func (shell *Shell) RunScript(text string) bool {
+	var interactive bool = shell.Interactive
+	shell.Interactive = false
+	defer func() { shell.Interactive = interactive }()
+	return shell.Run(cli.NewInputBufferFrom(strings.NewReader(text)))
+}
+
+// RunFile Run the statements of script file
+func (shell *Shell) RunFile(path string) bool {
+	if shell.depth >= MaxReadDepth {
+		shell.fail("Error: #read is nested too deep\n")
+		return false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		shell.fail("Error: %s\n", err.Error())
+		return false
+	}
+	defer file.Close()
+
+	var interactive bool = shell.Interactive
+	shell.Interactive = false
+	shell.depth++
+	defer func() {
+		shell.Interactive = interactive
+		shell.depth--
+	}()
+	return shell.Run(cli.NewInputBufferFrom(file))
+}
+
+func (shell *Shell) fail(format string, args ...interface{}) {
+	shell.Failed = true
+	fmt.Fprintf(shell.Errors, format, args...)
+}
+
+// RunRawCommand Run a raw command line, return false if it failed
+func (shell *Shell) RunRawCommand(line string) bool {
+	switch shell.runRawCommand(line) {
+	case RawCommandUnrecognizedCMD:
+		shell.fail("Unrecognized raw command: %v\n", line)
+		return false
+	case RawCommandFailed:
+		return false
+	}
+	return true
+}
+
+// RunStatementText Prepare and run a statement, return false if it failed
+func (shell *Shell) RunStatementText(text string) bool {
+	var statement Statement
+	var prepareResult PrepareStatementResult = PrepareStatement(cli.NewInputBufferOf(text), &statement)
+	if prepareResult != PrepareSuccess {
+		shell.fail("%s\n", PrepareResultMessage(prepareResult, text))
+		return false
+	}
+
+	var start time.Time = time.Now()
+	var result ExecuteResult = RunStatement(shell.Table, &statement)
+	if shell.Timer {
+		fmt.Fprintf(Output.Writer, "Run Time: %.6fs\n", time.Since(start).Seconds())
+	}
+	if result != ExecuteSuccess {
+		shell.fail("%s\n", ExecuteResultMessage(result))
+		return false
+	}
+
+	// Rows printed in the other modes are piped to other tools
+	if shell.Interactive && (statement.Type != SelectStatement || Output.Mode == OutputTable) {
+		fmt.Println("Executed statement.")
+	}
+	return true
+}
+
+// PrepareResultMessage Get the error message of prepare result
+func PrepareResultMessage(result PrepareStatementResult, text string) string {
+	switch result {
+	case PrepareStringTooLong:
+		return "String too long"
+	case PrepareSyntaxError:
+		return "Syntax Error: Cannot parse statement"
+	case PrepareUnrecognizedStatement:
+		return fmt.Sprintf("Unrecognized statement: %v", text)
+	case PrepareTypeMismatch:
+		return "Type Mismatch: Value does not match the column type"
+	case PrepareUnboundParameter:
+		return "Error: Parameters can only be bound to prepared statements"
+	}
+	return ""
+}
+
+// ExecuteResultMessage Get the error message of execute result
+func ExecuteResultMessage(result ExecuteResult) string {
+	switch result {
+	case ExecuteDuplicateKey:
+		return "Error: Duplicate Key"
+	case ExecuteTableFull:
+		return "Error: Table Full"
+	case ExecuteNotNullConstraint:
+		return "Error: NOT NULL constraint failed"
+	case ExecuteUniqueConstraint:
+		return "Error: UNIQUE constraint failed"
+	case ExecuteCheckConstraint:
+		return "Error: CHECK constraint failed"
+	case ExecuteKeyNotFound:
+		return "Error: Key Not Found"
+	case ExecuteUnknownColumn:
+		return "Error: No such column"
+	case ExecuteTableExists:
+		return "Error: Table already exists"
+	case ExecuteTransactionActive:
+		return "Error: Cannot start a transaction within a transaction"
+	case ExecuteNoTransaction:
+		return "Error: No transaction is active"
+	case ExecuteReadOnly:
+		return "Error: Attempt to write a readonly database"
+	case ExecuteConflict:
+		return "Error: Transaction conflicts with a committed change, it is rolled back"
+	case ExecuteVacuumInTransaction:
+		return "Error: Cannot VACUUM from within a transaction"
+	case ExecuteFail:
+		return "Unknown Error: Failed to execute"
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package sql
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/cli"
+)
+
+func TestStatementSplitter(t *testing.T) {
+	var splitter statementSplitter
+	var statements []string
+	for _, line := range []string{"insert 1 'a;b' -- comment;", "  c@d.com; select", "", "where id = 1;"} {
+		statements = append(statements, splitter.feed(line, false)...)
+	}
+	var expected []string = []string{"insert 1 'a;b'    c@d.com", "select  where id = 1"}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("statements must be %q, but they are %q", expected, statements)
+	}
+
+	// In interactive mode a line ends the statement unless it is in a quoted string
+	statements = splitter.feed("insert 2 'multi", true)
+	statements = append(statements, splitter.feed("line' x; select", true)...)
+	expected = []string{"insert 2 'multi\nline' x", "select"}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("statements must be %q, but they are %q", expected, statements)
+	}
+}
+
+func TestShell(t *testing.T) {
+	dbFile := "./Shell.db"
+	scriptFile := "./Shell.sql"
+	ioutil.WriteFile(scriptFile, []byte("insert 3 three t@qq.com;\ninsert 1 dup dup;\n"), 0644)
+	table := backend.OpenDB(dbFile)
+
+	var errors, output bytes.Buffer
+	var writer = Output.Writer
+	Output.Writer = &output
+	defer func() { Output.Writer = writer }()
+
+	var shell *Shell = &Shell{Table: table, Errors: &errors}
+	var script string = "insert 1 chen\n  'we@qq.com';\n#read " + scriptFile + "\ninsert 4 four f@qq.com\n"
+	if !shell.Run(cli.NewInputBufferFrom(strings.NewReader(script))) || !shell.Failed {
+		t.Errorf("script must run to the end and fail")
+	}
+	if errors.String() != "Error: Duplicate Key\n" {
+		t.Errorf("error must be duplicate key: %q", errors.String())
+	}
+
+	output.Reset()
+	shell.RunScript("#mode csv\nselect")
+	if output.String() != "id,username,email\n1,chen,we@qq.com\n3,three,t@qq.com\n4,four,f@qq.com\n" {
+		t.Errorf("all statements but the failed one must run: %q", output.String())
+	}
+	Output.Mode = OutputTable
+
+	// Bail stops at the first error
+	shell = &Shell{Table: table, Errors: &errors, Bail: true}
+	if shell.RunScript("insert 1 a b; insert 5 a b;") {
+		t.Errorf("script must stop at the error")
+	}
+	output.Reset()
+	shell.RunScript("select where id = 5")
+	if strings.Contains(output.String(), "5") {
+		t.Errorf("statement after the error must not run: %q", output.String())
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(scriptFile)
+}
+
+func TestComplete(t *testing.T) {
+	dbFile := "./Complete.db"
+	table := backend.OpenDB(dbFile)
+	var shell *Shell = &Shell{Table: table}
+
+	var cases = []struct {
+		text       string
+		candidates []string
+		start      int
+	}{
+		{"SEL", []string{"select"}, 0},
+		{"select where usern", []string{"username"}, 13},
+		{"select where id=", nil, 16},
+		{"#m", []string{"#mode"}, 0},
+		{"#mode j", []string{"json", "jsonl"}, 6},
+		{"#headers ", []string{"off", "on"}, 9},
+		{"#schema u", []string{"users"}, 8},
+		{"us", []string{"username", "users"}, 0},
+	}
+	for _, c := range cases {
+		candidates, start := shell.Complete(c.text)
+		if !reflect.DeepEqual(candidates, c.candidates) || start != c.start {
+			t.Errorf("completion of %q must be %q at %v, but it is %q at %v", c.text, c.candidates, c.start, candidates, start)
+		}
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
@@ -2,11 +2,10 @@ package sql
 
 import (
 	"fmt"
-	"os"
-	"strings"
+	"math"
+	"strconv"
 	"tiny-rdb/backend"
 	"tiny-rdb/frontend/cli"
-	"tiny-rdb/util"
 )
 
 // const Result var
@@ -32,6 +31,47 @@ const (
 	ExecuteTableFull    = iota
 	ExecuteDuplicateKey = iota
 	ExecuteFail         = iota
+
+	// The values added after the first release are appended below, so the released values never change
+
+	// Prepare Statement Result
+	PrepareUnboundParameter = iota
+	PrepareTypeMismatch     = iota
+
+	// Statement Type
+	UpdateStatement = iota
+
+	// Execute Result
+	ExecuteNotNullConstraint = iota
+	ExecuteUniqueConstraint  = iota
+	ExecuteCheckConstraint   = iota
+	ExecuteKeyNotFound       = iota
+	ExecuteUnknownColumn     = iota
+	ExecuteTableExists       = iota
+
+	// Statement Type
+	BeginStatement    = iota
+	CommitStatement   = iota
+	RollbackStatement = iota
+
+	// Execute Result
+	ExecuteTransactionActive = iota
+	ExecuteNoTransaction     = iota
+
+	// Execute Result
+	ExecuteReadOnly = iota
+
+	// Execute Result
+	ExecuteConflict = iota
+
+	// Raw Command Result
+	RawCommandFailed = iota
+
+	// Statement Type
+	VacuumStatement = iota
+
+	// Execute Result
+	ExecuteVacuumInTransaction = iota
 )
 
 // StatementType type of statement
@@ -51,93 +91,578 @@ type Statement struct {
 	Type        StatementType
 	RowToInsert backend.Row
 	RowToDelete backend.Row
+	RowToUpdate backend.Row
+	Explain     bool
+
+	// Columns given by insert and update statement, the others take default value on insert and keep old value on update
+	AssignedColumns uint32
+	// Columns given DEFAULT keyword
+	DefaultColumns uint32
+	// Insert statement given NULL or DEFAULT id, the id will be assigned on insert
+	AutoID bool
+	// select last_insert_id()
+	SelectLastInsertID bool
+
+	Where          *Expr
+	WhereText      string
+	OrderBy        string
+	Descending     bool
+	SchemaToCreate *backend.Schema
 }
 
-// RunRawCommand Run raw command
-func RunRawCommand(inputBuffer *cli.InputBuffer, table *backend.Table) RawCommandResult {
-	if inputBuffer.Buffer == "#exit" || inputBuffer.Buffer == "#quit" {
-		backend.CloseDB(table)
-		os.Exit(util.ExitSuccess)
+// tokenValue Convert a literal token to value, bare word NULL and DEFAULT are keywords
+func tokenValue(token Token) Value {
+	if token.Kind == TokenWord && IsKeyword(token, "null") {
+		return Value{Type: ValueNull}
 	}
-	if inputBuffer.Buffer == "#other" {
-		return RawCommandSuccess
+	if token.Kind == TokenWord && IsKeyword(token, "default") {
+		return Value{Type: ValueDefault}
 	}
-	if inputBuffer.Buffer == "#btree" {
-		fmt.Println("Visual B-Tree:")
-		backend.PrintTree(table.Pager, table.RootPageNum, 0)
-		return RawCommandSuccess
+	return Value{Type: ValueString, String: token.Text}
+}
+
+// prepareRowValues Prepare values of insert and update statement: id [username [email]]
+func prepareRowValues(values []Token, statement *Statement) PrepareStatementResult {
+	if len(values) < 1 || len(values) > backend.NumColumns {
+		return PrepareSyntaxError
 	}
-	return RawCommandUnrecognizedCMD
+
+	for i, token := range values {
+		if token.Kind == TokenSymbol {
+			return PrepareSyntaxError
+		}
+
+		var value Value = tokenValue(token)
+		if result := bindArgument(statement, i, &value); result != PrepareSuccess {
+			return result
+		}
+	}
+	return PrepareSuccess
 }
 
-func prepareInsert(inputBuffer *cli.InputBuffer, statement *Statement) PrepareStatementResult {
-	statement.Type = InsertStatement
-	var UserName string
-	var Email string
-	argsParsed, err := fmt.Sscanf(inputBuffer.Buffer, "insert %d %s %s", &statement.RowToInsert.PrimaryID, &UserName, &Email)
-	if err != nil {
+func prepareSelect(tokens []Token, statement *Statement) PrepareStatementResult {
+	statement.Type = SelectStatement
+	if len(tokens) == 1 {
+		return PrepareSuccess
+	}
+
+	// select last_insert_id()
+	if len(tokens) == 4 && IsKeyword(tokens[1], "last_insert_id") && IsSymbol(tokens[2], "(") && IsSymbol(tokens[3], ")") {
+		statement.SelectLastInsertID = true
+		return PrepareSuccess
+	}
+
+	// select [where predicate] [order by column [asc|desc]]
+	var rest []Token = tokens[1:]
+	if IsKeyword(rest[0], "where") {
+		expr, consumed, ok := ParseExpr(rest[1:])
+		if !ok {
+			return PrepareSyntaxError
+		}
+
+		statement.Where = expr
+		statement.WhereText = JoinTokens(rest[1 : 1+consumed])
+		rest = rest[1+consumed:]
+	}
+
+	if len(rest) == 0 {
+		return PrepareSuccess
+	}
+
+	if len(rest) < 3 || len(rest) > 4 || !IsKeyword(rest[0], "order") || !IsKeyword(rest[1], "by") || !isIdentifier(rest[2]) {
 		return PrepareSyntaxError
 	}
+	statement.OrderBy = rest[2].Text
 
-	if argsParsed != 3 {
+	if len(rest) == 4 {
+		if IsKeyword(rest[3], "desc") {
+			statement.Descending = true
+		} else if !IsKeyword(rest[3], "asc") {
+			return PrepareSyntaxError
+		}
+	}
+	return PrepareSuccess
+}
+
+// splitColumnDefinitions Split tokens by the commas which are not in parentheses
+func splitColumnDefinitions(tokens []Token) [][]Token {
+	var definitions [][]Token
+	var depth int = 0
+	var start int = 0
+	for i, token := range tokens {
+		if IsSymbol(token, "(") {
+			depth++
+		} else if IsSymbol(token, ")") {
+			depth--
+		} else if IsSymbol(token, ",") && depth == 0 {
+			definitions = append(definitions, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(definitions, tokens[start:])
+}
+
+func isIdentifier(token Token) bool {
+	if token.Kind != TokenWord || len(token.Text) == 0 || token.Text[0] >= '0' && token.Text[0] <= '9' {
+		return false
+	}
+	for _, ch := range token.Text {
+		if !(ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// prepareColumnDefinition Prepare column definition: name type [primary key [autoincrement]] [not null] [null] [unique] [default value] [check (predicate)]
+func prepareColumnDefinition(tokens []Token, columnNum int, column *backend.Column) PrepareStatementResult {
+	if len(tokens) < 2 || !isIdentifier(tokens[0]) {
 		return PrepareSyntaxError
 	}
+	column.Name = tokens[0].Text
+
+	// The layout of row is fixed, so the types of columns are fixed too
+	if IsKeyword(tokens[1], "integer") || IsKeyword(tokens[1], "int") {
+		column.Type = backend.ColumnInteger
+	} else if IsKeyword(tokens[1], "text") || IsKeyword(tokens[1], "varchar") {
+		column.Type = backend.ColumnText
+	} else {
+		return PrepareSyntaxError
+	}
+
+	if (columnNum == backend.ColumnPrimaryID) != (column.Type == backend.ColumnInteger) {
+		return PrepareTypeMismatch
+	}
+
+	for i := 2; i < len(tokens); i++ {
+		var token Token = tokens[i]
+		switch {
+		case IsKeyword(token, "primary") && i+1 < len(tokens) && IsKeyword(tokens[i+1], "key"):
+			if columnNum != backend.ColumnPrimaryID {
+				return PrepareSyntaxError
+			}
+			column.PrimaryKey = true
+			column.NotNull = true
+			i++
+		case IsKeyword(token, "autoincrement"):
+			if !column.PrimaryKey {
+				return PrepareSyntaxError
+			}
+			column.AutoIncrement = true
+		case IsKeyword(token, "not") && i+1 < len(tokens) && IsKeyword(tokens[i+1], "null"):
+			column.NotNull = true
+			i++
+		case IsKeyword(token, "null"):
+			// Nullable is the default
+		case IsKeyword(token, "unique"):
+			column.Unique = true
+		case IsKeyword(token, "default") && i+1 < len(tokens):
+			var value Value = tokenValue(tokens[i+1])
+			if columnNum == backend.ColumnPrimaryID || tokens[i+1].Kind == TokenSymbol || value.Type == ValueDefault {
+				return PrepareSyntaxError
+			}
+			if value.Type == ValueString {
+				if len(value.String) > columnStorageSize(columnNum) {
+					return PrepareStringTooLong
+				}
+				var defaultValue string = value.String
+				column.Default = &defaultValue
+			}
+			i++
+		case IsKeyword(token, "check") && i+1 < len(tokens) && IsSymbol(tokens[i+1], "("):
+			expr, consumed, ok := ParseExpr(tokens[i+2:])
+			var end int = i + 2 + consumed
+			if !ok || end >= len(tokens) || !IsSymbol(tokens[end], ")") || expr == nil || MaxParamIndex(expr) > 0 {
+				return PrepareSyntaxError
+			}
+			column.Check = JoinTokens(tokens[i+2 : end])
+			i = end
+		default:
+			return PrepareSyntaxError
+		}
+	}
+	return PrepareSuccess
+}
 
-	if len(UserName) > backend.UserNameSize || len(Email) > backend.EmailSize {
-		return PrepareStringTooLong
+func columnStorageSize(columnNum int) int {
+	if columnNum == backend.ColumnUserName {
+		return backend.UserNameSize
 	}
+	return backend.EmailSize
+}
 
-	copy(statement.RowToInsert.UserName[:], UserName)
-	copy(statement.RowToInsert.Email[:], Email)
+// prepareCreate Prepare create statement: create table name (id integer primary key, username text ..., email text ...)
+// [sequence n]. The table option sequence sets the largest id ever assigned to the AUTOINCREMENT primary key,
+// so a table made by the dump does not reuse the ids deleted before it.
+func prepareCreate(tokens []Token, statement *Statement) PrepareStatementResult {
+	statement.Type = CreateStatement
+	var end int = len(tokens) - 1
+	var sequence *Token
+	if len(tokens) > 2 && IsKeyword(tokens[len(tokens)-2], "sequence") {
+		end, sequence = len(tokens)-3, &tokens[len(tokens)-1]
+	}
+	if end < 4 || !IsKeyword(tokens[1], "table") || !isIdentifier(tokens[2]) ||
+		!IsSymbol(tokens[3], "(") || !IsSymbol(tokens[end], ")") {
+		return PrepareSyntaxError
+	}
 
+	var definitions [][]Token = splitColumnDefinitions(tokens[4:end])
+	if len(definitions) != backend.NumColumns {
+		return PrepareSyntaxError
+	}
+
+	var schema *backend.Schema = new(backend.Schema)
+	schema.TableName = tokens[2].Text
+	schema.Declared = true
+	for i, definition := range definitions {
+		if result := prepareColumnDefinition(definition, i, &schema.Columns[i]); result != PrepareSuccess {
+			return result
+		}
+
+		if backend.ColumnIndex(schema, schema.Columns[i].Name) != i {
+			return PrepareSyntaxError
+		}
+	}
+
+	if !schema.Columns[backend.ColumnPrimaryID].PrimaryKey {
+		return PrepareSyntaxError
+	}
+
+	if sequence != nil {
+		value, err := strconv.ParseUint(sequence.Text, 10, 32)
+		if sequence.Kind != TokenWord || err != nil || !schema.Columns[backend.ColumnPrimaryID].AutoIncrement {
+			return PrepareSyntaxError
+		}
+		schema.Sequence = uint32(value)
+	}
+
+	// CHECK constraints can reference any column of the table
+	for _, column := range schema.Columns {
+		if column.Check == "" {
+			continue
+		}
+		tokens, _ := Tokenize(column.Check)
+		expr, _, _ := ParseExpr(tokens)
+		if !ResolveExpr(expr, schema) {
+			return PrepareSyntaxError
+		}
+	}
+
+	statement.SchemaToCreate = schema
+	return PrepareSuccess
+}
+
+// prepareTransaction Prepare transaction control statement: begin|commit|rollback [transaction]
+func prepareTransaction(tokens []Token) PrepareStatementResult {
+	if len(tokens) > 2 || len(tokens) == 2 && !IsKeyword(tokens[1], "transaction") {
+		return PrepareSyntaxError
+	}
 	return PrepareSuccess
 }
 
 // PrepareStatement Prepare statement
 func PrepareStatement(inputBuffer *cli.InputBuffer, statement *Statement) PrepareStatementResult {
-	if strings.HasPrefix(inputBuffer.Buffer, "insert") {
-		return prepareInsert(inputBuffer, statement)
+	if result := prepareStatementText(inputBuffer.Buffer, statement); result != PrepareSuccess {
+		return result
 	}
 
-	if inputBuffer.Buffer == "select" {
-		statement.Type = SelectStatement
-		return PrepareSuccess
+	// Placeholders of where clause can only be bound to prepared statement
+	if MaxParamIndex(statement.Where) > 0 {
+		return PrepareUnboundParameter
 	}
+	return PrepareSuccess
+}
 
-	if inputBuffer.Buffer == "delete" {
-		statement.Type = DeleteStatement
-		return PrepareSuccess
+func prepareStatementText(text string, statement *Statement) PrepareStatementResult {
+	*statement = Statement{}
+	tokens, ok := Tokenize(text)
+	if !ok {
+		return PrepareSyntaxError
+	}
+
+	if len(tokens) > 0 && IsKeyword(tokens[0], "explain") {
+		statement.Explain = true
+		tokens = tokens[1:]
 	}
 
-	if inputBuffer.Buffer == "create" {
-		statement.Type = CreateStatement
+	if len(tokens) == 0 {
+		return PrepareUnrecognizedStatement
+	}
+
+	switch {
+	case IsKeyword(tokens[0], "insert"):
+		statement.Type = InsertStatement
+		return prepareRowValues(tokens[1:], statement)
+	case IsKeyword(tokens[0], "update"):
+		statement.Type = UpdateStatement
+		return prepareRowValues(tokens[1:], statement)
+	case IsKeyword(tokens[0], "select"):
+		return prepareSelect(tokens, statement)
+	case IsKeyword(tokens[0], "delete"):
+		statement.Type = DeleteStatement
+		if len(tokens) != 1 {
+			return PrepareSyntaxError
+		}
+		return PrepareSuccess
+	case IsKeyword(tokens[0], "create"):
+		return prepareCreate(tokens, statement)
+	case IsKeyword(tokens[0], "begin"):
+		statement.Type = BeginStatement
+		return prepareTransaction(tokens)
+	case IsKeyword(tokens[0], "commit"):
+		statement.Type = CommitStatement
+		return prepareTransaction(tokens)
+	case IsKeyword(tokens[0], "rollback"):
+		statement.Type = RollbackStatement
+		return prepareTransaction(tokens)
+	case IsKeyword(tokens[0], "vacuum"):
+		statement.Type = VacuumStatement
+		if len(tokens) != 1 {
+			return PrepareSyntaxError
+		}
 		return PrepareSuccess
 	}
 
 	return PrepareUnrecognizedStatement
 }
 
-// RunStatement Run statement
+// RunStatement Run statement, it is safe to run statements of a table concurrently.
+// After begin statement, the statements run on the private copy of the transaction until commit or rollback.
 func RunStatement(table *backend.Table, statement *Statement) ExecuteResult {
 	switch statement.Type {
-	case InsertStatement:
-		return RunInsert(table, statement)
-	case SelectStatement:
+	case BeginStatement, CommitStatement, RollbackStatement:
+		if !statement.Explain {
+			return runTransactionStatement(table, statement)
+		}
+	case VacuumStatement:
+		if !statement.Explain {
+			return RunVacuum(table)
+		}
+	}
+
+	table = SessionTable(table)
+	if statement.Explain {
+		return RunExplain(table, statement)
+	}
+
+	if statement.Type == SelectStatement {
+		// Readers scan the snapshot taken by SelectRows, they do not block writers
 		return RunSelect(table, statement)
+	}
+
+	// The other statements change the table, they run alone
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+
+	var changesTable bool = statement.Type == InsertStatement || statement.Type == UpdateStatement || statement.Type == CreateStatement
+	if table.ReadOnly && changesTable {
+		return ExecuteReadOnly
+	}
+	if changesTable {
+		// Snapshots taken before are out of date
+		defer func() { table.Version++ }()
+	}
+
+	var result ExecuteResult = ExecuteFail
+	switch statement.Type {
+	case InsertStatement:
+		result = RunInsert(table, statement)
+	case UpdateStatement:
+		result = RunUpdate(table, statement)
 	case DeleteStatement:
 		// TODO: Delete
 	case CreateStatement:
-		// TODO: Create
+		result = RunCreate(table, statement)
 	default:
 		fmt.Println("Unkown Statement.")
 	}
-	return ExecuteFail
+
+	// A statement out of transactions commits itself
+	if result == ExecuteSuccess {
+		if err := backend.FlushStatement(table); err != nil {
+			panic(&backend.Error{Err: err})
+		}
+	}
+	return result
+}
+
+// SessionTable Get the table the statements run on, it is the private copy of transaction after begin statement
+func SessionTable(table *backend.Table) *backend.Table {
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+	if table.Transaction != nil {
+		return table.Transaction.Table
+	}
+	return table
+}
+
+// runTransactionStatement Run begin, commit and rollback statement
+func runTransactionStatement(table *backend.Table, statement *Statement) ExecuteResult {
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+
+	if statement.Type == BeginStatement {
+		if table.Transaction != nil {
+			return ExecuteTransactionActive
+		}
+		table.Transaction = backend.BeginTransaction(table)
+		return ExecuteSuccess
+	}
+
+	if table.Transaction == nil {
+		return ExecuteNoTransaction
+	}
+
+	var transaction *backend.Transaction = table.Transaction
+	table.Transaction = nil
+	if statement.Type == CommitStatement && !backend.CommitTransaction(table, transaction) {
+		return ExecuteConflict
+	}
+	return ExecuteSuccess
+}
+
+// RunVacuum Run vacuum statement, it rebuilds the table into packed pages and can not run in a transaction
+func RunVacuum(table *backend.Table) ExecuteResult {
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+
+	// The private copy of a transaction has no DB file
+	if table.Transaction != nil || table.Pager.FilePtr == nil {
+		return ExecuteVacuumInTransaction
+	}
+	if table.ReadOnly {
+		return ExecuteReadOnly
+	}
+
+	defer func() { table.Version++ }()
+	err := backend.Vacuum(table, backend.VacuumFillFactor)
+	if err == backend.ErrBulkLoadFull {
+		return ExecuteTableFull
+	}
+	if err != nil {
+		panic(&backend.Error{Err: err})
+	}
+	return ExecuteSuccess
+}
+
+// setColumnText Set the text column of row to value
+func setColumnText(row *backend.Row, column uint32, text string) {
+	backend.SetNullColumn(row, column, false)
+	if column == backend.ColumnUserName {
+		row.UserName = [backend.UserNameSize]byte{}
+		copy(row.UserName[:], text)
+	} else {
+		row.Email = [backend.EmailSize]byte{}
+		copy(row.Email[:], text)
+	}
+}
+
+// applyDefaults Set the columns to their default value, or NULL if the column has no default value
+func applyDefaults(schema *backend.Schema, row *backend.Row, columns uint32) {
+	for i := uint32(backend.ColumnUserName); i < backend.NumColumns; i++ {
+		if columns&(1<<i) == 0 {
+			continue
+		}
+
+		if schema.Columns[i].Default == nil {
+			backend.SetNullColumn(row, i, true)
+		} else {
+			setColumnText(row, i, *schema.Columns[i].Default)
+		}
+	}
+}
+
+// checkColumnConstraints Check NOT NULL and CHECK constraints of the row to write, they need no other row
+func checkColumnConstraints(schema *backend.Schema, row *backend.Row) ExecuteResult {
+	for i, column := range schema.Columns {
+		if column.NotNull && backend.IsNullColumn(row.NullBitmap, uint32(i)) {
+			return ExecuteNotNullConstraint
+		}
+	}
+
+	for _, column := range schema.Columns {
+		if column.Check == "" {
+			continue
+		}
+
+		// CHECK constraint is violated only if the predicate is FALSE, UNKNOWN passes
+		tokens, _ := Tokenize(column.Check)
+		expr, _, ok := ParseExpr(tokens)
+		if ok && IsFalse(EvalExpr(expr, row, schema)) {
+			return ExecuteCheckConstraint
+		}
+	}
+	return ExecuteSuccess
+}
+
+// checkConstraints Check NOT NULL, CHECK and UNIQUE constraints of the row to write
+func checkConstraints(table *backend.Table, row *backend.Row) ExecuteResult {
+	var schema *backend.Schema = table.Schema
+	if result := checkColumnConstraints(schema, row); result != ExecuteSuccess {
+		return result
+	}
+
+	var uniqueColumns []int
+	for i, column := range schema.Columns {
+		if column.Unique && i != backend.ColumnPrimaryID && !backend.IsNullColumn(row.NullBitmap, uint32(i)) {
+			uniqueColumns = append(uniqueColumns, i)
+		}
+	}
+	if len(uniqueColumns) == 0 {
+		return ExecuteSuccess
+	}
+
+	// No secondary index, so UNIQUE is checked by scanning the table. NULLs are never equal.
+	var cursor *backend.Cursor = backend.CursorBegin(table)
+	for ; !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var other backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &other)
+		if other.PrimaryID == row.PrimaryID {
+			continue
+		}
+
+		for _, column := range uniqueColumns {
+			var otherValue Value = ColumnValue(&other, column)
+			if otherValue.Type != ValueNull && otherValue.String == ColumnValue(row, column).String {
+				return ExecuteUniqueConstraint
+			}
+		}
+	}
+	return ExecuteSuccess
+}
+
+// NextPrimaryID Get the id for the row inserted without id. It is the max id plus one,
+// and the largest id ever assigned plus one for AUTOINCREMENT primary key, so ids are never reused.
+func NextPrimaryID(table *backend.Table) (uint32, bool) {
+	maxKey, ok := backend.MaxKey(table)
+	if !ok {
+		maxKey = 0
+	}
+
+	if table.Schema.Columns[backend.ColumnPrimaryID].AutoIncrement && table.Schema.Sequence > maxKey {
+		maxKey = table.Schema.Sequence
+	}
+
+	if maxKey == math.MaxUint32 {
+		return 0, false
+	}
+	return maxKey + 1, true
 }
 
 // RunInsert run insert statment
 func RunInsert(table *backend.Table, statement *Statement) ExecuteResult {
 
+	if statement.AutoID {
+		id, ok := NextPrimaryID(table)
+		if !ok {
+			return ExecuteTableFull
+		}
+		statement.RowToInsert.PrimaryID = id
+	}
+
 	var key uint32 = statement.RowToInsert.PrimaryID
+	applyDefaults(table.Schema, &statement.RowToInsert, ^statement.AssignedColumns|statement.DefaultColumns)
+
 	var cursor *backend.Cursor = backend.Find(table, key)
 
 	var page *backend.Page = backend.GetPage(table.Pager, cursor.PageNum)
@@ -150,29 +675,92 @@ func RunInsert(table *backend.Table, statement *Statement) ExecuteResult {
 		}
 	}
 
+	if result := checkConstraints(table, &statement.RowToInsert); result != ExecuteSuccess {
+		return result
+	}
+
 	backend.InsertLeafNode(cursor, statement.RowToInsert.PrimaryID, &statement.RowToInsert)
 
+	if table.Schema.Columns[backend.ColumnPrimaryID].AutoIncrement && key > table.Schema.Sequence {
+		table.Schema.Sequence = key
+	}
+	table.LastInsertID = key
+
 	return ExecuteSuccess
 }
 
-// RunSelect run select statment
-func RunSelect(table *backend.Table, statement *Statement) ExecuteResult {
-	var cursor *backend.Cursor = backend.CursorBegin(table)
-	for !cursor.IsEndOfTable {
-		var row backend.Row
-		var readableRow backend.VisualRow
+// RunUpdate run update statement, the columns not given by statement keep their old value
+func RunUpdate(table *backend.Table, statement *Statement) ExecuteResult {
+	var key uint32 = statement.RowToUpdate.PrimaryID
+	var cursor *backend.Cursor = backend.Find(table, key)
+	var page *backend.Page = backend.GetPage(table.Pager, cursor.PageNum)
+	var numCells uint32 = *backend.LeafNodeNumCells(page.Mem[:])
+
+	if cursor.CellNum >= numCells || *backend.LeafNodeKey(page.Mem[:], cursor.CellNum) != key {
+		return ExecuteKeyNotFound
+	}
+
+	var row backend.Row
+	backend.DeserializeRow(backend.CursorValue(cursor), &row)
+	for i := uint32(backend.ColumnUserName); i < backend.NumColumns; i++ {
+		if statement.AssignedColumns&(1<<i) == 0 {
+			continue
+		}
 
-		rowSlotSlice := backend.CursorValue(cursor)
-		backend.DeserializeRow(rowSlotSlice, &row)
+		var value Value = ColumnValue(&statement.RowToUpdate, int(i))
+		if value.Type == ValueNull {
+			backend.SetNullColumn(&row, i, true)
+		} else {
+			setColumnText(&row, i, value.String)
+		}
+	}
+	applyDefaults(table.Schema, &row, statement.DefaultColumns)
 
-		readableRow.PrimaryID = row.PrimaryID
-		readableRow.UserName = util.ToString(row.UserName[:])
-		readableRow.Email = util.ToString(row.Email[:])
+	if result := checkConstraints(table, &row); result != ExecuteSuccess {
+		return result
+	}
 
-		backend.PrintRow(&readableRow)
+	backend.SerializeRow(&row, backend.CursorValueForWrite(cursor))
+	return ExecuteSuccess
+}
 
-		backend.CursorNext(cursor)
+// RunCreate run create statement, the table can be created only once and before any row is inserted
+func RunCreate(table *backend.Table, statement *Statement) ExecuteResult {
+	_, numCells := backend.CountLeafCells(table)
+	if table.Schema.Declared || numCells > 0 {
+		return ExecuteTableExists
 	}
 
+	table.Schema = statement.SchemaToCreate
+	backend.SaveSchema(table)
+	return ExecuteSuccess
+}
+
+// RunSelect run select statment, the rows are collected and printed in the output mode
+func RunSelect(table *backend.Table, statement *Statement) ExecuteResult {
+	if statement.SelectLastInsertID {
+		table.RWLock.RLock()
+		var rows [][]interface{} = [][]interface{}{{int64(table.LastInsertID)}}
+		table.RWLock.RUnlock()
+		FormatResult(Output, []string{"last_insert_id()"}, rows)
+		return ExecuteSuccess
+	}
+
+	var columns []string
+	table.RWLock.RLock()
+	for _, column := range table.Schema.Columns {
+		columns = append(columns, column.Name)
+	}
+	table.RWLock.RUnlock()
+
+	var rows [][]interface{}
+	var result ExecuteResult = SelectRows(table, statement, func(row *backend.Row) bool {
+		rows = append(rows, RowValues(row))
+		return true
+	})
+	if result != ExecuteSuccess {
+		return result
+	}
+	FormatResult(Output, columns, rows)
 	return ExecuteSuccess
 }
@@ -9,6 +9,21 @@ import (
 	"tiny-rdb/util"
 )
 
+func TestReleasedResultValues(t *testing.T) {
+	// The values released first never change, the values added later are appended after them
+	var values []int = []int{RawCommandSuccess, RawCommandUnrecognizedCMD, PrepareSuccess, PrepareStringTooLong,
+		PrepareSyntaxError, PrepareUnrecognizedStatement, InsertStatement, SelectStatement, DeleteStatement,
+		CreateStatement, ExecuteSuccess, ExecuteTableFull, ExecuteDuplicateKey, ExecuteFail}
+	for i, value := range values {
+		if value != i {
+			t.Errorf("the value %v must be %v", value, i)
+		}
+	}
+	if PrepareUnboundParameter != len(values) {
+		t.Errorf("the values added later must follow the released values: %v", PrepareUnboundParameter)
+	}
+}
+
 func TestRunRawCommand(t *testing.T) {
 	inputBuffer := cli.NewInputBuffer()
 	inputBuffer.Buffer = "testCmd"
@@ -172,9 +187,9 @@ func TestBunchOfInsert(t *testing.T) {
 		}
 	}
 
-	var endCursor *backend.Cursor = backend.CursorEnd(table)
-	if endCursor.PassedCells != InsertNum {
-		t.Errorf("Cell Num must be %v, but it is %v", InsertNum, endCursor.PassedCells)
+	_, numCells := backend.CountLeafCells(table)
+	if numCells != InsertNum || !backend.CursorEnd(table).IsEndOfTable {
+		t.Errorf("Cell Num must be %v, but it is %v", InsertNum, numCells)
 	}
 
 	inputBuffer.Buffer = "select"
@@ -195,9 +210,9 @@ func TestBunchOfInsert(t *testing.T) {
 
 	tableNew := backend.OpenDB(dbFile)
 
-	endCursor = backend.CursorEnd(tableNew)
-	if endCursor.PassedCells != InsertNum {
-		t.Errorf("Cell Num must be %v, but it is %v", InsertNum, endCursor.PassedCells)
+	_, numCells = backend.CountLeafCells(tableNew)
+	if numCells != InsertNum || !backend.CursorEnd(tableNew).IsEndOfTable {
+		t.Errorf("Cell Num must be %v, but it is %v", InsertNum, numCells)
 	}
 
 	backend.CloseDB(tableNew)
@@ -338,3 +353,266 @@ func TestFileLength(t *testing.T) {
 	backend.CloseDB(tableNew)
 	os.Remove(dbFile)
 }
+
+func runStatementText(t *testing.T, table *backend.Table, text string) ExecuteResult {
+	inputBuffer := cli.NewInputBuffer()
+	inputBuffer.Buffer = text
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+
+	var statement Statement
+	result := PrepareStatement(inputBuffer, &statement)
+	if result != PrepareSuccess {
+		t.Fatalf("prepare %v must be success: %v", text, result)
+	}
+	return RunStatement(table, &statement)
+}
+
+func TestConstraints(t *testing.T) {
+	dbFile := "./Constraints.db"
+	table := backend.OpenDB(dbFile)
+
+	result := runStatementText(t, table, "create table people (id integer primary key, username text not null default 'anonymous' unique, email text check (email like '%@%'))")
+	if result != ExecuteSuccess {
+		t.Errorf("result must be execute success: %v", result)
+	}
+
+	if runStatementText(t, table, "create table people (id integer primary key, username text, email text)") != ExecuteTableExists {
+		t.Errorf("table can not be created twice")
+	}
+
+	cases := []struct {
+		text   string
+		result ExecuteResult
+	}{
+		{"insert 1 chen we@qq.com", ExecuteSuccess},
+		{"insert 2 NULL we@qq.com", ExecuteNotNullConstraint},
+		{"insert 3 chen other@qq.com", ExecuteUniqueConstraint},
+		{"insert 4 wang not-an-email", ExecuteCheckConstraint},
+		{"insert 5 wang NULL", ExecuteSuccess}, // CHECK is UNKNOWN for NULL, so it passes
+		{"insert 6", ExecuteSuccess},           // username takes default value
+		{"insert 7", ExecuteUniqueConstraint},  // default value is not unique anymore
+		{"update 5 chen", ExecuteUniqueConstraint},
+		{"update 5 li not-an-email", ExecuteCheckConstraint},
+		{"update 5 li li@qq.com", ExecuteSuccess},
+		{"update 1 chen", ExecuteSuccess}, // row is not duplicate with itself
+		{"update 8 zhao", ExecuteKeyNotFound},
+		{"select where name = 'x'", ExecuteUnknownColumn},
+	}
+	for _, c := range cases {
+		if result := runStatementText(t, table, c.text); result != c.result {
+			t.Errorf("%v: result must be %v, but it is %v", c.text, c.result, result)
+		}
+	}
+
+	var rows []backend.Row
+	for cursor := backend.CursorBegin(table); !cursor.IsEndOfTable; backend.CursorNext(cursor) {
+		var row backend.Row
+		backend.DeserializeRow(backend.CursorValue(cursor), &row)
+		rows = append(rows, row)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("num of rows must be 3, but it is %v", len(rows))
+	}
+
+	if util.ToString(rows[1].UserName[:]) != "li" || util.ToString(rows[1].Email[:]) != "li@qq.com" {
+		t.Errorf("row 5 must be updated: %v", util.ToString(rows[1].UserName[:]))
+	}
+
+	if util.ToString(rows[2].UserName[:]) != "anonymous" || !backend.IsNullColumn(rows[2].NullBitmap, backend.ColumnEmail) {
+		t.Errorf("row 6 must be (anonymous, NULL)")
+	}
+
+	backend.CloseDB(table)
+
+	// Constraints are persisted with the schema
+	table = backend.OpenDB(dbFile)
+	if runStatementText(t, table, "insert 8 NULL x@qq.com") != ExecuteNotNullConstraint {
+		t.Errorf("NOT NULL constraint must be persisted")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+}
+
+func TestPrepareCreate(t *testing.T) {
+	inputBuffer := cli.NewInputBuffer()
+	cases := []struct {
+		text   string
+		result PrepareStatementResult
+	}{
+		{"create table t (id integer primary key, a text, b text)", PrepareSuccess},
+		{"create table t (id integer, a text, b text)", PrepareSyntaxError},
+		{"create table t (id integer primary key, a text)", PrepareSyntaxError},
+		{"create table t (id text primary key, a text, b text)", PrepareTypeMismatch},
+		{"create table t (id integer primary key, a text, a text)", PrepareSyntaxError},
+		{"create table t (id integer primary key, a text check (c = 1), b text)", PrepareSyntaxError},
+		{"create table t (id integer primary key, a text check (length(b) < 3), b text)", PrepareSuccess},
+		{"create table t (id integer primary key, a text default '" + util.RandString(backend.UserNameSize+1) + "', b text)", PrepareStringTooLong},
+		{"create", PrepareSyntaxError},
+	}
+	for _, c := range cases {
+		inputBuffer.Buffer = c.text
+		inputBuffer.BufLen = len(inputBuffer.Buffer)
+
+		var statement Statement
+		if result := PrepareStatement(inputBuffer, &statement); result != c.result {
+			t.Errorf("%v: result must be %v, but it is %v", c.text, c.result, result)
+		}
+	}
+}
+
+func TestAutoIncrement(t *testing.T) {
+	dbFile := "./AutoIncrement.db"
+	table := backend.OpenDB(dbFile)
+
+	// INTEGER PRIMARY KEY without AUTOINCREMENT takes max id plus one
+	for i := 0; i < 3; i++ {
+		if runStatementText(t, table, "insert null chen we@qq.com") != ExecuteSuccess {
+			t.Errorf("insert without id must be success")
+		}
+	}
+
+	if table.LastInsertID != 3 {
+		t.Errorf("last insert id must be 3, but it is %v", table.LastInsertID)
+	}
+
+	runStatementText(t, table, "insert 10 chen we@qq.com")
+	runStatementText(t, table, "insert default chen we@qq.com")
+	if table.LastInsertID != 11 {
+		t.Errorf("last insert id must be 11, but it is %v", table.LastInsertID)
+	}
+
+	if runStatementText(t, table, "select last_insert_id()") != ExecuteSuccess {
+		t.Errorf("select last_insert_id() must be success")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+
+	table = backend.OpenDB(dbFile)
+	runStatementText(t, table, "create table users (id integer primary key autoincrement, username text, email text)")
+	runStatementText(t, table, "insert 4294967290 chen we@qq.com")
+	backend.CloseDB(table)
+
+	// The sequence is persisted, so ids are never reused even if the max key is smaller
+	table = backend.OpenDB(dbFile)
+	if table.Schema.Sequence != 4294967290 {
+		t.Errorf("sequence must be persisted: %v", table.Schema.Sequence)
+	}
+
+	prepared, _ := CompileStatement("insert ? ? ?")
+	var statement Statement
+	for i := 0; i < 5; i++ {
+		BindNull(prepared, 1)
+		BindString(prepared, 2, "chen")
+		BindString(prepared, 3, "we@qq.com")
+		BindStatement(prepared, &statement)
+		if RunStatement(table, &statement) != ExecuteSuccess {
+			t.Errorf("insert with NULL id must be success")
+		}
+	}
+
+	if table.LastInsertID != 4294967295 {
+		t.Errorf("last insert id must be 4294967295, but it is %v", table.LastInsertID)
+	}
+
+	BindStatement(prepared, &statement)
+	if RunStatement(table, &statement) != ExecuteTableFull {
+		t.Errorf("ids are exhausted, result must be table full")
+	}
+
+	// Update must give the id of row
+	inputBuffer := cli.NewInputBuffer()
+	inputBuffer.Buffer = "update null chen"
+	inputBuffer.BufLen = len(inputBuffer.Buffer)
+	if PrepareStatement(inputBuffer, &statement) != PrepareTypeMismatch {
+		t.Errorf("update with NULL id must be type mismatch")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+}
+
+func TestTransactionStatements(t *testing.T) {
+	dbFile := "./TransactionStatements.db"
+	table := backend.OpenDB(dbFile)
+
+	if runStatementText(t, table, "commit") != ExecuteNoTransaction {
+		t.Errorf("commit without transaction must fail")
+	}
+	if runStatementText(t, table, "begin transaction") != ExecuteSuccess {
+		t.Errorf("begin must be success")
+	}
+	if runStatementText(t, table, "BEGIN") != ExecuteTransactionActive {
+		t.Errorf("nested begin must fail")
+	}
+	runStatementText(t, table, "create table person (id integer primary key autoincrement, name text, email text)")
+	runStatementText(t, table, "insert null chen we@qq.com")
+	if runStatementText(t, table, "rollback") != ExecuteSuccess {
+		t.Errorf("rollback must be success")
+	}
+
+	if table.Schema.Declared || table.Schema.Sequence != 0 || table.LastInsertID != 0 {
+		t.Errorf("rollback must restore the schema and last insert id")
+	}
+	if _, err := os.Stat(backend.SchemaFileName(dbFile)); !os.IsNotExist(err) {
+		t.Errorf("schema file of rolled back table must be removed")
+	}
+
+	runStatementText(t, table, "begin")
+	runStatementText(t, table, "insert 1 chen we@qq.com")
+	if runStatementText(t, table, "commit") != ExecuteSuccess {
+		t.Errorf("commit must be success")
+	}
+	_, numCells := backend.CountLeafCells(table)
+	if numCells != 1 {
+		t.Errorf("committed row must be kept")
+	}
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
+
+func TestRunVacuum(t *testing.T) {
+	dbFile := "./RunVacuum.db"
+	table := backend.OpenDB(dbFile)
+	for i := 40; i >= 1; i-- {
+		runStatementText(t, table, fmt.Sprintf("insert %v user%v u%v@qq.com", i, i, i))
+	}
+
+	runStatementText(t, table, "begin")
+	if runStatementText(t, table, "vacuum") != ExecuteVacuumInTransaction {
+		t.Errorf("vacuum in transaction must fail")
+	}
+	runStatementText(t, table, "rollback")
+
+	leafPages, _ := backend.CountLeafCells(table)
+	if runStatementText(t, table, "vacuum") != ExecuteSuccess {
+		t.Fatalf("vacuum must be success")
+	}
+	packedPages, numCells := backend.CountLeafCells(table)
+	if packedPages >= leafPages || numCells != 40 {
+		t.Errorf("vacuum must pack %v leaves of 40 rows: %v leaves of %v rows", leafPages, packedPages, numCells)
+	}
+	if runStatementText(t, table, "insert 41 user41 u41@qq.com") != ExecuteSuccess {
+		t.Errorf("insert after vacuum must be success")
+	}
+
+	// An I/O error is raised as backend.Error, the vacuum file can't be created over a directory
+	os.Mkdir(dbFile+backend.VacuumFileSuffix+".tmp", 0700)
+	func() {
+		defer func() {
+			if _, ok := recover().(*backend.Error); !ok {
+				t.Errorf("vacuum I/O error must raise backend.Error")
+			}
+		}()
+		runStatementText(t, table, "vacuum")
+	}()
+	os.Remove(dbFile + backend.VacuumFileSuffix + ".tmp")
+
+	backend.CloseDB(table)
+	os.Remove(dbFile)
+}
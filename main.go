@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 	"tiny-rdb/backend"
 	"tiny-rdb/frontend/cli"
 	"tiny-rdb/frontend/sql"
@@ -17,56 +19,111 @@ func initLog() {
 func main() {
 
 	if len(os.Args) < 2 {
-		fmt.Printf("tiny-rdb [db-file]\n")
+		printUsage()
 		os.Exit(util.ExitFailure)
 	}
 
 	initLog()
-	inputBuffer := cli.NewInputBuffer()
-	var table *backend.Table = backend.OpenDB(os.Args[1])
-	for {
-		cli.PrintPrompt()
-		cli.ReadInput(inputBuffer)
+	if os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if os.Args[1] == "http" {
+		runHTTP(os.Args[2:])
+		return
+	}
 
-		if inputBuffer.BufLen == 0 {
-			continue
-		}
+	dbFile, commands, bail, options, ok := parseArgs(os.Args[1:])
+	if !ok {
+		printUsage()
+		os.Exit(util.ExitFailure)
+	}
 
-		if cli.IsRawCommand(&(inputBuffer.Buffer)) {
-			switch sql.RunRawCommand(inputBuffer, table) {
-			case sql.RawCommandSuccess:
-				continue
-			case sql.RawCommandUnrecognizedCMD:
-				fmt.Printf("Unrecognized raw command: %v\n", inputBuffer.Buffer)
-				continue
+	table, err := backend.OpenWithOptions(dbFile, options)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+	defer exitOnBackendError()
+	var shell *sql.Shell = sql.NewShell(table)
+	shell.Bail = bail
+	if len(commands) > 0 {
+		shell.Interactive = false
+		shell.Errors = os.Stderr
+		for _, command := range commands {
+			if !shell.RunScript(command) {
+				break
 			}
 		}
-
-		var statement sql.Statement
-		switch sql.PrepareStatement(inputBuffer, &statement) {
-		case sql.PrepareSuccess:
-			break
-		case sql.PrepareStringTooLong:
-			fmt.Printf("String too long")
-			continue
-		case sql.PrepareSyntaxError:
-			fmt.Printf("Syntax Error: Cannot parse statement")
-			continue
-		case sql.PrepareUnrecognizedStatement:
-			fmt.Printf("Unrecognized statement: %v", inputBuffer.Buffer)
-			continue
+	} else {
+		var input *cli.InputBuffer = cli.NewInputBuffer()
+		if shell.Interactive {
+			input.Editor = cli.NewLineEditor(os.Stdin, os.Stdout, cli.HistoryFileName())
+			input.Editor.Complete = shell.Complete
 		}
+		shell.Run(input)
+	}
 
-		switch sql.RunStatement(table, &statement) {
-		case sql.ExecuteSuccess:
-			fmt.Println("Executed statement.")
-		case sql.ExecuteDuplicateKey:
-			fmt.Println("Error: Duplicate Key")
-		case sql.ExecuteTableFull:
-			fmt.Println("Error: Table Full")
-		case sql.ExecuteFail:
-			fmt.Println("Unknown Error: Failed to execute")
-		}
+	backend.CloseDB(table)
+	if shell.Failed {
+		os.Exit(util.ExitFailure)
+	}
+}
 
+// exitOnBackendError Print the I/O error or corrupt page met by the backend and exit, like the other fatal errors of REPL
+func exitOnBackendError() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if err, ok := recovered.(*backend.Error); ok {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+	panic(recovered)
+}
+
+func printUsage() {
+	fmt.Printf("tiny-rdb [-c sql]... [--bail] [--readonly] [--busy-timeout duration] [db-file]\n")
+	fmt.Printf("tiny-rdb serve [--protocol postgres|line] [--listen address] [--readonly] [--busy-timeout duration] [db-file]\n")
+	fmt.Printf("tiny-rdb http [--listen address] [--readonly] [--busy-timeout duration] [db-file]\n")
+}
+
+// parseArgs Parse db-file [-c sql]... [--bail] [--readonly] [--busy-timeout duration],
+// the options can be given before or after db-file
+func parseArgs(args []string) (string, []string, bool, *backend.OpenOptions, bool) {
+	var dbFile string
+	var commands []string
+	var bail bool
+	var options *backend.OpenOptions = &backend.OpenOptions{}
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-c", "--command":
+			if i+1 >= len(args) {
+				return "", nil, false, nil, false
+			}
+			i++
+			commands = append(commands, args[i])
+		case "--bail", "-bail":
+			bail = true
+		case "--readonly", "-readonly":
+			options.ReadOnly = true
+		case "--busy-timeout", "-busy-timeout":
+			if i+1 >= len(args) {
+				return "", nil, false, nil, false
+			}
+			i++
+			busyTimeout, err := time.ParseDuration(args[i])
+			if err != nil || busyTimeout < 0 {
+				return "", nil, false, nil, false
+			}
+			options.BusyTimeout = busyTimeout
+		default:
+			if dbFile != "" || strings.HasPrefix(args[i], "-") {
+				return "", nil, false, nil, false
+			}
+			dbFile = args[i]
+		}
 	}
+	return dbFile, commands, bail, options, dbFile != ""
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"tiny-rdb/server"
+	"tiny-rdb/tinyrdb"
+	"tiny-rdb/util"
+)
+
+// runServe tiny-rdb serve [--protocol postgres|line] [--listen address] [--readonly] [--busy-timeout duration] db-file
+func runServe(args []string) {
+	var flags *flag.FlagSet = flag.NewFlagSet("serve", flag.ExitOnError)
+	var protocol *string = flags.String("protocol", server.ProtocolPostgres, "protocol to speak, postgres or line")
+	var listen *string = flags.String("listen", "", "TCP address to listen on (default :5432 for postgres, :5433 for line)")
+	var options *tinyrdb.Options = openFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*protocol != server.ProtocolPostgres && *protocol != server.ProtocolLine) {
+		fmt.Printf("tiny-rdb serve [--protocol postgres|line] [--listen address] [--readonly] [--busy-timeout duration] [db-file]\n")
+		os.Exit(util.ExitFailure)
+	}
+	if *listen == "" {
+		*listen = ":5432"
+		if *protocol == server.ProtocolLine {
+			*listen = ":5433"
+		}
+	}
+
+	db, err := tinyrdb.Open(flags.Arg(0), options)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+
+	var tcpServer *server.Server = server.NewServer(db)
+	tcpServer.Protocol = *protocol
+	closeOnSignal(func() {
+		tcpServer.Close()
+	})
+
+	log.Printf("Serving %v on %v with %v protocol", flags.Arg(0), *listen, *protocol)
+	if err := tcpServer.ListenAndServe(*listen); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		db.Close()
+		os.Exit(util.ExitFailure)
+	}
+
+	// Pages are written to the DB file on close
+	tcpServer.Close()
+	closeDB(db)
+}
+
+// openFlags Define the flags of opening the DB file served, the options are set by parsing flags
+func openFlags(flags *flag.FlagSet) *tinyrdb.Options {
+	var options *tinyrdb.Options = &tinyrdb.Options{}
+	flags.BoolVar(&options.ReadOnly, "readonly", false, "open the DB file with SHARED lock and reject the statements changing it")
+	flags.DurationVar(&options.BusyTimeout, "busy-timeout", 0, "how long to wait for the lock of DB file held by another process")
+	return options
+}
+
+// runHTTP tiny-rdb http [--listen address] [--readonly] [--busy-timeout duration] db-file
+func runHTTP(args []string) {
+	var flags *flag.FlagSet = flag.NewFlagSet("http", flag.ExitOnError)
+	var listen *string = flags.String("listen", ":8080", "HTTP address to listen on")
+	var options *tinyrdb.Options = openFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Printf("tiny-rdb http [--listen address] [--readonly] [--busy-timeout duration] [db-file]\n")
+		os.Exit(util.ExitFailure)
+	}
+
+	db, err := tinyrdb.Open(flags.Arg(0), options)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+
+	var httpServer *http.Server = &http.Server{Addr: *listen, Handler: server.NewHTTPHandler(db)}
+	var shutdown chan struct{} = make(chan struct{})
+	closeOnSignal(func() {
+		// Shutdown returns after the requests in progress are answered
+		httpServer.Shutdown(context.Background())
+		close(shutdown)
+	})
+
+	log.Printf("Serving %v on http://%v", flags.Arg(0), *listen)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Printf("%s\n", err.Error())
+		db.Close()
+		os.Exit(util.ExitFailure)
+	}
+
+	// Pages are written to the DB file on close
+	<-shutdown
+	closeDB(db)
+}
+
+// closeDB Close the DB served, exit with failure if the pages can not be written
+func closeDB(db *tinyrdb.DB) {
+	if err := db.Close(); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(util.ExitFailure)
+	}
+}
+
+// closeOnSignal Call stop on SIGINT or SIGTERM, the server returns and the DB is closed
+func closeOnSignal(stop func()) {
+	var signals chan os.Signal = make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		stop()
+	}()
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"tiny-rdb/backend"
+	"tiny-rdb/tinyrdb"
+)
+
+// HTTP/JSON endpoints, each request runs in a session of its own, so a transaction can not span requests:
+//
+//	POST /query   {"sql": "select where id >= ?", "params": [1]}
+//	              => {"columns": ["id", "username", "email"], "rows": [{"id": 1, "username": "chen", "email": null}]}
+//	              => {"columns": null, "rows": null, "rows_affected": 1, "last_insert_id": 1} for the statements without result rows
+//	GET /health   {"status": "ok"}, it checks the DB file and reads the root page
+//	GET /tables   {"tables": [{"name": "users", "columns": [{"name": "id", "type": "INTEGER", "primary_key": true}]}]}
+//
+// Errors are answered with {"error": message} and the status of httpStatus: 4xx for the errors of request
+// and 5xx for the errors of the server, such as a locked or failed DB.
+
+// queryRequest body of POST /query
+type queryRequest struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+}
+
+// queryResponse answer of POST /query, columns and rows are null for the statements without result rows
+type queryResponse struct {
+	Columns      []string                 `json:"columns"`
+	Rows         []map[string]interface{} `json:"rows"`
+	RowsAffected int64                    `json:"rows_affected"`
+	LastInsertID int64                    `json:"last_insert_id"`
+}
+
+type columnResponse struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	PrimaryKey bool   `json:"primary_key,omitempty"`
+	NotNull    bool   `json:"not_null,omitempty"`
+	Unique     bool   `json:"unique,omitempty"`
+}
+
+type tableResponse struct {
+	Name    string           `json:"name"`
+	Columns []columnResponse `json:"columns"`
+}
+
+// NewHTTPHandler Make the handler of HTTP/JSON endpoints of the database
+func NewHTTPHandler(db *tinyrdb.DB) http.Handler {
+	var mux *http.ServeMux = http.NewServeMux()
+	mux.HandleFunc("/query", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writeHTTPError(writer, http.StatusMethodNotAllowed, fmt.Errorf("%v is not allowed, use POST", request.Method))
+			return
+		}
+		handleQuery(db, writer, request)
+	})
+	mux.HandleFunc("/health", func(writer http.ResponseWriter, request *http.Request) {
+		if err := db.Ping(); err != nil {
+			writeHTTPError(writer, http.StatusServiceUnavailable, err)
+			return
+		}
+		writeJSON(writer, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/tables", func(writer http.ResponseWriter, request *http.Request) {
+		tables, err := db.Tables()
+		if err != nil {
+			writeHTTPError(writer, httpStatus(err), err)
+			return
+		}
+
+		var response []tableResponse
+		for _, table := range tables {
+			var columns []columnResponse
+			for _, column := range table.Columns {
+				columns = append(columns, columnResponse(column))
+			}
+			response = append(response, tableResponse{Name: table.Name, Columns: columns})
+		}
+		writeJSON(writer, http.StatusOK, map[string]interface{}{"tables": response})
+	})
+	return mux
+}
+
+func handleQuery(db *tinyrdb.DB, writer http.ResponseWriter, request *http.Request) {
+	var decoder *json.Decoder = json.NewDecoder(http.MaxBytesReader(writer, request.Body, MaxLineSize))
+	decoder.UseNumber()
+	var query queryRequest
+	if err := decoder.Decode(&query); err != nil {
+		writeHTTPError(writer, http.StatusBadRequest, fmt.Errorf("body must be a JSON object of sql and params: %s", err.Error()))
+		return
+	}
+	args, err := convertParams(query.Params)
+	if err != nil {
+		writeHTTPError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	var conn *tinyrdb.Conn = db.Conn()
+	defer conn.Close()
+	rows, result, err := conn.Run(query.SQL, args...)
+	if err != nil {
+		writeHTTPError(writer, httpStatus(err), err)
+		return
+	}
+
+	var response queryResponse = queryResponse{RowsAffected: result.RowsAffected, LastInsertID: result.LastInsertID}
+	if rows != nil {
+		response.Columns = rows.Columns()
+		response.Rows = make([]map[string]interface{}, 0)
+		for _, values := range rows.Values() {
+			var row map[string]interface{} = make(map[string]interface{}, len(values))
+			for i, value := range values {
+				row[response.Columns[i]] = value
+			}
+			response.Rows = append(response.Rows, row)
+		}
+	}
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// httpStatus Get the HTTP status of the error of a statement, the errors not listed are errors of the request
+func httpStatus(err error) int {
+	var backendErr *backend.Error
+	if errors.As(err, &backendErr) {
+		return http.StatusInternalServerError
+	}
+
+	var statuses = []struct {
+		err    error
+		status int
+	}{
+		{tinyrdb.ErrKeyNotFound, http.StatusNotFound},
+		{tinyrdb.ErrConflict, http.StatusConflict},
+		{tinyrdb.ErrDuplicateKey, http.StatusConflict},
+		{tinyrdb.ErrUniqueConstraint, http.StatusConflict},
+		{tinyrdb.ErrTableExists, http.StatusConflict},
+		{tinyrdb.ErrReadOnly, http.StatusForbidden},
+		{tinyrdb.ErrTableFull, http.StatusInsufficientStorage},
+		{tinyrdb.ErrUnsupported, http.StatusNotImplemented},
+		{tinyrdb.ErrLocked, http.StatusServiceUnavailable},
+		{tinyrdb.ErrClosed, http.StatusServiceUnavailable},
+	}
+	for _, known := range statuses {
+		if errors.Is(err, known.err) {
+			return known.status
+		}
+	}
+	return http.StatusBadRequest
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(value)
+}
+
+func writeHTTPError(writer http.ResponseWriter, status int, err error) {
+	writeJSON(writer, status, map[string]string{"error": strings.TrimPrefix(err.Error(), "tinyrdb: ")})
+}
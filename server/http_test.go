@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"tiny-rdb/tinyrdb"
+)
+
+func postQuery(t *testing.T, handler http.Handler, body string) (int, map[string]interface{}) {
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body)))
+	var response map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response must be JSON: %v %q", err, recorder.Body.String())
+	}
+	return recorder.Code, response
+}
+
+func TestHTTP(t *testing.T) {
+	dbFile := "./HTTP.db"
+	db, err := tinyrdb.Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+	var handler http.Handler = NewHTTPHandler(db)
+
+	status, response := postQuery(t, handler, `{"sql": "insert ? ? ?", "params": [1, "chen", null]}`)
+	if status != http.StatusOK || response["rows_affected"] != float64(1) || response["last_insert_id"] != float64(1) || response["rows"] != nil {
+		t.Errorf("insert must be success: %v %v", status, response)
+	}
+	postQuery(t, handler, `{"sql": "insert 2 wang w@qq.com"}`)
+
+	status, response = postQuery(t, handler, `{"sql": "select where id >= $1", "params": [2]}`)
+	rows, _ := response["rows"].([]interface{})
+	if status != http.StatusOK || len(rows) != 1 {
+		t.Fatalf("select must return 1 row: %v %v", status, response)
+	}
+	var row map[string]interface{} = rows[0].(map[string]interface{})
+	if row["id"] != float64(2) || row["username"] != "wang" || row["email"] != "w@qq.com" {
+		t.Errorf("row must be keyed by columns with typed values: %v", row)
+	}
+	if columns := response["columns"].([]interface{}); len(columns) != 3 || columns[0] != "id" {
+		t.Errorf("columns must be the ones of schema: %v", columns)
+	}
+
+	status, response = postQuery(t, handler, `{"sql": "select where id > 5"}`)
+	if rows, ok := response["rows"].([]interface{}); status != http.StatusOK || !ok || len(rows) != 0 {
+		t.Errorf("select without rows must return an empty array: %v", response)
+	}
+
+	status, response = postQuery(t, handler, `{"sql": "insert 1 chen we@qq.com"}`)
+	if status != http.StatusConflict || response["error"] != "duplicate key" {
+		t.Errorf("error must be duplicate key: %v %v", status, response)
+	}
+	if status, _ = postQuery(t, handler, `{"sql": "update 9 chen"}`); status != http.StatusNotFound {
+		t.Errorf("update of missing key must be not found: %v", status)
+	}
+	if status, _ = postQuery(t, handler, `{"sql": "selec"}`); status != http.StatusBadRequest {
+		t.Errorf("syntax error must be a bad request: %v", status)
+	}
+	if status, _ = postQuery(t, handler, `{"sql": "select", "params": [{}]}`); status != http.StatusBadRequest {
+		t.Errorf("object parameter must be rejected: %v", status)
+	}
+
+	var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/query", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /query must not be allowed: %v", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"ok"`) {
+		t.Errorf("health must be ok: %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/tables", nil))
+	var tables struct {
+		Tables []tableResponse `json:"tables"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &tables)
+	if len(tables.Tables) != 1 || tables.Tables[0].Name != "users" || !tables.Tables[0].Columns[0].PrimaryKey ||
+		tables.Tables[0].Columns[1].Type != "TEXT" {
+		t.Errorf("tables must list the users table: %v", recorder.Body.String())
+	}
+
+	// A closed DB is unavailable
+	db.Close()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("health of closed DB must be unavailable: %v", recorder.Code)
+	}
+	if status, _ = postQuery(t, handler, `{"sql": "select"}`); status != http.StatusServiceUnavailable {
+		t.Errorf("query of closed DB must be unavailable: %v", status)
+	}
+	os.Remove(dbFile)
+}
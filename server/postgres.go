@@ -0,0 +1,761 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"tiny-rdb/tinyrdb"
+)
+
+// The subset of PostgreSQL v3 frontend/backend protocol:
+//
+//	Startup         SSLRequest and GSSENCRequest are refused with 'N', StartupMessage is accepted without
+//	                authentication, the server answers AuthenticationOk, ParameterStatus, BackendKeyData and ReadyForQuery
+//	Simple query    Query runs the statements separated by ';', each answers RowDescription and DataRow
+//	                if it returns rows, then CommandComplete, or ErrorResponse which skips the rest
+//	Extended query  Parse, Bind, Describe, Execute, Close, Flush and Sync. Placeholders are $1, $2...
+//	                Parameters and results are in text format, or binary format for integers and text
+//	Terminate       Close the connection, the active transaction is rolled back
+//
+// Values of INTEGER columns are int8 and values of TEXT columns are text. CancelRequest is not supported.
+
+// const var
+const (
+	MaxMessageSize = MaxLineSize
+
+	postgresProtocolVersion = 3 << 16
+	sslRequestCode          = 80877103
+	gssEncRequestCode       = 80877104
+	cancelRequestCode       = 80877102
+
+	formatText   = 0
+	formatBinary = 1
+
+	oidInt2    = 21
+	oidInt4    = 23
+	oidInt8    = 20
+	oidText    = 25
+	oidVarchar = 1043
+)
+
+var backendProcessID int32
+
+// postgresSession state of a connection speaking the PostgreSQL protocol
+type postgresSession struct {
+	conn       *tinyrdb.Conn
+	reader     *bufio.Reader
+	writer     *bufio.Writer
+	statements map[string]*postgresStatement
+	portals    map[string]*postgresPortal
+	failed     bool // an error occurred in extended query, the messages are discarded until Sync
+}
+
+// postgresStatement a statement created by Parse, stmt is nil for the empty query
+type postgresStatement struct {
+	stmt       *tinyrdb.Stmt
+	paramTypes []uint32
+}
+
+// postgresPortal a statement with parameters bound by Bind, it runs on the first Execute
+// and the rows are sent in batches of the max rows of Execute
+type postgresPortal struct {
+	statement     *postgresStatement
+	args          []interface{}
+	resultFormats []int16
+	executed      bool
+	values        [][]interface{}
+	sent          int
+	tag           string
+}
+
+// postgresError an error answered with ErrorResponse
+type postgresError struct {
+	code    string // SQLSTATE
+	message string
+}
+
+func (err *postgresError) Error() string {
+	return err.message
+}
+
+// message a backend message being built
+type message struct {
+	typ  byte
+	data bytes.Buffer
+}
+
+func newMessage(typ byte) *message {
+	return &message{typ: typ}
+}
+
+func (m *message) int16(value int16) *message {
+	binary.Write(&m.data, binary.BigEndian, value)
+	return m
+}
+
+func (m *message) int32(value int32) *message {
+	binary.Write(&m.data, binary.BigEndian, value)
+	return m
+}
+
+func (m *message) string(value string) *message {
+	m.data.WriteString(value)
+	m.data.WriteByte(0)
+	return m
+}
+
+func (m *message) bytes(value []byte) *message {
+	m.data.Write(value)
+	return m
+}
+
+// messageReader read the fields of a frontend message
+type messageReader struct {
+	data []byte
+	err  error
+}
+
+func (r *messageReader) next(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.data) {
+		r.err = &postgresError{code: "08P01", message: "invalid message format"}
+		return nil
+	}
+	var field []byte = r.data[:n]
+	r.data = r.data[n:]
+	return field
+}
+
+func (r *messageReader) byteField() byte {
+	var field []byte = r.next(1)
+	if field == nil {
+		return 0
+	}
+	return field[0]
+}
+
+func (r *messageReader) int16() int16 {
+	var field []byte = r.next(2)
+	if field == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(field))
+}
+
+func (r *messageReader) int32() int32 {
+	var field []byte = r.next(4)
+	if field == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(field))
+}
+
+// count Read the int16 count of the following fields, a negative count or one the rest of message can't hold
+// at size bytes per field is invalid, so it is rejected before a slice is made for it
+func (r *messageReader) count(size int) int {
+	var n int = int(r.int16())
+	if r.err == nil && (n < 0 || n*size > len(r.data)) {
+		r.err = &postgresError{code: "08P01", message: fmt.Sprintf("invalid field count %v", n)}
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+func (r *messageReader) string() string {
+	var index int = bytes.IndexByte(r.data, 0)
+	if index < 0 {
+		r.next(-1)
+		return ""
+	}
+	var field []byte = r.next(index + 1)
+	return string(field[:index])
+}
+
+func (server *Server) servePostgres(conn net.Conn) {
+	var s *postgresSession = &postgresSession{
+		conn:       server.DB.Conn(),
+		reader:     bufio.NewReader(conn),
+		writer:     bufio.NewWriter(conn),
+		statements: make(map[string]*postgresStatement),
+		portals:    make(map[string]*postgresPortal),
+	}
+	defer s.conn.Close()
+
+	if !s.startup() {
+		s.writer.Flush()
+		return
+	}
+
+	for {
+		// Answers are sent before waiting for the next message
+		if s.reader.Buffered() == 0 {
+			if err := s.writer.Flush(); err != nil {
+				return
+			}
+		}
+
+		typ, body, err := readMessage(s.reader, true)
+		if err != nil {
+			var protocolError *postgresError
+			if errors.As(err, &protocolError) {
+				s.writeError(err)
+				s.writer.Flush()
+			}
+			return
+		}
+		if typ == 'X' {
+			return
+		}
+		if s.failed && typ != 'S' {
+			continue
+		}
+
+		if err := s.handle(typ, &messageReader{data: body}); err != nil {
+			s.writeError(err)
+			if typ == 'Q' {
+				s.readyForQuery()
+			} else {
+				s.failed = true
+			}
+		}
+	}
+}
+
+// readMessage Read a message, the startup messages have no type byte
+func readMessage(reader *bufio.Reader, typed bool) (byte, []byte, error) {
+	var typ byte
+	if typed {
+		var err error
+		if typ, err = reader.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	var length int = int(int32(binary.BigEndian.Uint32(header[:])))
+	if length < 4 || length > MaxMessageSize {
+		return 0, nil, &postgresError{code: "08P01", message: fmt.Sprintf("invalid message length %v", length)}
+	}
+
+	var body []byte = make([]byte, length-4)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
+
+func (s *postgresSession) send(m *message) {
+	s.writer.WriteByte(m.typ)
+	binary.Write(s.writer, binary.BigEndian, int32(m.data.Len()+4))
+	s.writer.Write(m.data.Bytes())
+}
+
+// startup Run the startup phase, return false if the connection should be closed
+func (s *postgresSession) startup() bool {
+	var params map[string]string = make(map[string]string)
+	for {
+		_, body, err := readMessage(s.reader, false)
+		if err != nil {
+			return false
+		}
+		var r *messageReader = &messageReader{data: body}
+		var code int32 = r.int32()
+		switch code {
+		case sslRequestCode, gssEncRequestCode:
+			// Encryption is not supported, the client continues in plain text
+			s.writer.WriteByte('N')
+			if err := s.writer.Flush(); err != nil {
+				return false
+			}
+			continue
+		case cancelRequestCode:
+			return false
+		case postgresProtocolVersion:
+		default:
+			s.writeError(&postgresError{code: "0A000", message: fmt.Sprintf("unsupported frontend protocol %v.%v", code>>16, code&0xffff)})
+			return false
+		}
+
+		for {
+			var name string = r.string()
+			if name == "" || r.err != nil {
+				break
+			}
+			params[name] = r.string()
+		}
+		if r.err != nil {
+			s.writeError(r.err)
+			return false
+		}
+		break
+	}
+
+	s.send(newMessage('R').int32(0))
+	var status [][2]string = [][2]string{
+		{"server_version", "9.6.0"},
+		{"server_encoding", "UTF8"},
+		{"client_encoding", "UTF8"},
+		{"DateStyle", "ISO, MDY"},
+		{"integer_datetimes", "on"},
+		{"standard_conforming_strings", "on"},
+		{"application_name", params["application_name"]},
+	}
+	for _, parameter := range status {
+		s.send(newMessage('S').string(parameter[0]).string(parameter[1]))
+	}
+	s.send(newMessage('K').int32(atomic.AddInt32(&backendProcessID, 1)).int32(0))
+	s.readyForQuery()
+	return true
+}
+
+func (s *postgresSession) readyForQuery() {
+	var status byte = 'I'
+	if s.conn.InTransaction() {
+		status = 'T'
+	}
+	s.send(newMessage('Z').bytes([]byte{status}))
+}
+
+// handle Handle a message after startup
+func (s *postgresSession) handle(typ byte, r *messageReader) error {
+	switch typ {
+	case 'Q':
+		var query string = r.string()
+		if r.err != nil {
+			return r.err
+		}
+		s.simpleQuery(query)
+		return nil
+	case 'P':
+		return s.parse(r)
+	case 'B':
+		return s.bind(r)
+	case 'D':
+		return s.describe(r)
+	case 'E':
+		return s.execute(r)
+	case 'C':
+		return s.close(r)
+	case 'H':
+		return s.writer.Flush()
+	case 'S':
+		s.failed = false
+		s.readyForQuery()
+		return nil
+	}
+	return &postgresError{code: "08P01", message: fmt.Sprintf("unsupported message type %q", typ)}
+}
+
+// simpleQuery Run the statements of query one by one, an error skips the rest
+func (s *postgresSession) simpleQuery(query string) {
+	defer s.readyForQuery()
+
+	var statements []string = splitStatements(query)
+	if len(statements) == 0 {
+		s.send(newMessage('I'))
+		return
+	}
+
+	for _, statement := range statements {
+		rows, result, err := s.conn.Run(statement)
+		if err != nil {
+			s.writeError(err)
+			return
+		}
+
+		var values [][]interface{}
+		if rows != nil {
+			s.writeRowDescription(rows.Columns(), rows.ColumnTypes(), nil)
+			values = rows.Values()
+			for _, row := range values {
+				s.writeDataRow(row, nil)
+			}
+		}
+		s.send(newMessage('C').string(commandTag(statement, len(values), result)))
+	}
+}
+
+// splitStatements Split query by ';' outside the quoted strings, empty statements are dropped
+func splitStatements(query string) []string {
+	var statements []string
+	var start int
+	var quote rune
+	for i, char := range query {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		case char == ';':
+			statements = append(statements, query[start:i])
+			start = i + 1
+		}
+	}
+	statements = append(statements, query[start:])
+
+	var nonEmpty []string
+	for _, statement := range statements {
+		if strings.TrimSpace(statement) != "" {
+			nonEmpty = append(nonEmpty, strings.TrimSpace(statement))
+		}
+	}
+	return nonEmpty
+}
+
+// commandTag Make the tag of CommandComplete, it is named by the first word of statement
+func commandTag(statement string, numRows int, result tinyrdb.Result) string {
+	var fields []string = strings.Fields(statement)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch command := strings.ToUpper(fields[0]); command {
+	case "SELECT":
+		return fmt.Sprintf("SELECT %v", numRows)
+	case "INSERT":
+		return fmt.Sprintf("INSERT 0 %v", result.RowsAffected)
+	case "UPDATE":
+		return fmt.Sprintf("UPDATE %v", result.RowsAffected)
+	case "CREATE":
+		return "CREATE TABLE"
+	default:
+		return command
+	}
+}
+
+func (s *postgresSession) parse(r *messageReader) error {
+	var name string = r.string()
+	var query string = r.string()
+	var numTypes int = r.count(4)
+	var paramTypes []uint32
+	for i := 0; i < numTypes; i++ {
+		paramTypes = append(paramTypes, uint32(r.int32()))
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	var statement *postgresStatement = &postgresStatement{}
+	var statements []string = splitStatements(query)
+	if len(statements) > 1 {
+		return &postgresError{code: "42601", message: "cannot insert multiple commands into a prepared statement"}
+	}
+	if len(statements) == 1 {
+		stmt, err := s.conn.Prepare(statements[0])
+		if err != nil {
+			return err
+		}
+		statement.stmt = stmt
+		for len(paramTypes) < stmt.NumParams() {
+			paramTypes = append(paramTypes, 0)
+		}
+	}
+	statement.paramTypes = paramTypes
+
+	s.statements[name] = statement
+	s.send(newMessage('1'))
+	return nil
+}
+
+// formatOf Get the format of i-th value, formats has no code (all text), one code (for all) or a code for each
+func formatOf(formats []int16, i int) int16 {
+	switch {
+	case len(formats) == 0:
+		return formatText
+	case len(formats) == 1:
+		return formats[0]
+	case i < len(formats):
+		return formats[i]
+	}
+	return formatText
+}
+
+func (s *postgresSession) bind(r *messageReader) error {
+	var portalName string = r.string()
+	var statementName string = r.string()
+	var formats []int16 = make([]int16, r.count(2))
+	for i := range formats {
+		formats[i] = r.int16()
+	}
+	var params [][]byte = make([][]byte, r.count(4))
+	for i := range params {
+		var length int32 = r.int32()
+		if length >= 0 {
+			params[i] = r.next(int(length))
+		} else if length != -1 {
+			r.next(-1)
+		}
+	}
+	var resultFormats []int16 = make([]int16, r.count(2))
+	for i := range resultFormats {
+		resultFormats[i] = r.int16()
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	statement, ok := s.statements[statementName]
+	if !ok {
+		return &postgresError{code: "26000", message: fmt.Sprintf("prepared statement %q does not exist", statementName)}
+	}
+	if len(params) != len(statement.paramTypes) {
+		return &postgresError{code: "08P01", message: fmt.Sprintf("bind message supplies %v parameters, but prepared statement %q requires %v",
+			len(params), statementName, len(statement.paramTypes))}
+	}
+	for _, format := range append(formats, resultFormats...) {
+		if format != formatText && format != formatBinary {
+			return &postgresError{code: "08P01", message: fmt.Sprintf("unsupported format code %v", format)}
+		}
+	}
+
+	var portal *postgresPortal = &postgresPortal{statement: statement, resultFormats: resultFormats}
+	for i, param := range params {
+		arg, err := decodeParam(param, formatOf(formats, i), statement.paramTypes[i])
+		if err != nil {
+			return err
+		}
+		portal.args = append(portal.args, arg)
+	}
+
+	s.portals[portalName] = portal
+	s.send(newMessage('2'))
+	return nil
+}
+
+// decodeParam Decode the value of parameter, NULL is nil. Text values are passed as strings,
+// they are converted to integers by the columns they are compared with or assigned to.
+func decodeParam(param []byte, format int16, oid uint32) (interface{}, error) {
+	if param == nil {
+		return nil, nil
+	}
+	if format == formatText {
+		return string(param), nil
+	}
+
+	switch {
+	case oid == oidInt2 && len(param) == 2:
+		return int64(int16(binary.BigEndian.Uint16(param))), nil
+	case oid == oidInt4 && len(param) == 4:
+		return int64(int32(binary.BigEndian.Uint32(param))), nil
+	case oid == oidInt8 && len(param) == 8:
+		return int64(binary.BigEndian.Uint64(param)), nil
+	case oid == oidText || oid == oidVarchar:
+		return string(param), nil
+	}
+	return nil, &postgresError{code: "0A000", message: fmt.Sprintf("unsupported binary parameter of type %v", oid)}
+}
+
+func (s *postgresSession) describe(r *messageReader) error {
+	var kind byte = r.byteField()
+	var name string = r.string()
+	if r.err != nil {
+		return r.err
+	}
+
+	var statement *postgresStatement
+	var resultFormats []int16
+	switch kind {
+	case 'S':
+		var ok bool
+		if statement, ok = s.statements[name]; !ok {
+			return &postgresError{code: "26000", message: fmt.Sprintf("prepared statement %q does not exist", name)}
+		}
+		var description *message = newMessage('t').int16(int16(len(statement.paramTypes)))
+		for _, oid := range statement.paramTypes {
+			if oid == 0 {
+				// The types of parameters are not inferred, clients send them as text
+				oid = oidText
+			}
+			description.int32(int32(oid))
+		}
+		s.send(description)
+	case 'P':
+		portal, ok := s.portals[name]
+		if !ok {
+			return &postgresError{code: "34000", message: fmt.Sprintf("portal %q does not exist", name)}
+		}
+		statement = portal.statement
+		resultFormats = portal.resultFormats
+	default:
+		return &postgresError{code: "08P01", message: fmt.Sprintf("invalid describe kind %q", kind)}
+	}
+
+	if statement.stmt == nil {
+		s.send(newMessage('n'))
+		return nil
+	}
+	columns, types, err := statement.stmt.Describe()
+	if err != nil {
+		return err
+	}
+	if columns == nil {
+		s.send(newMessage('n'))
+		return nil
+	}
+	s.writeRowDescription(columns, types, resultFormats)
+	return nil
+}
+
+func (s *postgresSession) execute(r *messageReader) error {
+	var name string = r.string()
+	var maxRows int = int(r.int32())
+	if r.err != nil {
+		return r.err
+	}
+
+	portal, ok := s.portals[name]
+	if !ok {
+		return &postgresError{code: "34000", message: fmt.Sprintf("portal %q does not exist", name)}
+	}
+	if portal.statement.stmt == nil {
+		s.send(newMessage('I'))
+		return nil
+	}
+
+	if !portal.executed {
+		rows, result, err := portal.statement.stmt.Run(portal.args...)
+		if err != nil {
+			return err
+		}
+		portal.executed = true
+		if rows != nil {
+			portal.values = rows.Values()
+		}
+		portal.tag = commandTag(portal.statement.stmt.Query(), len(portal.values), result)
+	}
+
+	var end int = len(portal.values)
+	if maxRows > 0 && portal.sent+maxRows < end {
+		end = portal.sent + maxRows
+	}
+	for ; portal.sent < end; portal.sent++ {
+		s.writeDataRow(portal.values[portal.sent], portal.resultFormats)
+	}
+	if portal.sent < len(portal.values) {
+		s.send(newMessage('s'))
+		return nil
+	}
+	s.send(newMessage('C').string(portal.tag))
+	return nil
+}
+
+func (s *postgresSession) close(r *messageReader) error {
+	var kind byte = r.byteField()
+	var name string = r.string()
+	if r.err != nil {
+		return r.err
+	}
+
+	switch kind {
+	case 'S':
+		delete(s.statements, name)
+	case 'P':
+		delete(s.portals, name)
+	default:
+		return &postgresError{code: "08P01", message: fmt.Sprintf("invalid close kind %q", kind)}
+	}
+	s.send(newMessage('3'))
+	return nil
+}
+
+func (s *postgresSession) writeRowDescription(columns []string, types []string, formats []int16) {
+	var description *message = newMessage('T').int16(int16(len(columns)))
+	for i, column := range columns {
+		var oid int32 = oidText
+		var size int16 = -1
+		if i < len(types) && types[i] == "INTEGER" {
+			oid = oidInt8
+			size = 8
+		}
+		description.string(column).int32(0).int16(0).int32(oid).int16(size).int32(-1).int16(formatOf(formats, i))
+	}
+	s.send(description)
+}
+
+func (s *postgresSession) writeDataRow(row []interface{}, formats []int16) {
+	var data *message = newMessage('D').int16(int16(len(row)))
+	for i, value := range row {
+		if value == nil {
+			data.int32(-1)
+			continue
+		}
+
+		var encoded []byte
+		switch value := value.(type) {
+		case int64:
+			if formatOf(formats, i) == formatBinary {
+				encoded = make([]byte, 8)
+				binary.BigEndian.PutUint64(encoded, uint64(value))
+			} else {
+				encoded = []byte(strconv.FormatInt(value, 10))
+			}
+		default:
+			encoded = []byte(fmt.Sprint(value))
+		}
+		data.int32(int32(len(encoded))).bytes(encoded)
+	}
+	s.send(data)
+}
+
+func (s *postgresSession) writeError(err error) {
+	var code string = sqlState(err)
+	var message string = strings.TrimPrefix(err.Error(), "tinyrdb: ")
+	s.send(newMessage('E').
+		bytes([]byte{'S'}).string("ERROR").
+		bytes([]byte{'V'}).string("ERROR").
+		bytes([]byte{'C'}).string(code).
+		bytes([]byte{'M'}).string(message).
+		bytes([]byte{0}))
+}
+
+// sqlState Get the SQLSTATE code of error
+func sqlState(err error) string {
+	var protocolError *postgresError
+	if errors.As(err, &protocolError) {
+		return protocolError.code
+	}
+
+	var codes = []struct {
+		err  error
+		code string
+	}{
+		{tinyrdb.ErrSyntax, "42601"},
+		{tinyrdb.ErrUnrecognizedStatement, "42601"},
+		{tinyrdb.ErrUnboundParameter, "42P02"},
+		{tinyrdb.ErrStringTooLong, "22001"},
+		{tinyrdb.ErrTypeMismatch, "42804"},
+		{tinyrdb.ErrTableFull, "53100"},
+		{tinyrdb.ErrDuplicateKey, "23505"},
+		{tinyrdb.ErrUniqueConstraint, "23505"},
+		{tinyrdb.ErrNotNullConstraint, "23502"},
+		{tinyrdb.ErrCheckConstraint, "23514"},
+		{tinyrdb.ErrKeyNotFound, "P0002"},
+		{tinyrdb.ErrNoSuchColumn, "42703"},
+		{tinyrdb.ErrTableExists, "42P07"},
+		{tinyrdb.ErrTransactionActive, "25001"},
+		{tinyrdb.ErrVacuumInTransaction, "25001"},
+		{tinyrdb.ErrNoTransaction, "25P01"},
+		{tinyrdb.ErrConflict, "40001"},
+		{tinyrdb.ErrReadOnly, "25006"},
+		{tinyrdb.ErrLocked, "55P03"},
+		{tinyrdb.ErrUnsupported, "0A000"},
+	}
+	for _, known := range codes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+	return "XX000"
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+)
+
+// pgClient a minimal frontend of PostgreSQL protocol, so the test runs without Postgres client libraries
+type pgClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *pgClient) send(m *message) {
+	var data []byte = m.data.Bytes()
+	var frame []byte
+	if m.typ != 0 {
+		frame = append(frame, m.typ)
+	}
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)+4))
+	frame = append(append(frame, length[:]...), data...)
+	c.conn.Write(frame)
+}
+
+// expect Read messages of the types in order, return their bodies
+func (c *pgClient) expect(types ...byte) [][]byte {
+	var bodies [][]byte
+	for _, typ := range types {
+		got, body, err := readMessage(c.reader, true)
+		if err != nil {
+			c.t.Fatalf("read message must be success: %v", err)
+		}
+		if got != typ {
+			c.t.Fatalf("message must be %q, but it is %q: %q", typ, got, body)
+		}
+		bodies = append(bodies, body)
+	}
+	return bodies
+}
+
+func dialPostgres(t *testing.T, address string) *pgClient {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("dial must be success: %v", err)
+	}
+	var c *pgClient = &pgClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+
+	c.send(newMessage(0).int32(sslRequestCode))
+	if answer, _ := c.reader.ReadByte(); answer != 'N' {
+		t.Fatalf("SSL must be refused with 'N', but it is %q", answer)
+	}
+
+	c.send(newMessage(0).int32(postgresProtocolVersion).string("user").string("test").string("database").string("test").bytes([]byte{0}))
+	var bodies [][]byte = c.expect('R')
+	if binary.BigEndian.Uint32(bodies[0]) != 0 {
+		t.Fatalf("authentication must be ok: %v", bodies[0])
+	}
+	for {
+		typ, body, _ := readMessage(c.reader, true)
+		if typ == 'Z' {
+			if body[0] != 'I' {
+				t.Fatalf("session must be idle: %q", body)
+			}
+			return c
+		}
+		if typ != 'S' && typ != 'K' {
+			t.Fatalf("unexpected startup message %q", typ)
+		}
+	}
+}
+
+func commandTagOf(body []byte) string {
+	return string(body[:len(body)-1])
+}
+
+func TestPostgres(t *testing.T) {
+	dbFile := "./Postgres.db"
+	server, address := startServer(t, dbFile, ProtocolPostgres)
+	var c *pgClient = dialPostgres(t, address)
+
+	c.send(newMessage('Q').string("insert 1 chen 'we@qq.com'; insert 2 'wang;' w@qq.com;"))
+	var bodies [][]byte = c.expect('C', 'C', 'Z')
+	if commandTagOf(bodies[0]) != "INSERT 0 1" || commandTagOf(bodies[1]) != "INSERT 0 1" {
+		t.Errorf("tags must be INSERT 0 1: %q %q", bodies[0], bodies[1])
+	}
+
+	c.send(newMessage('Q').string("select"))
+	bodies = c.expect('T', 'D', 'D', 'C', 'Z')
+	var reader *messageReader = &messageReader{data: bodies[0]}
+	if numFields := reader.int16(); numFields != 3 {
+		t.Errorf("row description must have 3 fields: %v", numFields)
+	}
+	if name, _, _, oid := reader.string(), reader.int32(), reader.int16(), reader.int32(); name != "id" || oid != oidInt8 {
+		t.Errorf("id must be int8: %v %v", name, oid)
+	}
+	reader = &messageReader{data: bodies[2]}
+	reader.int16()
+	if id, username := string(reader.next(int(reader.int32()))), string(reader.next(int(reader.int32()))); id != "2" || username != "wang;" {
+		t.Errorf("second row must be 2 wang;: %v %v", id, username)
+	}
+	if commandTagOf(bodies[3]) != "SELECT 2" {
+		t.Errorf("tag must be SELECT 2: %q", bodies[3])
+	}
+
+	c.send(newMessage('Q').string("begin"))
+	if bodies = c.expect('C', 'Z'); bodies[1][0] != 'T' {
+		t.Errorf("status must be in transaction: %q", bodies[1])
+	}
+	c.send(newMessage('Q').string("insert 1 chen we@qq.com; select"))
+	bodies = c.expect('E', 'Z')
+	reader = &messageReader{data: bodies[0]}
+	var fields map[byte]string = make(map[byte]string)
+	for code := reader.byteField(); code != 0; code = reader.byteField() {
+		fields[code] = reader.string()
+	}
+	if fields['C'] != "23505" || fields['M'] != "duplicate key" {
+		t.Errorf("error must be duplicate key: %v", fields)
+	}
+	c.send(newMessage('Q').string("rollback"))
+	if bodies = c.expect('C', 'Z'); commandTagOf(bodies[0]) != "ROLLBACK" || bodies[1][0] != 'I' {
+		t.Errorf("status must be idle after rollback: %q %q", bodies[0], bodies[1])
+	}
+
+	// Extended query with a binary result
+	c.send(newMessage('P').string("byid").string("select where id = $1").int16(0))
+	c.send(newMessage('D').bytes([]byte{'S'}).string("byid"))
+	c.send(newMessage('B').string("").string("byid").int16(0).int16(1).int32(1).bytes([]byte("2")).int16(1).int16(formatBinary))
+	c.send(newMessage('E').string("").int32(0))
+	c.send(newMessage('S'))
+	bodies = c.expect('1', 't', 'T', '2', 'D', 'C', 'Z')
+	reader = &messageReader{data: bodies[4]}
+	reader.int16()
+	if id := reader.next(int(reader.int32())); len(id) != 8 || binary.BigEndian.Uint64(id) != 2 {
+		t.Errorf("id must be binary int8 2: %v", id)
+	}
+	if commandTagOf(bodies[5]) != "SELECT 1" {
+		t.Errorf("tag must be SELECT 1: %q", bodies[5])
+	}
+
+	// Rows are sent in batches of max rows
+	c.send(newMessage('B').string("all").string("").int16(0).int16(0).int16(0))
+	c.send(newMessage('S'))
+	c.expect('E', 'Z')
+	c.send(newMessage('P').string("").string("select").int16(0))
+	c.send(newMessage('B').string("all").string("").int16(0).int16(0).int16(0))
+	c.send(newMessage('E').string("all").int32(1))
+	c.send(newMessage('E').string("all").int32(1))
+	c.send(newMessage('S'))
+	bodies = c.expect('1', '2', 'D', 's', 'D', 'C', 'Z')
+	if commandTagOf(bodies[5]) != "SELECT 2" {
+		t.Errorf("tag must be SELECT 2: %q", bodies[5])
+	}
+
+	// Messages after an error are discarded until Sync
+	c.send(newMessage('P').string("").string("selec where").int16(0))
+	c.send(newMessage('B').string("").string("").int16(0).int16(0).int16(0))
+	c.send(newMessage('E').string("").int32(0))
+	c.send(newMessage('S'))
+	c.expect('E', 'Z')
+
+	// Malformed counts are rejected without ending the session
+	c.send(newMessage('B').string("").string("byid").int16(-1))
+	c.send(newMessage('S'))
+	c.expect('E', 'Z')
+	c.send(newMessage('B').string("").string("byid").int16(0).int16(1000).int32(1).bytes([]byte("2")))
+	c.send(newMessage('S'))
+	c.expect('E', 'Z')
+	c.send(newMessage('B').string("").string("byid").int16(0).int16(1).int32(-2).int16(0))
+	c.send(newMessage('S'))
+	c.expect('E', 'Z')
+
+	// The parameter count is checked for an empty statement too
+	c.send(newMessage('P').string("empty").string("").int16(0))
+	c.send(newMessage('B').string("").string("empty").int16(0).int16(1).int32(1).bytes([]byte("2")).int16(0))
+	c.send(newMessage('S'))
+	c.expect('1', 'E', 'Z')
+
+	c.send(newMessage('Q').string(" ; "))
+	c.expect('I', 'Z')
+
+	c.send(newMessage('X'))
+	c.conn.Close()
+	server.Close()
+	server.DB.Close()
+	os.Remove(dbFile)
+}
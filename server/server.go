@@ -0,0 +1,324 @@
+// Package server serves a tiny-rdb database to TCP clients with the line protocol below,
+// or with a subset of the PostgreSQL v3 protocol (see postgres.go) so psql and Postgres client libraries can connect.
+//
+// Each connection is a session with its own transaction and prepared statements. Requests and responses
+// are lines of UTF-8 text terminated by '\n', values are JSON so they never contain a line break.
+//
+// The server greets the client once connected:
+//
+//	TINYRDB 1
+//
+// Requests:
+//
+//	QUERY <sql>                       Run a statement, begin/commit/rollback control the transaction of session
+//	PREPARE <name> <sql>              Prepare a statement with placeholders in the session
+//	EXECUTE <name> [<json array>]     Run a prepared statement with the parameters, e.g. EXECUTE add [1,"chen",null]
+//	DEALLOCATE <name>                 Drop a prepared statement
+//	QUIT                              Close the connection, the active transaction is rolled back
+//
+// Responses:
+//
+//	OK <rows affected> <last insert id>   Statement without result rows succeeded
+//	PREPARED <num of params>              Statement is prepared
+//	COLUMNS <json array of names>         Result rows follow,
+//	ROW <json array of values>            one line per row, NULL is null,
+//	END <num of rows>                     and the end of result rows
+//	ERROR <message>                       Request failed, the session is still usable
+//	BYE                                   Answer of QUIT
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"tiny-rdb/tinyrdb"
+)
+
+// const var
+const (
+	ProtocolVersion = 1
+	MaxLineSize     = 1024 * 1024
+)
+
+// Protocols spoken by server
+const (
+	ProtocolLine     = "line"
+	ProtocolPostgres = "postgres"
+)
+
+// Server serves a database to TCP clients
+type Server struct {
+	DB       *tinyrdb.DB
+	Protocol string // ProtocolLine or ProtocolPostgres
+
+	mutex     sync.Mutex // Guards the fields below, a connection is registered to wait under it so Close never misses it
+	closed    bool
+	listeners []net.Listener
+	conns     map[net.Conn]bool
+	wait      sync.WaitGroup
+}
+
+// session state of a connection
+type session struct {
+	conn     *tinyrdb.Conn
+	prepared map[string]*tinyrdb.Stmt
+	writer   *bufio.Writer
+}
+
+// NewServer Make a server of the database
+func NewServer(db *tinyrdb.DB) *Server {
+	return &Server{DB: db, Protocol: ProtocolLine, conns: make(map[net.Conn]bool)}
+}
+
+// ListenAndServe Listen on the TCP address and serve the clients until Close
+func (server *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve Serve the clients accepted by the listener until Close, each client runs in its own goroutine
+func (server *Server) Serve(listener net.Listener) error {
+	server.mutex.Lock()
+	if server.closed {
+		server.mutex.Unlock()
+		listener.Close()
+		return nil
+	}
+	server.listeners = append(server.listeners, listener)
+	server.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if server.isClosed(listener) {
+				return nil
+			}
+			return err
+		}
+
+		// The connection is registered under the lock Close takes, so either Close closes it and waits for it,
+		// or it is closed here
+		server.mutex.Lock()
+		if server.isClosedLocked(listener) {
+			server.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		server.conns[conn] = true
+		server.wait.Add(1)
+		server.mutex.Unlock()
+
+		go server.serveConn(conn)
+	}
+}
+
+func (server *Server) isClosed(listener net.Listener) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.isClosedLocked(listener)
+}
+
+// isClosedLocked Check if the server is closed or the listener is removed, the caller holds the mutex
+func (server *Server) isClosedLocked(listener net.Listener) bool {
+	if server.closed {
+		return true
+	}
+	for _, open := range server.listeners {
+		if open == listener {
+			return false
+		}
+	}
+	return true
+}
+
+// Close Stop accepting clients, close the connections and wait for the sessions to end
+func (server *Server) Close() error {
+	server.mutex.Lock()
+	server.closed = true
+	for _, listener := range server.listeners {
+		listener.Close()
+	}
+	server.listeners = nil
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.mutex.Unlock()
+
+	server.wait.Wait()
+	return nil
+}
+
+func (server *Server) serveConn(conn net.Conn) {
+	defer server.wait.Done()
+	defer func() {
+		server.mutex.Lock()
+		delete(server.conns, conn)
+		server.mutex.Unlock()
+		conn.Close()
+	}()
+	// A panic in a session ends only its connection, the other clients keep being served
+	defer func() {
+		recover()
+	}()
+
+	if server.Protocol == ProtocolPostgres {
+		server.servePostgres(conn)
+		return
+	}
+	server.serveLine(conn)
+}
+
+func (server *Server) serveLine(conn net.Conn) {
+	var s *session = &session{
+		conn:     server.DB.Conn(),
+		prepared: make(map[string]*tinyrdb.Stmt),
+		writer:   bufio.NewWriter(conn),
+	}
+	defer s.conn.Close()
+
+	fmt.Fprintf(s.writer, "TINYRDB %v\n", ProtocolVersion)
+	s.writer.Flush()
+
+	var scanner *bufio.Scanner = bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), MaxLineSize)
+	for scanner.Scan() {
+		var quit bool = s.handle(strings.TrimRight(scanner.Text(), "\r"))
+		if err := s.writer.Flush(); err != nil || quit {
+			return
+		}
+	}
+
+	// The line longer than MaxLineSize ends the session, because the rest of it can not be framed
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		s.writeError(fmt.Errorf("request line is longer than %v bytes", MaxLineSize))
+		s.writer.Flush()
+	}
+}
+
+// handle Handle a request line, return true if the client quits
+func (s *session) handle(line string) bool {
+	command, rest := splitWord(line)
+	switch strings.ToUpper(command) {
+	case "":
+		return false
+	case "QUIT":
+		fmt.Fprintln(s.writer, "BYE")
+		return true
+	case "QUERY":
+		rows, result, err := s.conn.Run(rest)
+		s.writeResult(rows, result, err)
+	case "PREPARE":
+		name, query := splitWord(rest)
+		if name == "" {
+			s.writeError(errors.New("PREPARE needs a statement name"))
+			return false
+		}
+		stmt, err := s.conn.Prepare(query)
+		if err != nil {
+			s.writeError(err)
+			return false
+		}
+		s.prepared[name] = stmt
+		fmt.Fprintf(s.writer, "PREPARED %v\n", stmt.NumParams())
+	case "EXECUTE":
+		name, params := splitWord(rest)
+		stmt, ok := s.prepared[name]
+		if !ok {
+			s.writeError(fmt.Errorf("no prepared statement named %q", name))
+			return false
+		}
+		args, err := decodeParams(params)
+		if err != nil {
+			s.writeError(err)
+			return false
+		}
+		rows, result, err := stmt.Run(args...)
+		s.writeResult(rows, result, err)
+	case "DEALLOCATE":
+		if _, ok := s.prepared[rest]; !ok {
+			s.writeError(fmt.Errorf("no prepared statement named %q", rest))
+			return false
+		}
+		delete(s.prepared, rest)
+		fmt.Fprintln(s.writer, "OK 0 0")
+	default:
+		s.writeError(fmt.Errorf("unknown command %q", command))
+	}
+	return false
+}
+
+func splitWord(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	var index int = strings.IndexAny(text, " \t")
+	if index < 0 {
+		return text, ""
+	}
+	return text[:index], strings.TrimSpace(text[index+1:])
+}
+
+// decodeParams Decode the JSON array of parameters, integers are int64 and the other numbers are float64
+func decodeParams(text string) ([]interface{}, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	var decoder *json.Decoder = json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var params []interface{}
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("parameters must be a JSON array: %s", err.Error())
+	}
+	return convertParams(params)
+}
+
+// convertParams Convert the parameters decoded with UseNumber to the arguments of statement
+func convertParams(params []interface{}) ([]interface{}, error) {
+	for i, param := range params {
+		switch value := param.(type) {
+		case json.Number:
+			if integer, err := value.Int64(); err == nil {
+				params[i] = integer
+			} else if float, err := value.Float64(); err == nil {
+				params[i] = float
+			}
+		case nil, string, bool:
+		default:
+			return nil, fmt.Errorf("parameter %v must be a number, string, boolean or null", i+1)
+		}
+	}
+	return params, nil
+}
+
+func (s *session) writeError(err error) {
+	// Messages are one line
+	var message string = strings.Replace(strings.TrimPrefix(err.Error(), "tinyrdb: "), "\n", " ", -1)
+	fmt.Fprintf(s.writer, "ERROR %v\n", message)
+}
+
+func (s *session) writeResult(rows *tinyrdb.Rows, result tinyrdb.Result, err error) {
+	if err != nil {
+		s.writeError(err)
+		return
+	}
+
+	if rows == nil {
+		fmt.Fprintf(s.writer, "OK %v %v\n", result.RowsAffected, result.LastInsertID)
+		return
+	}
+
+	columns, _ := json.Marshal(rows.Columns())
+	fmt.Fprintf(s.writer, "COLUMNS %s\n", columns)
+	var values [][]interface{} = rows.Values()
+	for _, row := range values {
+		line, _ := json.Marshal(row)
+		fmt.Fprintf(s.writer, "ROW %s\n", line)
+	}
+	fmt.Fprintf(s.writer, "END %v\n", len(values))
+}
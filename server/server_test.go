@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net"
+	"os"
+	"testing"
+	"tiny-rdb/client"
+	"tiny-rdb/tinyrdb"
+)
+
+func startServer(t *testing.T, dbFile string, protocol string) (*Server, string) {
+	db, err := tinyrdb.Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen must be success: %v", err)
+	}
+	var server *Server = NewServer(db)
+	server.Protocol = protocol
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	dbFile := "./Server.db"
+	server, address := startServer(t, dbFile, ProtocolLine)
+
+	first, err := client.Dial(address)
+	if err != nil {
+		t.Fatalf("dial must be success: %v", err)
+	}
+	second, _ := client.Dial(address)
+
+	result, err := first.Query("insert 1 chen 'we@qq.com'")
+	if err != nil || result.RowsAffected != 1 || result.LastInsertID != 1 || result.Columns != nil {
+		t.Errorf("insert must be success: %v %v", result, err)
+	}
+
+	numParams, err := first.Prepare("add", "insert ? ? ?")
+	if err != nil || numParams != 3 {
+		t.Errorf("prepare must be success with 3 params: %v %v", numParams, err)
+	}
+	if _, err := first.Query("begin"); err != nil {
+		t.Errorf("begin must be success: %v", err)
+	}
+	for i := 2; i <= 5; i++ {
+		if _, err := first.Execute("add", i, "line\nbreak", nil); err != nil {
+			t.Errorf("execute must be success: %v", err)
+		}
+	}
+
+	// Sessions are isolated, the transaction of first session is not seen by the second one
+	result, _ = second.Query("select")
+	if len(result.Rows) != 1 {
+		t.Errorf("second session must see 1 row, but it sees %v", len(result.Rows))
+	}
+	result, _ = first.Query("select where id >= 2")
+	if len(result.Rows) != 4 || result.Rows[0][0] != int64(2) || result.Rows[0][1] != "line\nbreak" || result.Rows[0][2] != nil {
+		t.Errorf("first session must see its rows: %v", result.Rows)
+	}
+	if len(result.Columns) != 3 || result.Columns[1] != "username" {
+		t.Errorf("columns must be the ones of schema: %v", result.Columns)
+	}
+	first.Query("commit")
+
+	result, _ = second.Query("select")
+	if len(result.Rows) != 5 {
+		t.Errorf("committed rows must be seen, but there are %v rows", len(result.Rows))
+	}
+
+	_, err = second.Query("insert 1 chen we@qq.com")
+	if serverErr, ok := err.(*client.ServerError); !ok || serverErr.Message != "duplicate key" {
+		t.Errorf("error must be duplicate key: %v", err)
+	}
+	if _, err := second.Execute("add", 6, "chen", "we@qq.com"); err == nil {
+		t.Errorf("prepared statements must be private to the session")
+	}
+	if err := first.Deallocate("add"); err != nil {
+		t.Errorf("deallocate must be success: %v", err)
+	}
+	if _, err := first.Execute("add", 6, "chen", "we@qq.com"); err == nil {
+		t.Errorf("deallocated statement must be dropped")
+	}
+
+	// Transaction of closed session is rolled back
+	second.Query("begin")
+	second.Query("insert 6 chen we@qq.com")
+	second.Close()
+	result, _ = first.Query("select")
+	if len(result.Rows) != 5 {
+		t.Errorf("rows must be 5 after the session is closed, but there are %v", len(result.Rows))
+	}
+
+	first.Close()
+	server.Close()
+	server.DB.Close()
+	os.Remove(dbFile)
+}
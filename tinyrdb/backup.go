@@ -0,0 +1,79 @@
+package tinyrdb
+
+import (
+	"tiny-rdb/backend"
+)
+
+// BackupStepPages pages copied in a step of DB.Backup
+const BackupStepPages = 16
+
+// Backup an online backup of DB in progress
+type Backup struct {
+	db     *DB
+	backup *backend.Backup
+}
+
+// BeginBackup Begin an online backup of DB to the file of path. The backup is the committed table at this time,
+// Step copies its pages from a snapshot sharing the pages of DB, so the statements running meanwhile are not blocked
+// by the steps. The pages they change are kept in memory until the backup is done or closed.
+// The file of path and its schema file are replaced when the last page is copied.
+func (db *DB) BeginBackup(path string) (_ *Backup, err error) {
+	table, err := db.pin()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unpin()
+
+	defer db.recoverBackend(&err)
+	backup, err := backend.NewBackup(table, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{db: db, backup: backup}, nil
+}
+
+// Step Copy up to numPages pages, a negative numPages copies all the rest pages.
+// Return true when the backup is done and in place.
+func (backup *Backup) Step(numPages int) (done bool, err error) {
+	// The DB is not closed while the pages are written
+	if _, err := backup.db.pin(); err != nil {
+		return false, err
+	}
+	defer backup.db.unpin()
+	defer backup.db.recoverBackend(&err)
+	if numPages < 0 {
+		numPages = backend.BackupStepAll
+	}
+	return backup.backup.Step(numPages)
+}
+
+// PageCount Get the number of pages of the backup
+func (backup *Backup) PageCount() int {
+	return int(backup.backup.PageCount())
+}
+
+// Remaining Get the number of pages not copied yet
+func (backup *Backup) Remaining() int {
+	return int(backup.backup.Remaining())
+}
+
+// Close Abandon the backup if it is not done
+func (backup *Backup) Close() error {
+	return backup.backup.Close()
+}
+
+// Backup Copy DB to the file of path online, it is BeginBackup and Step until the backup is done
+func (db *DB) Backup(path string) error {
+	backup, err := db.BeginBackup(path)
+	if err != nil {
+		return err
+	}
+	defer backup.Close()
+
+	for {
+		done, err := backup.Step(BackupStepPages)
+		if err != nil || done {
+			return err
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tinyrdb
+
+import (
+	"sync"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/sql"
+)
+
+// Conn a session of DB, begin/commit/rollback statements of a session control its own transaction,
+// so sessions of different clients are isolated from each other
+type Conn struct {
+	db    *DB
+	tx    *Tx
+	mutex sync.Mutex
+}
+
+// Stmt a statement prepared in a session, it can be run many times with different arguments
+type Stmt struct {
+	conn      *Conn
+	query     string
+	numParams int
+	template  sql.Statement // the statement with unbound parameters, it tells the kind of statement
+}
+
+// Conn Make a new session of DB
+func (db *DB) Conn() *Conn {
+	return &Conn{db: db}
+}
+
+// Run Run a statement in the session, rows is nil for the statements which return no rows
+func (c *Conn) Run(query string, args ...interface{}) (rows *Rows, result Result, err error) {
+	table, err := c.db.pin()
+	if err != nil {
+		return nil, Result{}, err
+	}
+	defer c.db.unpin()
+
+	statement, err := c.db.prepare(query, args)
+	if err != nil {
+		return nil, Result{}, err
+	}
+	defer c.db.recoverBackend(&err)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if isTransactionStatement(statement) && !statement.Explain {
+		return nil, Result{}, c.runTransactionStatement(table, statement)
+	}
+
+	if c.tx != nil {
+		if table, err = c.tx.workTable(); err != nil {
+			return nil, Result{}, err
+		}
+	}
+
+	if statement.Explain || statement.Type == sql.SelectStatement {
+		rows, err = queryStatement(table, statement)
+		return rows, Result{}, err
+	}
+	result, err = execStatement(table, statement)
+	return nil, result, err
+}
+
+// runTransactionStatement Run begin, commit and rollback statement of the session, the caller pins the DB
+func (c *Conn) runTransactionStatement(table *backend.Table, statement *sql.Statement) error {
+	if statement.Type == sql.BeginStatement {
+		if c.tx != nil {
+			return ErrTransactionActive
+		}
+		tx, err := c.db.begin(table)
+		c.tx = tx
+		return err
+	}
+
+	if c.tx == nil {
+		return ErrNoTransaction
+	}
+	var tx *Tx = c.tx
+	c.tx = nil
+	if statement.Type == sql.CommitStatement {
+		if !tx.end() {
+			return ErrTxDone
+		}
+		return tx.commit(table)
+	}
+	return tx.Rollback()
+}
+
+// InTransaction Check if the session has an active transaction
+func (c *Conn) InTransaction() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.tx != nil
+}
+
+// Close Close the session, the active transaction is rolled back
+func (c *Conn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.tx != nil {
+		c.tx.Rollback()
+		c.tx = nil
+	}
+	return nil
+}
+
+// Prepare Prepare a statement in the session
+func (c *Conn) Prepare(query string) (*Stmt, error) {
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	if c.db.table == nil {
+		return nil, ErrClosed
+	}
+
+	prepared, result := sql.PrepareCached(c.db.cache, query)
+	if result != sql.PrepareSuccess {
+		return nil, prepareError(result)
+	}
+	return &Stmt{conn: c, query: query, numParams: sql.NumParams(prepared), template: prepared.Template}, nil
+}
+
+// NumParams Get the num of parameters of the statement
+func (s *Stmt) NumParams() int {
+	return s.numParams
+}
+
+// Query Get the SQL text of the statement
+func (s *Stmt) Query() string {
+	return s.query
+}
+
+// Describe Get the names and types of result columns without running the statement,
+// they are nil for the statements without result rows
+func (s *Stmt) Describe() ([]string, []string, error) {
+	table, err := s.conn.db.pin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.conn.db.unpin()
+
+	s.conn.mutex.Lock()
+	defer s.conn.mutex.Unlock()
+	if s.conn.tx != nil {
+		if table, err = s.conn.tx.workTable(); err != nil {
+			return nil, nil, err
+		}
+	}
+	columns, types := resultColumns(table, &s.template)
+	return columns, types, nil
+}
+
+// Run Run the statement with arguments in its session
+func (s *Stmt) Run(args ...interface{}) (*Rows, Result, error) {
+	return s.conn.Run(s.query, args...)
+}
+
+// Values Get the values of all remaining rows, NULL is nil
+func (rows *Rows) Values() [][]interface{} {
+	if rows.pos > len(rows.values) {
+		return nil
+	}
+	var values [][]interface{} = rows.values[rows.pos:]
+	rows.pos = len(rows.values) + 1
+	return values
+}
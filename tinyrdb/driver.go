@@ -0,0 +1,265 @@
+package tinyrdb
+
+import (
+	dbsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tiny-rdb/frontend/sql"
+)
+
+// DriverName name of the driver registered to database/sql, the data source name is the path of DB file
+// with optional parameters, mode=ro opens the file read-only and busy_timeout is in milliseconds.
+//
+//	db, err := sql.Open("tinyrdb", "test.db?mode=ro&busy_timeout=5000")
+const DriverName = "tinyrdb"
+
+func init() {
+	dbsql.Register(DriverName, &Driver{})
+}
+
+// Driver database/sql driver of tiny-rdb
+type Driver struct{}
+
+// sharedDB a DB opened by the driver, the connections to the same data source share it,
+// because the DB file is locked by the DB. Each connection runs its transaction on its own snapshot.
+type sharedDB struct {
+	name string
+	db   *DB
+	refs int
+}
+
+var (
+	sharedMutex sync.Mutex
+	sharedDBs   = make(map[string]*sharedDB)
+)
+
+// conn a connection, database/sql never uses a connection concurrently
+type conn struct {
+	shared *sharedDB
+	tx     *Tx // active transaction of the connection
+	closed bool
+}
+
+type stmt struct {
+	conn     *conn
+	query    string
+	numInput int
+}
+
+type tx struct {
+	conn *conn
+}
+
+type result struct {
+	result Result
+}
+
+type rows struct {
+	rows *Rows
+}
+
+// Open Open a connection to the DB file, the name is the path of DB file
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+
+	shared, ok := sharedDBs[name]
+	if !ok {
+		path, opts, err := parseDataSourceName(name)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := Open(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		shared = &sharedDB{name: name, db: db}
+		sharedDBs[name] = shared
+	}
+	shared.refs++
+	return &conn{shared: shared}, nil
+}
+
+func parseDataSourceName(name string) (string, *Options, error) {
+	var opts *Options = &Options{}
+	var index int = strings.LastIndex(name, "?")
+	if index < 0 {
+		return name, opts, nil
+	}
+
+	params, err := url.ParseQuery(name[index+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	for key, values := range params {
+		var value string = values[len(values)-1]
+		switch key {
+		case "mode":
+			if value != "ro" && value != "rw" {
+				return "", nil, fmt.Errorf("tinyrdb: unknown mode %q", value)
+			}
+			opts.ReadOnly = value == "ro"
+		case "busy_timeout":
+			milliseconds, err := strconv.Atoi(value)
+			if err != nil || milliseconds < 0 {
+				return "", nil, fmt.Errorf("tinyrdb: invalid busy_timeout %q", value)
+			}
+			opts.BusyTimeout = time.Duration(milliseconds) * time.Millisecond
+		default:
+			return "", nil, fmt.Errorf("tinyrdb: unknown parameter %q", key)
+		}
+	}
+	return name[:index], opts, nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.closed {
+		return nil, driver.ErrBadConn
+	}
+
+	var db *DB = c.shared.db
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	prepared, result := sql.PrepareCached(db.cache, query)
+	if result != sql.PrepareSuccess {
+		return nil, prepareError(result)
+	}
+	return &stmt{conn: c, query: query, numInput: sql.NumParams(prepared)}, nil
+}
+
+func (c *conn) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.tx != nil {
+		// Transaction of closed connection is rolled back
+		c.tx.Rollback()
+		c.tx = nil
+	}
+
+	sharedMutex.Lock()
+	defer sharedMutex.Unlock()
+	c.shared.refs--
+	if c.shared.refs > 0 {
+		return nil
+	}
+	delete(sharedDBs, c.shared.name)
+	return c.shared.db.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	if c.closed {
+		return nil, driver.ErrBadConn
+	}
+
+	transaction, err := c.shared.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	c.tx = transaction
+	return &tx{conn: c}, nil
+}
+
+func (t *tx) Commit() error {
+	var transaction *Tx = t.conn.tx
+	t.conn.tx = nil
+	if transaction == nil {
+		return ErrTxDone
+	}
+	return transaction.Commit()
+}
+
+func (t *tx) Rollback() error {
+	var transaction *Tx = t.conn.tx
+	t.conn.tx = nil
+	if transaction == nil {
+		return ErrTxDone
+	}
+	return transaction.Rollback()
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.numInput
+}
+
+func driverArgs(args []driver.Value) []interface{} {
+	var values []interface{} = make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.conn.closed {
+		return nil, driver.ErrBadConn
+	}
+
+	var execResult Result
+	var err error
+	if s.conn.tx != nil {
+		execResult, err = s.conn.tx.Exec(s.query, driverArgs(args)...)
+	} else {
+		execResult, err = s.conn.shared.db.Exec(s.query, driverArgs(args)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result{result: execResult}, nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.conn.closed {
+		return nil, driver.ErrBadConn
+	}
+
+	var queryRows *Rows
+	var err error
+	if s.conn.tx != nil {
+		queryRows, err = s.conn.tx.Query(s.query, driverArgs(args)...)
+	} else {
+		queryRows, err = s.conn.shared.db.Query(s.query, driverArgs(args)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: queryRows}, nil
+}
+
+func (r result) LastInsertId() (int64, error) {
+	return r.result.LastInsertID, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.result.RowsAffected, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *rows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		return io.EOF
+	}
+	for i, value := range r.rows.values[r.rows.pos-1] {
+		dest[i] = value
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package tinyrdb
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestDriver(t *testing.T) {
+	dbFile := "./Driver.db"
+	db, err := sql.Open(DriverName, dbFile)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	result, err := db.Exec("insert ? ? ?", 1, "chen", "we@qq.com")
+	if err != nil {
+		t.Fatalf("insert must be success: %v", err)
+	}
+	if id, _ := result.LastInsertId(); id != 1 {
+		t.Errorf("last insert id must be 1: %v", id)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("begin must be success: %v", err)
+	}
+	stmt, err := tx.Prepare("insert ? ? ?")
+	if err != nil {
+		t.Fatalf("prepare must be success: %v", err)
+	}
+	for i := 2; i <= 20; i++ {
+		if _, err := stmt.Exec(i, "user", nil); err != nil {
+			t.Errorf("insert must be success: %v", err)
+		}
+	}
+	stmt.Close()
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("rollback must be success: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("select").Scan(new(int64), new(string), new(string)); err != nil {
+		t.Errorf("query row must be success: %v", err)
+	}
+
+	tx, _ = db.Begin()
+	if _, err := tx.Exec("insert ? ? ?", 2, "chen", nil); err != nil {
+		t.Errorf("insert must be success: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("commit must be success: %v", err)
+	}
+
+	if _, err := db.Exec("insert 2 chen we@qq.com"); err != ErrDuplicateKey {
+		t.Errorf("error must be duplicate key: %v", err)
+	}
+
+	rows, err := db.Query("select where id >= ? order by id desc", 1)
+	if err != nil {
+		t.Fatalf("query must be success: %v", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var name string
+		var email sql.NullString
+		if err := rows.Scan(&id, &name, &email); err != nil {
+			t.Errorf("scan must be success: %v", err)
+		}
+		if id == 2 && email.Valid {
+			t.Errorf("email of row 2 must be NULL")
+		}
+		ids = append(ids, id)
+		count++
+	}
+	rows.Close()
+	if count != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Errorf("rows must be 2, 1 but they are %v", ids)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Errorf("close must be success: %v", err)
+	}
+	os.Remove(dbFile)
+}
@@ -0,0 +1,623 @@
+// Package tinyrdb is the embeddable API of tiny-rdb, it runs statements on a DB file in the process
+// without the REPL.
+//
+//	db, err := tinyrdb.Open("test.db", nil)
+//	result, err := db.Exec("insert ? ? ?", 1, "chen", "we@qq.com")
+//	rows, err := db.Query("select where id >= ? order by id", 1)
+//	for rows.Next() {
+//		var id int64
+//		var userName, email string
+//		err = rows.Scan(&id, &userName, &email)
+//	}
+//	err = db.Close()
+//
+// Placeholders are "?" or "$N", the arguments are bound as values and never go through the SQL text.
+// An I/O error or a corrupt page met by a statement is returned as *backend.Error. The statement may leave the cached
+// pages half changed, so the later statements fail with the same error and Close releases the file without writing them.
+// The methods of DB can be called from several goroutines, but the locking is the minimum that keeps them correct:
+// the statements changing the table run one at a time under a lock of the whole table, there is no page-level latch
+// and no latch crabbing. Each call pins the DB until it returns, so Close waits for the statements in progress.
+// Queries read snapshots, so they neither block the statements changing the table nor see half-applied transactions. A Tx sees the snapshot taken at Begin and its own changes, its commit fails
+// with ErrConflict if a page it changed was changed by another commit since it began.
+package tinyrdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tiny-rdb/backend"
+	"tiny-rdb/frontend/sql"
+)
+
+// Errors of statements, they are the result codes of the engine
+var (
+	ErrClosed                = errors.New("tinyrdb: database is closed")
+	ErrNotExist              = errors.New("tinyrdb: database file does not exist")
+	ErrStringTooLong         = errors.New("tinyrdb: string too long")
+	ErrSyntax                = errors.New("tinyrdb: syntax error")
+	ErrUnrecognizedStatement = errors.New("tinyrdb: unrecognized statement")
+	ErrUnboundParameter      = errors.New("tinyrdb: parameter is not bound")
+	ErrTypeMismatch          = errors.New("tinyrdb: value does not match the column type")
+	ErrTableFull             = errors.New("tinyrdb: table full")
+	ErrDuplicateKey          = errors.New("tinyrdb: duplicate key")
+	ErrNotNullConstraint     = errors.New("tinyrdb: NOT NULL constraint failed")
+	ErrUniqueConstraint      = errors.New("tinyrdb: UNIQUE constraint failed")
+	ErrCheckConstraint       = errors.New("tinyrdb: CHECK constraint failed")
+	ErrKeyNotFound           = errors.New("tinyrdb: key not found")
+	ErrNoSuchColumn          = errors.New("tinyrdb: no such column")
+	ErrTableExists           = errors.New("tinyrdb: table already exists")
+	ErrTransactionActive     = errors.New("tinyrdb: cannot start a transaction within a transaction")
+	ErrNoTransaction         = errors.New("tinyrdb: no transaction is active")
+	ErrConflict              = errors.New("tinyrdb: transaction conflicts with a committed change")
+	ErrVacuumInTransaction   = errors.New("tinyrdb: cannot VACUUM from within a transaction")
+	ErrTxDone                = errors.New("tinyrdb: transaction has already been committed or rolled back")
+	ErrTxStatement           = errors.New("tinyrdb: use Commit or Rollback of Tx to end the transaction")
+	ErrTransactionStatement  = errors.New("tinyrdb: begin, commit and rollback are not run by DB, use DB.Begin or the statements of a Conn")
+	ErrReadOnly              = errors.New("tinyrdb: attempt to write a readonly database")
+	ErrLocked                = backend.ErrLocked
+	ErrUnsupported           = errors.New("tinyrdb: statement is not supported")
+	ErrNoRows                = errors.New("tinyrdb: Scan called without a current row")
+)
+
+// Options options of opening a database, nil is the default options
+type Options struct {
+	// Return ErrNotExist instead of creating a new DB file if the file does not exist
+	MustExist bool
+	// Open with SHARED lock, the other readers can open the file too but the statements changing it fail with ErrReadOnly.
+	// Otherwise the DB is opened with EXCLUSIVE lock.
+	ReadOnly bool
+	// How long Open waits for the lock held by other DB or process before it fails with ErrLocked
+	BusyTimeout time.Duration
+	// Read the pages from the DB file mapped in memory instead of file I/O, for read-heavy workloads.
+	// Only supported on linux, Open fails with backend.ErrMmapUnsupported on the other platforms.
+	MemoryMapped bool
+	// When the written pages are synced to disk: backend.SynchronousFull syncs by each commit and each statement
+	// out of transactions, SynchronousNormal by Close only and SynchronousOff never. The default is SynchronousFull.
+	Synchronous backend.Synchronous
+}
+
+// DB a handle of database opened in the process
+type DB struct {
+	table  *backend.Table
+	cache  *sql.StatementCache
+	mutex  sync.Mutex // guards the statement cache and the bindings of cached statements
+	failed error      // the error raised by the backend, the cached pages can not be trusted after it
+
+	// Calls using the table hold the read lock from preparing the statement to its end, Close holds the write lock.
+	// It is taken before mutex.
+	lifecycle sync.RWMutex
+}
+
+// Result summary of an executed statement
+type Result struct {
+	LastInsertID int64
+	RowsAffected int64
+}
+
+// ColumnInfo declaration of a column
+type ColumnInfo struct {
+	Name       string
+	Type       string // INTEGER or TEXT
+	PrimaryKey bool
+	NotNull    bool
+	Unique     bool
+}
+
+// TableInfo declaration of a table
+type TableInfo struct {
+	Name    string
+	Columns []ColumnInfo
+}
+
+// Rows result rows of query, the rows are read when the query runs
+type Rows struct {
+	columns []string
+	types   []string // declared types of columns, INTEGER or TEXT
+	values  [][]interface{}
+	pos     int // the row of next Scan is values[pos-1]
+	err     error
+	closed  bool
+}
+
+// Open Open a database from DB file
+func Open(path string, opts *Options) (*DB, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.MustExist {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+	}
+
+	table, err := backend.OpenWithOptions(path, &backend.OpenOptions{
+		ReadOnly:     opts.ReadOnly,
+		BusyTimeout:  opts.BusyTimeout,
+		MemoryMapped: opts.MemoryMapped,
+		Synchronous:  opts.Synchronous,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{table: table, cache: sql.NewStatementCache()}, nil
+}
+
+// Close Flush the pages to disk and close the DB file, return the error if the pages can not be written or the file
+// can not be closed. After an error raised by the backend the pages are not written and the error is returned again.
+func (db *DB) Close() error {
+	db.lifecycle.Lock()
+	defer db.lifecycle.Unlock()
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.table == nil {
+		return ErrClosed
+	}
+
+	var err error
+	db.table.RWLock.Lock()
+	if db.failed != nil {
+		if err = backend.Discard(db.table); err == nil {
+			err = db.failed
+		}
+	} else {
+		err = backend.Close(db.table)
+	}
+	db.table.RWLock.Unlock()
+	db.table = nil
+	return err
+}
+
+// pin Get the table of DB and keep it open until unpin, or return the error if the DB is closed or failed
+func (db *DB) pin() (*backend.Table, error) {
+	db.lifecycle.RLock()
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if db.table == nil {
+		db.lifecycle.RUnlock()
+		return nil, ErrClosed
+	}
+	if db.failed != nil {
+		db.lifecycle.RUnlock()
+		return nil, db.failed
+	}
+	return db.table, nil
+}
+
+// unpin Let Close go on, the table got by pin must not be used afterwards
+func (db *DB) unpin() {
+	db.lifecycle.RUnlock()
+}
+
+// recoverBackend Return the error raised by the backend through err, it must be called by defer
+func (db *DB) recoverBackend(err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	backendErr, ok := recovered.(*backend.Error)
+	if !ok {
+		panic(recovered)
+	}
+	*err = backendErr
+
+	db.mutex.Lock()
+	if db.failed == nil {
+		db.failed = backendErr
+	}
+	db.mutex.Unlock()
+}
+
+// Exec Run a statement which returns no rows, such as insert, update and create. Begin, commit and rollback
+// statements fail with ErrTransactionStatement, since the DB is shared by its users: use Begin for a transaction,
+// or a Conn whose transaction statements control its own transaction.
+func (db *DB) Exec(query string, args ...interface{}) (result Result, err error) {
+	table, err := db.pin()
+	if err != nil {
+		return Result{}, err
+	}
+	defer db.unpin()
+
+	statement, err := db.prepare(query, args)
+	if err != nil {
+		return Result{}, err
+	}
+	if isTransactionStatement(statement) && !statement.Explain {
+		return Result{}, ErrTransactionStatement
+	}
+	defer db.recoverBackend(&err)
+	return execStatement(table, statement)
+}
+
+// Query Run a statement which returns rows, such as select and explain. Begin, commit and rollback statements
+// fail with ErrTransactionStatement like Exec.
+func (db *DB) Query(query string, args ...interface{}) (rows *Rows, err error) {
+	table, err := db.pin()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unpin()
+
+	statement, err := db.prepare(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if isTransactionStatement(statement) && !statement.Explain {
+		return nil, ErrTransactionStatement
+	}
+	defer db.recoverBackend(&err)
+	return queryStatement(table, statement)
+}
+
+// Ping Check that the DB is open and its file can be used: the DB file is stat'ed and the root page is read
+func (db *DB) Ping() (err error) {
+	table, err := db.pin()
+	if err != nil {
+		return err
+	}
+	defer db.unpin()
+	defer db.recoverBackend(&err)
+
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+	if _, err := table.Pager.FilePtr.Stat(); err != nil {
+		return err
+	}
+	backend.TreeDepth(table)
+	return nil
+}
+
+// Tables Get the declarations of tables in the DB file, there is one table in a DB file
+func (db *DB) Tables() ([]TableInfo, error) {
+	table, err := db.pin()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unpin()
+
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+	var info TableInfo = TableInfo{Name: table.Schema.TableName}
+	for _, column := range table.Schema.Columns {
+		info.Columns = append(info.Columns, ColumnInfo{
+			Name:       column.Name,
+			Type:       columnTypeName(column.Type),
+			PrimaryKey: column.PrimaryKey,
+			NotNull:    column.NotNull,
+			Unique:     column.Unique,
+		})
+	}
+	return []TableInfo{info}, nil
+}
+
+func columnTypeName(columnType backend.ColumnType) string {
+	if columnType == backend.ColumnInteger {
+		return "INTEGER"
+	}
+	return "TEXT"
+}
+
+func isTransactionStatement(statement *sql.Statement) bool {
+	return statement.Type == sql.BeginStatement || statement.Type == sql.CommitStatement || statement.Type == sql.RollbackStatement
+}
+
+// execStatement Run the statement on table, the transaction statements are run by the callers
+func execStatement(table *backend.Table, statement *sql.Statement) (Result, error) {
+	var result Result
+	switch {
+	case statement.Explain:
+		return result, nil
+	case statement.Type == sql.SelectStatement:
+		// Rows of select are discarded
+		if statement.SelectLastInsertID {
+			return result, nil
+		}
+		return result, resultError(sql.SelectRows(table, statement, func(row *backend.Row) bool { return true }))
+	}
+
+	if err := resultError(sql.RunStatement(table, statement)); err != nil {
+		return result, err
+	}
+
+	if statement.Type == sql.InsertStatement {
+		// The id is assigned on insert if it is not given
+		result.LastInsertID = int64(statement.RowToInsert.PrimaryID)
+	}
+	if statement.Type == sql.InsertStatement || statement.Type == sql.UpdateStatement {
+		result.RowsAffected = 1
+	}
+	return result, nil
+}
+
+// queryStatement Run the statement on table and read its rows, the transaction statements are run by the callers
+func queryStatement(table *backend.Table, statement *sql.Statement) (*Rows, error) {
+	var rows *Rows = new(Rows)
+	rows.columns, rows.types = resultColumns(table, statement)
+	switch {
+	case statement.Explain:
+		for _, line := range sql.FormatPlan(sql.PlanStatement(table, statement)) {
+			rows.values = append(rows.values, []interface{}{line})
+		}
+	case statement.Type != sql.SelectStatement:
+		// Statement without result rows, likes database/sql it runs and returns no rows
+		if err := resultError(sql.RunStatement(table, statement)); err != nil {
+			return nil, err
+		}
+	case statement.SelectLastInsertID:
+		table.RWLock.RLock()
+		rows.values = [][]interface{}{{int64(table.LastInsertID)}}
+		table.RWLock.RUnlock()
+	default:
+		var result sql.ExecuteResult = sql.SelectRows(table, statement, func(row *backend.Row) bool {
+			rows.values = append(rows.values, sql.RowValues(row))
+			return true
+		})
+		if err := resultError(result); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// resultColumns Get the names and types of result columns of statement, they are nil for the statements without result rows
+func resultColumns(table *backend.Table, statement *sql.Statement) ([]string, []string) {
+	switch {
+	case statement.Explain:
+		return []string{"plan"}, []string{"TEXT"}
+	case statement.Type != sql.SelectStatement:
+		return nil, nil
+	case statement.SelectLastInsertID:
+		return []string{"last_insert_id()"}, []string{"INTEGER"}
+	}
+
+	var columns []string
+	var types []string
+	table.RWLock.RLock()
+	defer table.RWLock.RUnlock()
+	for _, column := range table.Schema.Columns {
+		columns = append(columns, column.Name)
+		types = append(types, columnTypeName(column.Type))
+	}
+	return columns, types
+}
+
+// prepare Compile the query through the statement cache and bind the arguments, the caller pins the DB
+func (db *DB) prepare(query string, args []interface{}) (*sql.Statement, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	prepared, result := sql.PrepareCached(db.cache, query)
+	if result != sql.PrepareSuccess {
+		return nil, prepareError(result)
+	}
+
+	if len(args) != sql.NumParams(prepared) {
+		return nil, fmt.Errorf("tinyrdb: expected %v arguments, got %v", sql.NumParams(prepared), len(args))
+	}
+
+	for i, arg := range args {
+		if err := bindArg(prepared, i+1, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	var statement *sql.Statement = new(sql.Statement)
+	if result := sql.BindStatement(prepared, statement); result != sql.PrepareSuccess {
+		return nil, prepareError(result)
+	}
+	return statement, nil
+}
+
+func bindArg(prepared *sql.PreparedStatement, index int, arg interface{}) error {
+	switch value := arg.(type) {
+	case nil:
+		sql.BindNull(prepared, index)
+	case int:
+		sql.BindInt(prepared, index, int64(value))
+	case int8:
+		sql.BindInt(prepared, index, int64(value))
+	case int16:
+		sql.BindInt(prepared, index, int64(value))
+	case int32:
+		sql.BindInt(prepared, index, int64(value))
+	case int64:
+		sql.BindInt(prepared, index, value)
+	case uint:
+		sql.BindInt(prepared, index, int64(value))
+	case uint8:
+		sql.BindInt(prepared, index, int64(value))
+	case uint16:
+		sql.BindInt(prepared, index, int64(value))
+	case uint32:
+		sql.BindInt(prepared, index, int64(value))
+	case uint64:
+		if value > math.MaxInt64 {
+			return ErrTypeMismatch
+		}
+		sql.BindInt(prepared, index, int64(value))
+	case bool:
+		if value {
+			sql.BindInt(prepared, index, 1)
+		} else {
+			sql.BindInt(prepared, index, 0)
+		}
+	case float32:
+		sql.BindFloat(prepared, index, float64(value))
+	case float64:
+		sql.BindFloat(prepared, index, value)
+	case string:
+		sql.BindString(prepared, index, value)
+	case []byte:
+		sql.BindString(prepared, index, string(value))
+	default:
+		return fmt.Errorf("tinyrdb: unsupported argument type %T", arg)
+	}
+	return nil
+}
+
+func prepareError(result sql.PrepareStatementResult) error {
+	switch result {
+	case sql.PrepareSuccess:
+		return nil
+	case sql.PrepareStringTooLong:
+		return ErrStringTooLong
+	case sql.PrepareUnrecognizedStatement:
+		return ErrUnrecognizedStatement
+	case sql.PrepareUnboundParameter:
+		return ErrUnboundParameter
+	case sql.PrepareTypeMismatch:
+		return ErrTypeMismatch
+	}
+	return ErrSyntax
+}
+
+func resultError(result sql.ExecuteResult) error {
+	switch result {
+	case sql.ExecuteSuccess:
+		return nil
+	case sql.ExecuteTableFull:
+		return ErrTableFull
+	case sql.ExecuteDuplicateKey:
+		return ErrDuplicateKey
+	case sql.ExecuteNotNullConstraint:
+		return ErrNotNullConstraint
+	case sql.ExecuteUniqueConstraint:
+		return ErrUniqueConstraint
+	case sql.ExecuteCheckConstraint:
+		return ErrCheckConstraint
+	case sql.ExecuteKeyNotFound:
+		return ErrKeyNotFound
+	case sql.ExecuteUnknownColumn:
+		return ErrNoSuchColumn
+	case sql.ExecuteTableExists:
+		return ErrTableExists
+	case sql.ExecuteTransactionActive:
+		return ErrTransactionActive
+	case sql.ExecuteVacuumInTransaction:
+		return ErrVacuumInTransaction
+	case sql.ExecuteNoTransaction:
+		return ErrNoTransaction
+	case sql.ExecuteReadOnly:
+		return ErrReadOnly
+	case sql.ExecuteConflict:
+		return ErrConflict
+	}
+	return ErrUnsupported
+}
+
+// Columns Get the names of result columns
+func (rows *Rows) Columns() []string {
+	return rows.columns
+}
+
+// ColumnTypes Get the declared types of result columns, INTEGER or TEXT
+func (rows *Rows) ColumnTypes() []string {
+	return rows.types
+}
+
+// Next Move to the next row, return false if there are no more rows
+func (rows *Rows) Next() bool {
+	if rows.closed || rows.pos >= len(rows.values) {
+		// Move past the last row, so Scan fails
+		rows.pos = len(rows.values) + 1
+		return false
+	}
+	rows.pos++
+	return true
+}
+
+// Scan Copy the columns of current row to dest, the num of dest must be the num of columns.
+// Supported dest are *int, *int64, *uint32, *float64, *string, *[]byte and *interface{}.
+// NULL can only be scanned to *interface{} (as nil) and *[]byte (as nil slice).
+func (rows *Rows) Scan(dest ...interface{}) error {
+	if rows.closed || rows.pos == 0 || rows.pos > len(rows.values) {
+		return ErrNoRows
+	}
+
+	var values []interface{} = rows.values[rows.pos-1]
+	if len(dest) != len(values) {
+		return fmt.Errorf("tinyrdb: expected %v destination arguments in Scan, got %v", len(values), len(dest))
+	}
+
+	for i, value := range values {
+		if err := scanValue(dest[i], value); err != nil {
+			return fmt.Errorf("tinyrdb: Scan column %v (%v): %s", i, rows.columns[i], err.Error())
+		}
+	}
+	return nil
+}
+
+func scanValue(dest interface{}, value interface{}) error {
+	if ptr, ok := dest.(*interface{}); ok {
+		*ptr = value
+		return nil
+	}
+	if ptr, ok := dest.(*[]byte); ok {
+		if value == nil {
+			*ptr = nil
+		} else {
+			*ptr = []byte(fmt.Sprint(value))
+		}
+		return nil
+	}
+	if value == nil {
+		return fmt.Errorf("can not scan NULL into %T", dest)
+	}
+
+	switch ptr := dest.(type) {
+	case *string:
+		*ptr = fmt.Sprint(value)
+		return nil
+	case *int64, *int, *uint32, *float64:
+		integer, ok := value.(int64)
+		if !ok {
+			// Text column holding a number
+			var text string = value.(string)
+			parsed, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+			if floatPtr, isFloat := dest.(*float64); err != nil && isFloat {
+				float, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+				if err != nil {
+					return fmt.Errorf("can not convert %q to %T", text, dest)
+				}
+				*floatPtr = float
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("can not convert %q to %T", text, dest)
+			}
+			integer = parsed
+		}
+		switch ptr := dest.(type) {
+		case *int64:
+			*ptr = integer
+		case *int:
+			*ptr = int(integer)
+		case *float64:
+			*ptr = float64(integer)
+		case *uint32:
+			if integer < 0 || integer > math.MaxUint32 {
+				return fmt.Errorf("value %v out of range of uint32", integer)
+			}
+			*ptr = uint32(integer)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported destination type %T", dest)
+}
+
+// Err Get the error met during iteration, rows are read when the query runs so it is always nil for now
+func (rows *Rows) Err() error {
+	return rows.err
+}
+
+// Close Close the rows, Next returns false afterwards
+func (rows *Rows) Close() error {
+	rows.closed = true
+	rows.values = nil
+	return nil
+}
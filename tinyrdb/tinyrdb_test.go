@@ -0,0 +1,397 @@
+package tinyrdb
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"tiny-rdb/backend"
+)
+
+func TestExecAndQuery(t *testing.T) {
+	dbFile := "./Library.db"
+	db, err := Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	if _, err := db.Exec("create table person (id integer primary key autoincrement, name text not null, email text unique)"); err != nil {
+		t.Errorf("create must be success: %v", err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		result, err := db.Exec("insert null ? ?", "chen' or 1=1", nil)
+		if err != nil {
+			t.Errorf("insert must be success: %v", err)
+		}
+		if result.LastInsertID != int64(i) || result.RowsAffected != 1 {
+			t.Errorf("result must be (%v, 1), but it is %v", i, result)
+		}
+	}
+
+	if _, err := db.Exec("insert 1 chen we@qq.com"); err != ErrDuplicateKey {
+		t.Errorf("error must be duplicate key: %v", err)
+	}
+	if _, err := db.Exec("insert 11 ?", nil); err != ErrNotNullConstraint {
+		t.Errorf("error must be NOT NULL constraint: %v", err)
+	}
+	if _, err := db.Exec("insert ? ? ?", 1); err == nil {
+		t.Errorf("wrong num of arguments must be error")
+	}
+	if _, err := db.Exec("insert ? chen", struct{}{}); err == nil {
+		t.Errorf("unsupported argument type must be error")
+	}
+
+	rows, err := db.Query("select where id >= ? and id <= $2 order by id desc", 3, 5)
+	if err != nil {
+		t.Fatalf("query must be success: %v", err)
+	}
+	if columns := rows.Columns(); len(columns) != 3 || columns[0] != "id" || columns[1] != "name" {
+		t.Errorf("columns must be the ones of schema: %v", columns)
+	}
+
+	var expectedID int64 = 5
+	for rows.Next() {
+		var id int64
+		var name string
+		var email interface{} = "not null"
+		if err := rows.Scan(&id, &name, &email); err != nil {
+			t.Errorf("scan must be success: %v", err)
+		}
+		if id != expectedID || name != "chen' or 1=1" || email != nil {
+			t.Errorf("row must be (%v, chen' or 1=1, nil), but it is (%v, %v, %v)", expectedID, id, name, email)
+		}
+		expectedID--
+	}
+	if expectedID != 2 || rows.Err() != nil {
+		t.Errorf("query must return rows 5, 4, 3")
+	}
+
+	var name string
+	var email string
+	if rows.Scan(&expectedID, &name, &email) != ErrNoRows {
+		t.Errorf("scan after the last row must be error")
+	}
+	rows.Close()
+
+	rows, _ = db.Query("select where id = 1")
+	rows.Next()
+	var id int64
+	if rows.Scan(&id, &name, &email) == nil {
+		t.Errorf("scan NULL into string must be error")
+	}
+
+	rows, err = db.Query("select last_insert_id()")
+	if err != nil || !rows.Next() || rows.Scan(&id) != nil || id != 10 {
+		t.Errorf("last_insert_id() must be 10: %v", id)
+	}
+
+	if db.Close() != nil {
+		t.Errorf("close must be success")
+	}
+	if _, err := db.Exec("select"); err != ErrClosed {
+		t.Errorf("error must be closed: %v", err)
+	}
+
+	db, err = Open(dbFile, &Options{MustExist: true})
+	if err != nil {
+		t.Fatalf("reopen must be success: %v", err)
+	}
+	rows, _ = db.Query("select")
+	var count int = 0
+	for rows.Next() {
+		count++
+	}
+	if count != 10 {
+		t.Errorf("rows must be persisted, but there are %v rows", count)
+	}
+	db.Close()
+
+	os.Remove(dbFile)
+	os.Remove(backend.SchemaFileName(dbFile))
+
+	if _, err := Open("./NotExist.db", &Options{MustExist: true}); err != ErrNotExist {
+		t.Errorf("error must be not exist: %v", err)
+	}
+}
+
+// TestConcurrentStatements run with -race to check the statements are synchronized
+func TestConcurrentStatements(t *testing.T) {
+	dbFile := "./Concurrent.db"
+	db, err := Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	const numWriters = 4
+	const numInserts = 50
+	var group sync.WaitGroup
+	for writer := 0; writer < numWriters; writer++ {
+		group.Add(1)
+		go func(writer int) {
+			defer group.Done()
+			for i := 0; i < numInserts; i++ {
+				// Keys of writers interleave, so the leaves are split by different writers
+				if _, err := db.Exec("insert ? ? ?", i*numWriters+writer+1, "user", "we@qq.com"); err != nil {
+					t.Errorf("insert must be success: %v", err)
+				}
+			}
+		}(writer)
+	}
+
+	for reader := 0; reader < 4; reader++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for i := 0; i < numInserts; i++ {
+				rows, err := db.Query("select where id > ?", i)
+				if err != nil {
+					t.Errorf("select must be success: %v", err)
+					return
+				}
+				var lastID int64 = -1
+				for rows.Next() {
+					var id int64
+					var userName, email string
+					rows.Scan(&id, &userName, &email)
+					if id <= lastID {
+						t.Errorf("rows must be in order of id, %v after %v", id, lastID)
+					}
+					lastID = id
+				}
+			}
+		}()
+	}
+	group.Wait()
+
+	rows, _ := db.Query("select")
+	var count int = 0
+	for rows.Next() {
+		count++
+	}
+	if count != numWriters*numInserts {
+		t.Errorf("num of rows must be %v, but it is %v", numWriters*numInserts, count)
+	}
+
+	db.Close()
+	os.Remove(dbFile)
+}
+
+// TestCloseDuringStatements run with -race, Close waits for the statements which have pinned the DB
+func TestCloseDuringStatements(t *testing.T) {
+	dbFile := "./CloseDuring.db"
+	db, err := Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+
+	var group sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		group.Add(1)
+		go func(writer int) {
+			defer group.Done()
+			for i := 0; ; i++ {
+				_, err := db.Exec("insert ? ? ?", i*4+writer+1, "user", "we@qq.com")
+				if err == ErrClosed || err == ErrTableFull {
+					return
+				}
+				if err != nil {
+					t.Errorf("insert must be success or closed: %v", err)
+					return
+				}
+				if _, err := db.Query("select where id = ?", i*4+writer+1); err != nil && err != ErrClosed {
+					t.Errorf("select must be success or closed: %v", err)
+					return
+				}
+			}
+		}(writer)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("close must be success: %v", err)
+	}
+	group.Wait()
+
+	// The rows inserted before Close are written
+	db, err = Open(dbFile, &Options{MustExist: true})
+	if err != nil {
+		t.Fatalf("reopen must be success: %v", err)
+	}
+	if _, err := db.Exec("insert ? ? ?", 0, "user", "we@qq.com"); err != nil {
+		t.Errorf("insert must be success: %v", err)
+	}
+	db.Close()
+	os.Remove(dbFile)
+}
+
+func TestReadOnly(t *testing.T) {
+	dbFile := "./ReadOnly.db"
+	db, _ := Open(dbFile, nil)
+	db.Exec("insert 1 chen we@qq.com")
+	if _, err := Open(dbFile, &Options{ReadOnly: true}); err != ErrLocked || err.Error() != "database is locked" {
+		t.Errorf("error must be database is locked: %v", err)
+	}
+	db.Close()
+
+	db, err := Open(dbFile, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("open read-only must be success: %v", err)
+	}
+	if _, err := db.Exec("insert 2 chen we@qq.com"); err != ErrReadOnly {
+		t.Errorf("error must be read-only: %v", err)
+	}
+	rows, err := db.Query("select")
+	if err != nil || !rows.Next() || rows.Next() {
+		t.Errorf("read-only DB must have 1 row")
+	}
+	db.Close()
+	os.Remove(dbFile)
+}
+
+func TestBackendError(t *testing.T) {
+	dbFile := "./BackendError.db"
+	db, _ := Open(dbFile, nil)
+	db.Exec("insert 1 chen we@qq.com")
+	db.Close()
+
+	// Root page of an unknown node type
+	file, _ := os.OpenFile(dbFile, os.O_RDWR, 0600)
+	file.WriteAt([]byte{0xff}, backend.NodeTypeOffset)
+	file.Close()
+
+	db, err := Open(dbFile, nil)
+	if err != nil {
+		t.Fatalf("open must be success: %v", err)
+	}
+	var backendErr *backend.Error
+	if _, err := db.Query("select"); !errors.As(err, &backendErr) {
+		t.Errorf("the corrupt page must be an error: %v", err)
+	}
+	if _, err := db.Exec("insert 2 chen we@qq.com"); err != backendErr {
+		t.Errorf("the later statements must fail with the same error: %v", err)
+	}
+	if err := db.Close(); err != backendErr {
+		t.Errorf("close must return the error: %v", err)
+	}
+	os.Remove(dbFile)
+}
+
+func countRows(t *testing.T, query func(query string, args ...interface{}) (*Rows, error)) int {
+	rows, err := query("select")
+	if err != nil {
+		t.Fatalf("select must be success: %v", err)
+	}
+	var count int = 0
+	for rows.Next() {
+		count++
+	}
+	return count
+}
+
+func TestTx(t *testing.T) {
+	dbFile := "./Tx.db"
+	db, _ := Open(dbFile, nil)
+	db.Exec("insert 1 chen we@qq.com")
+
+	first, _ := db.Begin()
+	for i := 2; i <= 5; i++ {
+		if _, err := first.Exec("insert ? user ?", i, nil); err != nil {
+			t.Errorf("insert in transaction must be success: %v", err)
+		}
+	}
+	if countRows(t, first.Query) != 5 || countRows(t, db.Query) != 1 {
+		t.Errorf("only the transaction sees its changes before commit")
+	}
+	if _, err := first.Exec("commit"); err != ErrTxStatement {
+		t.Errorf("error must be transaction statement: %v", err)
+	}
+
+	// Writers are not blocked by transactions
+	if _, err := db.Exec("update 1 wang"); err != nil {
+		t.Errorf("update must be success: %v", err)
+	}
+	if err := first.Commit(); err != ErrConflict {
+		t.Errorf("first commit must conflict with the update of the same leaf: %v", err)
+	}
+	if first.Commit() != ErrTxDone {
+		t.Errorf("commit twice must be error")
+	}
+	if countRows(t, db.Query) != 1 {
+		t.Errorf("aborted transaction must not change the table")
+	}
+
+	second, _ := db.Begin()
+	second.Exec("insert 2 user we@qq.com")
+	third, _ := db.Begin()
+	if err := second.Commit(); err != nil {
+		t.Errorf("commit must be success: %v", err)
+	}
+	if countRows(t, db.Query) != 2 || countRows(t, third.Query) != 1 {
+		t.Errorf("committed change is seen by the later snapshots only")
+	}
+	third.Rollback()
+
+	// Transaction statements are run by Begin or a Conn, they would begin a transaction shared by the users of DB
+	for _, query := range []string{"begin", "commit", "rollback"} {
+		if _, err := db.Exec(query); err != ErrTransactionStatement {
+			t.Errorf("%v must be rejected by Exec: %v", query, err)
+		}
+		if _, err := db.Query(query); err != ErrTransactionStatement {
+			t.Errorf("%v must be rejected by Query: %v", query, err)
+		}
+	}
+	if _, err := db.Query("explain begin"); err != nil {
+		t.Errorf("explain begin must be success: %v", err)
+	}
+
+	db.Close()
+	os.Remove(dbFile)
+}
+
+func TestBackup(t *testing.T) {
+	dbFile := "./Backup.db"
+	backupFile := "./BackupCopy.db"
+	db, _ := Open(dbFile, nil)
+	db.Exec("create table people (id integer primary key, name text, email text)")
+	for i := 1; i <= 30; i++ {
+		db.Exec("insert ? ? ?", i, "chen", "we@qq.com")
+	}
+
+	backup, err := db.BeginBackup(backupFile)
+	if err != nil {
+		t.Fatalf("backup must begin: %v", err)
+	}
+	backup.Step(1)
+	db.Exec("insert 31 chen we@qq.com")
+	if done, err := backup.Step(-1); !done || err != nil || backup.Remaining() != 0 {
+		t.Errorf("backup must be done: %v %v", done, err)
+	}
+
+	copied, err := Open(backupFile, &Options{MustExist: true})
+	if err != nil {
+		t.Fatalf("backup must be opened: %v", err)
+	}
+	tables, _ := copied.Tables()
+	if count := countRows(t, copied.Query); count != 30 || tables[0].Name != "people" {
+		t.Errorf("backup must have 30 rows of people: %v %v", count, tables[0].Name)
+	}
+	copied.Close()
+
+	// Backup of the whole DB replaces the old backup
+	if err := db.Backup(backupFile); err != nil {
+		t.Errorf("backup must be success: %v", err)
+	}
+	copied, _ = Open(backupFile, nil)
+	if count := countRows(t, copied.Query); count != 31 {
+		t.Errorf("backup must have 31 rows: %v", count)
+	}
+	copied.Close()
+
+	db.Close()
+	if err := db.Backup(backupFile); err != ErrClosed {
+		t.Errorf("backup of closed DB must fail: %v", err)
+	}
+	for _, file := range []string{dbFile, backupFile} {
+		os.Remove(file)
+		os.Remove(file + ".schema")
+	}
+}
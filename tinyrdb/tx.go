@@ -0,0 +1,130 @@
+package tinyrdb
+
+import (
+	"sync"
+	"tiny-rdb/backend"
+)
+
+// Tx a transaction of DB, its statements run on a private copy of the snapshot taken at Begin
+type Tx struct {
+	db          *DB
+	transaction *backend.Transaction
+	mutex       sync.Mutex
+	done        bool
+}
+
+// Begin Begin a transaction
+func (db *DB) Begin() (*Tx, error) {
+	table, err := db.pin()
+	if err != nil {
+		return nil, err
+	}
+	defer db.unpin()
+	return db.begin(table)
+}
+
+// begin Begin a transaction on the table of DB, the caller pins the DB
+func (db *DB) begin(table *backend.Table) (tx *Tx, err error) {
+	defer db.recoverBackend(&err)
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+	return &Tx{db: db, transaction: backend.BeginTransaction(table)}, nil
+}
+
+// workTable Get the private copy of table the statements of transaction run on
+func (tx *Tx) workTable() (*backend.Table, error) {
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.transaction.Table, nil
+}
+
+// Exec Run a statement which returns no rows in the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (result Result, err error) {
+	table, err := tx.workTable()
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := tx.db.pin(); err != nil {
+		return Result{}, err
+	}
+	defer tx.db.unpin()
+
+	statement, err := tx.db.prepare(query, args)
+	if err != nil {
+		return Result{}, err
+	}
+	if isTransactionStatement(statement) {
+		return Result{}, ErrTxStatement
+	}
+	defer tx.db.recoverBackend(&err)
+	return execStatement(table, statement)
+}
+
+// Query Run a statement which returns rows in the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (rows *Rows, err error) {
+	table, err := tx.workTable()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.db.pin(); err != nil {
+		return nil, err
+	}
+	defer tx.db.unpin()
+
+	statement, err := tx.db.prepare(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if isTransactionStatement(statement) {
+		return nil, ErrTxStatement
+	}
+	defer tx.db.recoverBackend(&err)
+	return queryStatement(table, statement)
+}
+
+// end Mark the transaction done, return false if it was done
+func (tx *Tx) end() bool {
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
+	if tx.done {
+		return false
+	}
+	tx.done = true
+	return true
+}
+
+// Commit Install the changes of transaction, return ErrConflict if a page it changed was changed by another commit
+func (tx *Tx) Commit() error {
+	if !tx.end() {
+		return ErrTxDone
+	}
+
+	table, err := tx.db.pin()
+	if err != nil {
+		return err
+	}
+	defer tx.db.unpin()
+	return tx.commit(table)
+}
+
+// commit Install the changes of transaction to the table of DB, the caller pins the DB
+func (tx *Tx) commit(table *backend.Table) (err error) {
+	defer tx.db.recoverBackend(&err)
+	table.RWLock.Lock()
+	defer table.RWLock.Unlock()
+	if !backend.CommitTransaction(table, tx.transaction) {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Rollback Discard the changes of transaction
+func (tx *Tx) Rollback() error {
+	if !tx.end() {
+		return ErrTxDone
+	}
+	return nil
+}
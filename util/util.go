@@ -11,9 +11,12 @@ const (
 	ExitFailure = -1
 )
 
-// ToString convert null-terminated byte array to string
+// ToString convert null-terminated byte array to string, the whole array is used if there is no terminator
 func ToString(byteStr []byte) string {
 	n := bytes.IndexByte(byteStr, 0)
+	if n < 0 {
+		return string(byteStr)
+	}
 	return string(byteStr[:n])
 }
 